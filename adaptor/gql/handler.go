@@ -0,0 +1,128 @@
+/*
+Package gql serves the GraphQL API with the same operators as the REST adaptor.
+*/
+package gql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+
+	"literank.com/rest-books/application"
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/model"
+)
+
+const tokenPrefix = "Bearer "
+
+type (
+	identityKey struct{}
+	loaderKey   struct{}
+	clientIPKey struct{}
+)
+
+// request is a GraphQL request over HTTP
+type request struct {
+	Query         string                 `json:"query" form:"query"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// MakeHandler makes the gin handler of the GraphQL endpoint
+func MakeHandler(wireHelper *application.WireHelper) (gin.HandlerFunc, error) {
+	r := &resolver{
+		bookOperator:   wireHelper.BookOperator(),
+		reviewOperator: wireHelper.ReviewOperator(),
+		userOperator:   wireHelper.UserOperator(),
+	}
+	schema, err := r.makeSchema()
+	if err != nil {
+		return nil, err
+	}
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		if token := strings.Replace(c.GetHeader("Authorization"), tokenPrefix, "", 1); token != "" {
+			u, err := r.userOperator.Authenticate(ctx, token)
+			if errors.Is(err, model.ErrUnauthenticated) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check the token"})
+				return
+			}
+			ctx = context.WithValue(ctx, identityKey{}, u)
+			ctx = executor.WithActor(ctx, &executor.Actor{UserID: u.UserID, IP: c.ClientIP()})
+		}
+		ctx = context.WithValue(ctx, loaderKey{}, newReviewLoader(ctx, r.reviewOperator))
+		ctx = context.WithValue(ctx, clientIPKey{}, c.ClientIP())
+		// Mutations are not allowed over GET
+		allowMutation := c.Request.Method != http.MethodGet
+		c.JSON(http.StatusOK, execute(ctx, &schema, &req, allowMutation))
+	}, nil
+}
+
+func execute(ctx context.Context, schema *graphql.Schema, req *request, allowMutation bool) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query)})})
+	if err != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.FormatError(err)}}
+	}
+	if v := graphql.ValidateDocument(schema, doc, nil); !v.IsValid {
+		return &graphql.Result{Errors: v.Errors}
+	}
+	if !allowMutation && hasMutation(doc, req.OperationName) {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{
+			gqlerrors.NewFormattedError("mutations require POST")}}
+	}
+	if err := checkLimits(doc, req.OperationName); err != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.FormatError(err)}}
+	}
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        *schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+}
+
+func hasMutation(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || (operationName != "" && (op.Name == nil || op.Name.Value != operationName)) {
+			continue
+		}
+		if op.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
+
+func identityFrom(ctx context.Context) (*model.UserIdentity, bool) {
+	u, ok := ctx.Value(identityKey{}).(*model.UserIdentity)
+	return u, ok
+}
+
+func clientIPFrom(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+func loaderFrom(ctx context.Context) *reviewLoader {
+	return ctx.Value(loaderKey{}).(*reviewLoader)
+}
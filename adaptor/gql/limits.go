@@ -0,0 +1,97 @@
+package gql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	maxQueryDepth      = 8
+	maxQueryComplexity = 1000
+	// listFactor is the assumed size of list fields when scoring a query
+	listFactor = 10
+)
+
+// listFields are the fields returning lists, whose selections cost listFactor times more
+var listFields = map[string]bool{
+	"books":   true,
+	"reviews": true,
+}
+
+// queryCost walks an operation and measures its depth and complexity.
+// Introspection fields are free, so that tools like GraphiQL keep working.
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	visiting  map[string]bool
+}
+
+// checkLimits rejects operations that are too deep or too complex
+func checkLimits(doc *ast.Document, operationName string) error {
+	c := &queryCost{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		visiting:  make(map[string]bool),
+	}
+	var ops []*ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			c.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				ops = append(ops, d)
+			}
+		}
+	}
+	for _, op := range ops {
+		depth, complexity := c.measure(op.SelectionSet)
+		if depth > maxQueryDepth {
+			return fmt.Errorf("query depth %d exceeds the limit %d", depth, maxQueryDepth)
+		}
+		if complexity > maxQueryComplexity {
+			return fmt.Errorf("query complexity %d exceeds the limit %d", complexity, maxQueryComplexity)
+		}
+	}
+	return nil
+}
+
+// measure returns the depth and complexity of a selection set
+func (c *queryCost) measure(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	maxDepth, total := 0, 0
+	for _, sel := range set.Selections {
+		var depth, complexity int
+		switch s := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			depth, complexity = c.measure(s.SelectionSet)
+			if listFields[s.Name.Value] {
+				complexity *= listFactor
+			}
+			depth++
+			complexity++
+		case *ast.InlineFragment:
+			depth, complexity = c.measure(s.SelectionSet)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			f, ok := c.fragments[name]
+			// Fragment cycles are reported by the validator
+			if !ok || c.visiting[name] {
+				continue
+			}
+			c.visiting[name] = true
+			depth, complexity = c.measure(f.SelectionSet)
+			delete(c.visiting, name)
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		total += complexity
+	}
+	return maxDepth, total
+}
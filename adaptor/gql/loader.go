@@ -0,0 +1,69 @@
+package gql
+
+import (
+	"context"
+	"sync"
+
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/model"
+)
+
+// reviewLoader batches the reviews lookups of one request.
+// Resolvers queue book IDs and get a thunk back; the first thunk
+// to run loads the reviews of every queued book in one query.
+type reviewLoader struct {
+	ctx            context.Context
+	reviewOperator *executor.ReviewOperator
+
+	mu      sync.Mutex
+	pending []uint
+	results map[uint][]*model.Review
+	errs    map[uint]error
+}
+
+func newReviewLoader(ctx context.Context, o *executor.ReviewOperator) *reviewLoader {
+	return &reviewLoader{
+		ctx:            ctx,
+		reviewOperator: o,
+		results:        make(map[uint][]*model.Review),
+		errs:           make(map[uint]error),
+	}
+}
+
+// load queues the book and returns a thunk resolving to its reviews
+func (l *reviewLoader) load(bookID uint) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.results[bookID]; !ok {
+		l.pending = append(l.pending, bookID)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.pending) > 0 {
+			l.dispatchLocked()
+		}
+		if err := l.errs[bookID]; err != nil {
+			return nil, err
+		}
+		return l.results[bookID], nil
+	}
+}
+
+func (l *reviewLoader) dispatchLocked() {
+	bookIDs := l.pending
+	l.pending = nil
+	reviews, err := l.reviewOperator.GetReviewsOfBooks(l.ctx, bookIDs)
+	for _, id := range bookIDs {
+		if err != nil {
+			l.errs[id] = err
+			continue
+		}
+		list, ok := reviews[id]
+		if !ok {
+			list = make([]*model.Review, 0)
+		}
+		l.results[id] = list
+	}
+}
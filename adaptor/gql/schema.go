@@ -0,0 +1,391 @@
+package gql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/model"
+)
+
+const (
+	argID         = "id"
+	argBookID     = "bookId"
+	argOffset     = "offset"
+	argQuery      = "query"
+	argInput      = "input"
+	argEmail      = "email"
+	argPassword   = "password"
+	argChallenge  = "challengeToken"
+	argCode       = "code"
+	fieldTitle    = "title"
+	fieldAuthor   = "author"
+	fieldContent  = "content"
+	fieldCreated  = "createdAt"
+	fieldUpdated  = "updatedAt"
+	fieldPages    = "totalPages"
+	fieldISBN     = "isbn"
+	fieldDesc     = "description"
+	fieldPublish  = "publishedAt"
+	fieldReviews  = "reviews"
+	fieldBooks    = "books"
+	fieldUser     = "user"
+	fieldToken    = "token"
+	fieldMFA      = "mfaRequired"
+	fieldEnroll   = "mfaEnrollmentRequired"
+	fieldIdentity = "me"
+)
+
+// resolver resolves all fields with the shared operators
+type resolver struct {
+	bookOperator   *executor.BookOperator
+	reviewOperator *executor.ReviewOperator
+	userOperator   *executor.UserOperator
+}
+
+func (r *resolver) makeSchema() (graphql.Schema, error) {
+	reviewType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Review",
+		Description: "The review of a book",
+		Fields: graphql.Fields{
+			argID:        reviewField(graphql.NewNonNull(graphql.ID), func(v *model.Review) interface{} { return v.ID }),
+			argBookID:    reviewField(graphql.NewNonNull(graphql.ID), func(v *model.Review) interface{} { return v.BookID }),
+			fieldAuthor:  reviewField(graphql.String, func(v *model.Review) interface{} { return v.Author }),
+			fieldTitle:   reviewField(graphql.String, func(v *model.Review) interface{} { return v.Title }),
+			fieldContent: reviewField(graphql.String, func(v *model.Review) interface{} { return v.Content }),
+			fieldCreated: reviewField(graphql.DateTime, func(v *model.Review) interface{} { return v.CreatedAt }),
+			fieldUpdated: reviewField(graphql.DateTime, func(v *model.Review) interface{} { return v.UpdatedAt }),
+		},
+	})
+	bookType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Book",
+		Description: "A book",
+		Fields: graphql.Fields{
+			argID:        bookField(graphql.NewNonNull(graphql.ID), func(v *model.Book) interface{} { return v.ID }),
+			fieldTitle:   bookField(graphql.String, func(v *model.Book) interface{} { return v.Title }),
+			fieldAuthor:  bookField(graphql.String, func(v *model.Book) interface{} { return v.Author }),
+			fieldPublish: bookField(graphql.String, func(v *model.Book) interface{} { return v.PublishedAt }),
+			fieldDesc:    bookField(graphql.String, func(v *model.Book) interface{} { return v.Description }),
+			fieldISBN:    bookField(graphql.String, func(v *model.Book) interface{} { return v.ISBN }),
+			fieldPages:   bookField(graphql.Int, func(v *model.Book) interface{} { return v.TotalPages }),
+			fieldCreated: bookField(graphql.DateTime, func(v *model.Book) interface{} { return v.CreatedAt }),
+			fieldUpdated: bookField(graphql.DateTime, func(v *model.Book) interface{} { return v.UpdatedAt }),
+			fieldReviews: &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(reviewType))),
+				Description: "Reviews of the book, optionally filtered by a keyword",
+				Args:        graphql.FieldConfigArgument{argQuery: {Type: graphql.String}},
+				Resolve:     r.bookReviews,
+			},
+		},
+	})
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "An app user",
+		Fields: graphql.Fields{
+			argID:    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			argEmail: &graphql.Field{Type: graphql.String},
+		},
+	})
+	authType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "AuthPayload",
+		Description: "The result of a successful sign-in, or its challenge for the second factor",
+		Fields: graphql.Fields{
+			fieldUser:    &graphql.Field{Type: graphql.NewNonNull(userType)},
+			fieldToken:   &graphql.Field{Type: graphql.String},
+			fieldMFA:     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			argChallenge: &graphql.Field{Type: graphql.String},
+			fieldEnroll:  &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+	bookInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "BookInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			fieldTitle:   {Type: graphql.String},
+			fieldAuthor:  {Type: graphql.String},
+			fieldPublish: {Type: graphql.String},
+			fieldDesc:    {Type: graphql.String},
+			fieldISBN:    {Type: graphql.String},
+			fieldPages:   {Type: graphql.Int},
+		},
+	})
+	reviewInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "ReviewInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			argBookID:    {Type: graphql.ID},
+			fieldAuthor:  {Type: graphql.String},
+			fieldTitle:   {Type: graphql.String},
+			fieldContent: {Type: graphql.String},
+		},
+	})
+
+	idArgs := graphql.FieldConfigArgument{argID: {Type: graphql.NewNonNull(graphql.ID)}}
+	credentialArgs := graphql.FieldConfigArgument{
+		argEmail:    {Type: graphql.NewNonNull(graphql.String)},
+		argPassword: {Type: graphql.NewNonNull(graphql.String)},
+	}
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			fieldBooks: &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+				Args: graphql.FieldConfigArgument{
+					argOffset: {Type: graphql.Int, DefaultValue: 0},
+					argQuery:  {Type: graphql.String, DefaultValue: ""},
+				},
+				Resolve: r.books,
+			},
+			"book":   &graphql.Field{Type: bookType, Args: idArgs, Resolve: r.book},
+			"review": &graphql.Field{Type: reviewType, Args: idArgs, Resolve: r.review},
+			fieldIdentity: &graphql.Field{
+				Type:        userType,
+				Description: "The user behind the bearer token",
+				Resolve:     r.me,
+			},
+		},
+	})
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createBook": &graphql.Field{
+				Type:    graphql.NewNonNull(bookType),
+				Args:    graphql.FieldConfigArgument{argInput: {Type: graphql.NewNonNull(bookInput)}},
+				Resolve: r.createBook,
+			},
+			"updateBook": &graphql.Field{
+				Type: graphql.NewNonNull(bookType),
+				Args: graphql.FieldConfigArgument{
+					argID:    {Type: graphql.NewNonNull(graphql.ID)},
+					argInput: {Type: graphql.NewNonNull(bookInput)},
+				},
+				Resolve: r.updateBook,
+			},
+			"deleteBook": &graphql.Field{Type: graphql.Boolean, Args: idArgs, Resolve: r.deleteBook},
+			"createReview": &graphql.Field{
+				Type:    graphql.NewNonNull(reviewType),
+				Args:    graphql.FieldConfigArgument{argInput: {Type: graphql.NewNonNull(reviewInput)}},
+				Resolve: r.createReview,
+			},
+			"updateReview": &graphql.Field{
+				Type: graphql.NewNonNull(reviewType),
+				Args: graphql.FieldConfigArgument{
+					argID:        {Type: graphql.NewNonNull(graphql.ID)},
+					fieldTitle:   {Type: graphql.NewNonNull(graphql.String)},
+					fieldContent: {Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: r.updateReview,
+			},
+			"deleteReview": &graphql.Field{Type: graphql.Boolean, Args: idArgs, Resolve: r.deleteReview},
+			"signUp":       &graphql.Field{Type: userType, Args: credentialArgs, Resolve: r.signUp},
+			"signIn":       &graphql.Field{Type: authType, Args: credentialArgs, Resolve: r.signIn},
+			"signInMFA": &graphql.Field{Type: authType, Args: graphql.FieldConfigArgument{
+				argChallenge: {Type: graphql.NewNonNull(graphql.String)},
+				argCode:      {Type: graphql.NewNonNull(graphql.String)},
+			}, Resolve: r.signInMFA},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func bookField(t graphql.Output, get func(*model.Book) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(*model.Book)), nil
+	}}
+}
+
+func reviewField(t graphql.Output, get func(*model.Review) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(*model.Review)), nil
+	}}
+}
+
+func (r *resolver) books(p graphql.ResolveParams) (interface{}, error) {
+	return r.bookOperator.GetBooks(p.Context, p.Args[argOffset].(int), p.Args[argQuery].(string))
+}
+
+func (r *resolver) book(p graphql.ResolveParams) (interface{}, error) {
+	id, err := bookID(p.Args[argID])
+	if err != nil {
+		return nil, err
+	}
+	return r.bookOperator.GetBook(p.Context, id)
+}
+
+// bookReviews batches the reviews of all books in the response through the request's loader
+func (r *resolver) bookReviews(p graphql.ResolveParams) (interface{}, error) {
+	b := p.Source.(*model.Book)
+	if query, _ := p.Args[argQuery].(string); query != "" {
+		// Searches are per book, they can't be batched
+		return r.reviewOperator.GetReviewsOfBook(p.Context, b.ID, query)
+	}
+	return loaderFrom(p.Context).load(b.ID), nil
+}
+
+func (r *resolver) review(p graphql.ResolveParams) (interface{}, error) {
+	return r.reviewOperator.GetReview(p.Context, p.Args[argID].(string))
+}
+
+func (r *resolver) me(p graphql.ResolveParams) (interface{}, error) {
+	u, ok := identityFrom(p.Context)
+	if !ok {
+		return nil, nil
+	}
+	return &dto.User{ID: u.UserID, Email: u.Email}, nil
+}
+
+func (r *resolver) createBook(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePerm(p.Context, model.PermAuthor); err != nil {
+		return nil, err
+	}
+	return r.bookOperator.CreateBook(p.Context, bookFromInput(p.Args[argInput]))
+}
+
+func (r *resolver) updateBook(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePerm(p.Context, model.PermAuthor); err != nil {
+		return nil, err
+	}
+	id, err := bookID(p.Args[argID])
+	if err != nil {
+		return nil, err
+	}
+	return r.bookOperator.UpdateBook(p.Context, id, bookFromInput(p.Args[argInput]))
+}
+
+func (r *resolver) deleteBook(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePerm(p.Context, model.PermAuthor); err != nil {
+		return nil, err
+	}
+	id, err := bookID(p.Args[argID])
+	if err != nil {
+		return nil, err
+	}
+	if err := r.bookOperator.DeleteBook(p.Context, id); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (r *resolver) createReview(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePerm(p.Context, model.PermUser); err != nil {
+		return nil, err
+	}
+	u, _ := identityFrom(p.Context)
+	in, _ := p.Args[argInput].(map[string]interface{})
+	id, err := bookID(in[argBookID])
+	if err != nil {
+		return nil, err
+	}
+	return r.reviewOperator.CreateReview(p.Context, u.UserID, &dto.ReviewBody{
+		BookID:  id,
+		Author:  stringArg(in, fieldAuthor),
+		Title:   stringArg(in, fieldTitle),
+		Content: stringArg(in, fieldContent),
+	})
+}
+
+func (r *resolver) updateReview(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePerm(p.Context, model.PermUser); err != nil {
+		return nil, err
+	}
+	u, _ := identityFrom(p.Context)
+	id := p.Args[argID].(string)
+	review, err := r.reviewOperator.UpdateReview(p.Context, u, id, &model.Review{
+		Title:   stringArg(p.Args, fieldTitle),
+		Content: stringArg(p.Args, fieldContent),
+	})
+	if err != nil {
+		return nil, err
+	}
+	review.ID = id
+	return review, nil
+}
+
+func (r *resolver) deleteReview(p graphql.ResolveParams) (interface{}, error) {
+	if err := requirePerm(p.Context, model.PermUser); err != nil {
+		return nil, err
+	}
+	u, _ := identityFrom(p.Context)
+	if err := r.reviewOperator.DeleteReview(p.Context, u, p.Args[argID].(string)); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (r *resolver) signUp(p graphql.ResolveParams) (interface{}, error) {
+	return r.userOperator.CreateUser(p.Context, &dto.UserCredential{
+		Email:    stringArg(p.Args, argEmail),
+		Password: stringArg(p.Args, argPassword),
+	})
+}
+
+func (r *resolver) signIn(p graphql.ResolveParams) (interface{}, error) {
+	ut, err := r.userOperator.SignIn(p.Context, stringArg(p.Args, argEmail), stringArg(p.Args, argPassword),
+		clientIPFrom(p.Context))
+	if err != nil {
+		return nil, err
+	}
+	return authPayload(ut), nil
+}
+
+func (r *resolver) signInMFA(p graphql.ResolveParams) (interface{}, error) {
+	ut, err := r.userOperator.SignInMFA(p.Context, stringArg(p.Args, argChallenge), stringArg(p.Args, argCode),
+		clientIPFrom(p.Context))
+	if err != nil {
+		return nil, err
+	}
+	return authPayload(ut), nil
+}
+
+func authPayload(ut *dto.UserToken) map[string]interface{} {
+	return map[string]interface{}{fieldUser: &ut.User, fieldToken: optional(ut.Token), fieldMFA: ut.MFARequired,
+		argChallenge: optional(ut.ChallengeToken), fieldEnroll: ut.MFAEnrollmentRequired}
+}
+
+// optional returns nil for an empty string, so that it resolves to null
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func requirePerm(ctx context.Context, perm model.UserPermission) error {
+	u, ok := identityFrom(ctx)
+	if !ok {
+		return fmt.Errorf("%w: token is required", model.ErrUnauthenticated)
+	}
+	if u.Permission < perm {
+		return fmt.Errorf("%w: Unauthorized", model.ErrPermissionDenied)
+	}
+	return nil
+}
+
+func bookID(v interface{}) (uint, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid book id", model.ErrInvalidArgument)
+	}
+	return uint(id), nil
+}
+
+func bookFromInput(v interface{}) *model.Book {
+	in, _ := v.(map[string]interface{})
+	pages, _ := in[fieldPages].(int)
+	return &model.Book{
+		Title:       stringArg(in, fieldTitle),
+		Author:      stringArg(in, fieldAuthor),
+		PublishedAt: stringArg(in, fieldPublish),
+		Description: stringArg(in, fieldDesc),
+		ISBN:        stringArg(in, fieldISBN),
+		TotalPages:  pages,
+	}
+}
+
+func stringArg(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
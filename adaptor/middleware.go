@@ -1,36 +1,248 @@
 package adaptor
 
 import (
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 
+	"literank.com/rest-books/application/executor"
 	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/logging"
+	"literank.com/rest-books/infrastructure/metrics"
+	"literank.com/rest-books/infrastructure/ratelimit"
+	"literank.com/rest-books/infrastructure/tracing"
 )
 
-const tokenPrefix = "Bearer "
+const (
+	tokenPrefix     = "Bearer "
+	headerRequestID = "X-Request-ID"
+	headerAPIKey    = "X-API-Key"
 
-// PermCheck checks user permission
-func (r *RestHandler) PermCheck(allowPerm model.UserPermission) gin.HandlerFunc {
+	// keyIdentity is the gin context key of the caller's identity, set by PermCheck
+	keyIdentity = "identity"
+
+	// routeUnmatched labels requests that hit no route, to keep label values bounded
+	routeUnmatched = "unmatched"
+)
+
+// Reasons of token validation failures
+const (
+	tokenMissing   = "missing"
+	tokenInvalid   = "invalid"
+	tokenForbidden = "forbidden"
+	tokenScope     = "scope"
+)
+
+// PermCheck checks user permission, and keeps the caller's identity in the context.
+// Callers sign in with a token, or with an API key where the route takes any of the scopes.
+func (r *RestHandler) PermCheck(allowPerm model.UserPermission, scopes ...model.APIScope) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.Request.Header.Get("Authorization")
-		if authHeader == "" {
+		var (
+			u   *model.UserIdentity
+			err error
+		)
+		token, key := bearerToken(c), c.GetHeader(headerAPIKey)
+		switch {
+		case token != "":
+			u, err = r.userOperator.Authenticate(c, token)
+		case key != "":
+			u, err = r.userOperator.AuthenticateAPIKey(c, key)
+		default:
+			r.metrics.CountTokenFailure(tokenMissing)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "token is required"})
 			c.Abort()
 			return
 		}
-		token := strings.Replace(authHeader, tokenPrefix, "", 1)
-		hasPerm, err := r.userOperator.HasPermission(token, allowPerm)
+		if err != nil && !errors.Is(err, model.ErrUnauthenticated) {
+			r.logger.ErrorContext(c, "Failed to check the credentials", logging.KeyError, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check the credentials"})
+			c.Abort()
+			return
+		}
 		message := "Unauthorized"
+		reason := tokenForbidden
 		if err != nil {
 			message = err.Error()
+			reason = tokenInvalid
 		}
-		if !hasPerm {
+		if err != nil || u.Permission < allowPerm {
+			r.metrics.CountTokenFailure(reason)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": message})
 			c.Abort()
 			return
 		}
+		if !u.Allows(scopes...) {
+			r.metrics.CountTokenFailure(tokenScope)
+			c.JSON(http.StatusForbidden, gin.H{"error": "the API key has no scope for this route"})
+			c.Abort()
+			return
+		}
+		c.Set(keyIdentity, u)
+		c.Request = c.Request.WithContext(executor.WithActor(c.Request.Context(),
+			&executor.Actor{UserID: u.UserID, APIKeyID: u.APIKeyID, IP: c.ClientIP()}))
+		c.Next()
+	}
+}
+
+// RateLimit limits the requests of the route group, each caller counted by the key of the group's policy.
+// Limited responses carry the RateLimit-* headers, and rejected ones Retry-After too.
+func (r *RestHandler) RateLimit(g ratelimit.Group) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := r.rateLimiter.Allow(c, g, r.rateLimitKey(c, r.rateLimiter.Policy(g).Key))
+		if result.Limit > 0 {
+			c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+			c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			c.Header("RateLimit-Reset", ceilSeconds(result.ResetAfter))
+		}
+		if !result.Allowed {
+			r.metrics.CountRateLimited(string(g))
+			c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey returns the bucket key of the caller.
+// Rate limits run before PermCheck, so API keys are checked here too, and unknown ones count by IP.
+func (r *RestHandler) rateLimitKey(c *gin.Context, kind string) string {
+	var apiKeyID, userID uint
+	if kind != ratelimit.KeyIP {
+		if token := bearerToken(c); token != "" {
+			if u, err := r.userOperator.ParseToken(token); err == nil {
+				userID = u.UserID
+			}
+		} else if key := c.GetHeader(headerAPIKey); key != "" {
+			if u, err := r.userOperator.AuthenticateAPIKey(c, key); err == nil {
+				apiKeyID, userID = u.APIKeyID, u.UserID
+			}
+		}
+	}
+	return ratelimit.Key(kind, c.ClientIP(), apiKeyID, userID)
+}
+
+// ceilSeconds formats the duration in whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// identityFrom returns the identity PermCheck found in the caller's token or API key
+func identityFrom(c *gin.Context) (*model.UserIdentity, bool) {
+	v, _ := c.Get(keyIdentity)
+	u, ok := v.(*model.UserIdentity)
+	return u, ok
+}
+
+// bearerToken returns the token in the Authorization header
+func bearerToken(c *gin.Context) string {
+	authHeader := c.Request.Header.Get("Authorization")
+	return strings.Replace(authHeader, tokenPrefix, "", 1)
+}
+
+// Tracing starts a server span for every request, continuing the caller's trace
+// given in the W3C traceparent header
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = routeUnmatched
+		}
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+			))
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// RequestID accepts the caller's X-Request-ID or generates one,
+// and puts it into the request context for the logs of every layer.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerRequestID)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(headerRequestID, id)
 		c.Next()
 	}
 }
+
+// AuditActor keeps the caller's address in the request context, for the audit log.
+// PermCheck adds who the caller is, once it is known.
+func AuditActor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(executor.WithActor(c.Request.Context(), &executor.Actor{IP: c.ClientIP()}))
+		c.Next()
+	}
+}
+
+// AccessLog logs every request once it is served
+func AccessLog(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		// The query string is left out, since it may carry tokens
+		logger.Log(c, level, "Request served",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"elapsed", time.Since(start),
+			"client_ip", c.ClientIP(),
+			"size", c.Writer.Size(),
+		)
+	}
+}
+
+// Metrics records the latency of every request by route and status
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = routeUnmatched
+		}
+		m.ObserveHTTP(c.Request.Method, route, strconv.Itoa(c.Writer.Status()), time.Since(start).Seconds())
+	}
+}
+
+// Recovery turns panics into 500 responses and logs them
+func Recovery(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		logger.ErrorContext(c, "Panic recovered", "panic", err, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	})
+}
@@ -0,0 +1,291 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	contentJSON = "application/json"
+	schemaRef   = "#/components/schemas/"
+	// BearerAuth is the name of the bearer token security scheme
+	BearerAuth = "bearerAuth"
+	// APIKeyAuth is the name of the API key security scheme
+	APIKeyAuth = "apiKeyAuth"
+)
+
+// Param describes a path or query parameter of a route
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      *Schema
+}
+
+// Reply describes a response of a route.
+// Body is a sample value whose type gives the schema, nil means no body.
+type Reply struct {
+	Status      int
+	Description string
+	Body        interface{}
+	Schema      *Schema
+}
+
+// Route describes a route registered on the router
+type Route struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Tag         string
+	Auth        bool
+	// Scopes are the API key scopes the route takes besides tokens, none if it takes tokens only
+	Scopes []string
+	Params []*Param
+	// Body is a sample value of the request body, whose type gives the schema
+	Body    interface{}
+	Replies []*Reply
+}
+
+// Builder builds a Document out of routes
+type Builder struct {
+	doc   *Document
+	types map[string]reflect.Type
+}
+
+// NewBuilder constructs a new Builder
+func NewBuilder(info *Info) *Builder {
+	return &Builder{types: make(map[string]reflect.Type), doc: &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]*PathItem),
+		Components: &Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]*SecurityScheme{
+				BearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				APIKeyAuth: {Type: "apiKey", Name: "X-API-Key", In: "header"},
+			},
+		},
+	}}
+}
+
+// Add adds the route to the document
+func (b *Builder) Add(r *Route) {
+	path := ToOpenAPIPath(r.Path)
+	item, ok := b.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		b.doc.Paths[path] = item
+	}
+	op := &Operation{
+		OperationID: r.OperationID,
+		Summary:     r.Summary,
+		Responses:   make(map[string]*Response),
+	}
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+	}
+	if r.Auth {
+		op.Security = []map[string][]string{{BearerAuth: {}}}
+		if len(r.Scopes) > 0 {
+			op.Security = append(op.Security, map[string][]string{APIKeyAuth: r.Scopes})
+		}
+	}
+	op.Parameters = b.params(r)
+	if r.Body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{contentJSON: {Schema: b.SchemaOf(r.Body)}},
+		}
+	}
+	for _, reply := range r.Replies {
+		resp := &Response{Description: reply.Description}
+		if resp.Description == "" {
+			resp.Description = http.StatusText(reply.Status)
+		}
+		schema := reply.Schema
+		if schema == nil && reply.Body != nil {
+			schema = b.SchemaOf(reply.Body)
+		}
+		if schema != nil {
+			resp.Content = map[string]*MediaType{contentJSON: {Schema: schema}}
+		}
+		op.Responses[strconv.Itoa(reply.Status)] = resp
+	}
+	(*item)[strings.ToLower(r.Method)] = op
+}
+
+// params lists the declared parameters, plus the path ones nobody declared
+func (b *Builder) params(r *Route) []*Parameter {
+	result := make([]*Parameter, 0, len(r.Params))
+	declared := make(map[string]bool)
+	for _, p := range r.Params {
+		declared[p.Name] = true
+		result = append(result, &Parameter{
+			Name:        p.Name,
+			In:          p.In,
+			Description: p.Description,
+			Required:    p.Required || p.In == "path",
+			Schema:      p.Schema,
+		})
+	}
+	for _, seg := range strings.Split(r.Path, "/") {
+		if strings.HasPrefix(seg, ":") && !declared[seg[1:]] {
+			result = append(result, &Parameter{Name: seg[1:], In: "path", Required: true, Schema: String()})
+		}
+	}
+	return result
+}
+
+// Document returns the built document
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+// SchemaOf returns the schema of the value's type.
+// Named structs are registered as components and referenced.
+func (b *Builder) SchemaOf(v interface{}) *Schema {
+	return b.schemaOfType(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *Builder) schemaOfType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.String:
+		return String()
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return Integer()
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		return UnsignedInteger()
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{Type: "array", Items: b.schemaOfType(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOfType(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		return b.structSchema(t)
+	}
+	// Anything else, like interface{}, can be any JSON value
+	return &Schema{}
+}
+
+func (b *Builder) structSchema(t reflect.Type) *Schema {
+	name := b.componentName(t)
+	if name != "" {
+		if _, ok := b.doc.Components.Schemas[name]; ok {
+			return &Schema{Ref: schemaRef + name}
+		}
+		// Reserve the name first, in case the struct refers to itself
+		b.doc.Components.Schemas[name] = &Schema{}
+		b.types[name] = t
+	}
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fieldName := jsonName(f)
+		if fieldName == "-" {
+			continue
+		}
+		s.Properties[fieldName] = b.schemaOfType(f.Type)
+		// Same tag as gin's binding validation
+		if strings.Contains(f.Tag.Get("binding"), "required") {
+			s.Required = append(s.Required, fieldName)
+		}
+	}
+	sort.Strings(s.Required)
+	if name == "" {
+		return s
+	}
+	b.doc.Components.Schemas[name] = s
+	return &Schema{Ref: schemaRef + name}
+}
+
+// componentName names the struct's schema, prefixing the package name
+// when another type has already taken the plain name
+func (b *Builder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		return ""
+	}
+	if other, ok := b.types[name]; ok && other != t {
+		pkg := t.PkgPath()
+		pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+		return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	return name
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// ToOpenAPIPath converts a gin path like /books/:id into /books/{id}
+func ToOpenAPIPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			segs[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// Missing returns the routes of the router that the document does not describe
+func (d *Document) Missing(routes gin.RoutesInfo) []string {
+	missing := make([]string, 0)
+	for _, r := range routes {
+		if d.Operation(r.Method, r.Path) == nil {
+			missing = append(missing, fmt.Sprintf("%s %s", r.Method, r.Path))
+		}
+	}
+	return missing
+}
+
+// Operation returns the operation of a gin route, or nil if there is none
+func (d *Document) Operation(method, path string) *Operation {
+	item, ok := d.Paths[ToOpenAPIPath(path)]
+	if !ok {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+// String returns a string schema
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+// Integer returns an integer schema
+func Integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+// UnsignedInteger returns an integer schema with a minimum of zero
+func UnsignedInteger() *Schema {
+	zero := 0.0
+	return &Schema{Type: "integer", Minimum: &zero}
+}
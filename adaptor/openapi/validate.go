@@ -0,0 +1,254 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	inPath  = "path"
+	inQuery = "query"
+)
+
+// Load reads a document from a JSON or YAML file
+func Load(filename string) (*Document, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so go through a generic value to support both
+	var raw interface{}
+	if err := yaml.Unmarshal(buf, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %v", filename, err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert file %s: %v", filename, err)
+	}
+	d := &Document{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("failed to load file %s: %v", filename, err)
+	}
+	return d, nil
+}
+
+// ValidateParams checks the path and query parameters against the operation.
+// Path values are keyed by name; query values are taken as they come in the URL.
+func (d *Document) ValidateParams(op *Operation, path map[string]string, query map[string][]string) []string {
+	problems := make([]string, 0)
+	for _, p := range op.Parameters {
+		var (
+			value string
+			ok    bool
+		)
+		switch p.In {
+		case inPath:
+			value, ok = path[p.Name]
+		case inQuery:
+			var values []string
+			values, ok = query[p.Name]
+			if ok && len(values) > 0 {
+				value = values[0]
+			}
+		default:
+			continue
+		}
+		if !ok {
+			if p.Required {
+				problems = append(problems, fmt.Sprintf("%s parameter %q is required", p.In, p.Name))
+			}
+			continue
+		}
+		v, err := parseParam(d.resolve(p.Schema), value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s parameter %q: %v", p.In, p.Name, err))
+			continue
+		}
+		problems = append(problems, d.Validate(p.Schema, v, fmt.Sprintf("%s parameter %q", p.In, p.Name))...)
+	}
+	return problems
+}
+
+// ValidateBody checks a JSON body against the schema
+func (d *Document) ValidateBody(s *Schema, body []byte) []string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []string{fmt.Sprintf("body is not valid JSON: %v", err)}
+	}
+	return d.Validate(s, v, "body")
+}
+
+// Validate checks a decoded JSON value against the schema and returns the problems found
+func (d *Document) Validate(s *Schema, v interface{}, at string) []string {
+	s = d.resolve(s)
+	if s == nil {
+		return nil
+	}
+	if len(s.OneOf) > 0 {
+		return d.validateOneOf(s, v, at)
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		return []string{fmt.Sprintf("%s: value %v is not one of %v", at, v, s.Enum)}
+	}
+	switch s.Type {
+	case "":
+		return nil
+	case "object":
+		return d.validateObject(s, v, at)
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return []string{typeProblem(at, s.Type, v)}
+		}
+		problems := make([]string, 0)
+		for i, item := range items {
+			problems = append(problems, d.Validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+		return problems
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{typeProblem(at, s.Type, v)}
+		}
+		return validateString(s, str, at)
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok || (s.Type == "integer" && n != math.Trunc(n)) {
+			return []string{typeProblem(at, s.Type, v)}
+		}
+		return validateNumber(s, n, at)
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{typeProblem(at, s.Type, v)}
+		}
+	}
+	return nil
+}
+
+func (d *Document) validateObject(s *Schema, v interface{}, at string) []string {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return []string{typeProblem(at, s.Type, v)}
+	}
+	problems := make([]string, 0)
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: property %q is required", at, name))
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if prop, ok := s.Properties[name]; ok {
+			problems = append(problems, d.Validate(prop, obj[name], at+"."+name)...)
+		} else if s.AdditionalProperties != nil {
+			problems = append(problems, d.Validate(s.AdditionalProperties, obj[name], at+"."+name)...)
+		}
+	}
+	return problems
+}
+
+func (d *Document) validateOneOf(s *Schema, v interface{}, at string) []string {
+	matched := 0
+	for _, sub := range s.OneOf {
+		if len(d.Validate(sub, v, at)) == 0 {
+			matched++
+		}
+	}
+	if matched != 1 {
+		return []string{fmt.Sprintf("%s: value matches %d schemas of oneOf, want exactly 1", at, matched)}
+	}
+	return nil
+}
+
+// resolve follows local references
+func (d *Document) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		if d.Components == nil {
+			return nil
+		}
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, schemaRef)]
+	}
+	return s
+}
+
+func validateString(s *Schema, str, at string) []string {
+	if s.MinLength != nil && len(str) < *s.MinLength {
+		return []string{fmt.Sprintf("%s: length is less than %d", at, *s.MinLength)}
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return []string{fmt.Sprintf("%s: %q is not a date-time", at, str)}
+		}
+	}
+	return nil
+}
+
+func validateNumber(s *Schema, n float64, at string) []string {
+	if s.Minimum != nil && n < *s.Minimum {
+		return []string{fmt.Sprintf("%s: %v is less than %v", at, n, *s.Minimum)}
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		return []string{fmt.Sprintf("%s: %v is greater than %v", at, n, *s.Maximum)}
+	}
+	return nil
+}
+
+// parseParam turns a raw parameter into the JSON value its schema expects
+func parseParam(s *Schema, value string) (interface{}, error) {
+	if s == nil {
+		return value, nil
+	}
+	switch s.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeProblem(at, want string, v interface{}) string {
+	got := "null"
+	switch v.(type) {
+	case map[string]interface{}:
+		got = "object"
+	case []interface{}:
+		got = "array"
+	case string:
+		got = "string"
+	case float64:
+		got = "number"
+	case bool:
+		got = "boolean"
+	}
+	return fmt.Sprintf("%s: expected %s, got %s", at, want, got)
+}
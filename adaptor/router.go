@@ -4,19 +4,29 @@ Package adaptor adapts to all kinds of framework or protocols.
 package adaptor
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"literank.com/rest-books/adaptor/gql"
+	"literank.com/rest-books/adaptor/openapi"
 	"literank.com/rest-books/application"
 	"literank.com/rest-books/application/dto"
 	"literank.com/rest-books/application/executor"
 	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/config"
+	"literank.com/rest-books/infrastructure/logging"
+	"literank.com/rest-books/infrastructure/metrics"
+	"literank.com/rest-books/infrastructure/ratelimit"
 )
 
 const (
 	fieldID     = "id"
+	fieldRev    = "rev"
 	fieldOffset = "o"
 	fieldQuery  = "q"
 )
@@ -26,21 +36,88 @@ type RestHandler struct {
 	bookOperator   *executor.BookOperator
 	reviewOperator *executor.ReviewOperator
 	userOperator   *executor.UserOperator
+	healthOperator *executor.HealthOperator
+	audit          *executor.Audit
+	rateLimiter    *ratelimit.Limiter
+	bookHub        *BookHub
+	configStatus   func() *dto.ConfigStatus
+	logger         *slog.Logger
+	metrics        *metrics.Metrics
 }
 
 func newRestHandler(wireHelper *application.WireHelper) *RestHandler {
+	bookHub := NewBookHub(wireHelper.Logger())
+	wireHelper.BookOperator().AddListener(bookHub.BookChanged)
 	return &RestHandler{
-		bookOperator:   executor.NewBookOperator(wireHelper.BookManager(), wireHelper.CacheHelper()),
-		reviewOperator: executor.NewReviewOperator(wireHelper.ReviewManager()),
-		userOperator:   executor.NewUserOperator(wireHelper.UserManager(), wireHelper.PermManager()),
+		bookOperator:   wireHelper.BookOperator(),
+		reviewOperator: wireHelper.ReviewOperator(),
+		userOperator:   wireHelper.UserOperator(),
+		healthOperator: wireHelper.HealthOperator(),
+		audit:          wireHelper.Audit(),
+		rateLimiter:    wireHelper.RateLimiter(),
+		bookHub:        bookHub,
+		configStatus:   wireHelper.ConfigStatus,
+		logger:         wireHelper.Logger(),
+		metrics:        wireHelper.Metrics(),
 	}
 }
 
+// MakeServer makes the HTTP server of the main router
+func MakeServer(wireHelper *application.WireHelper) (*http.Server, error) {
+	rest := newRestHandler(wireHelper)
+	r, err := makeRouter(wireHelper, rest)
+	if err != nil {
+		return nil, err
+	}
+	c := wireHelper.Config().App
+	s := &http.Server{
+		Addr:         fmt.Sprintf(":%d", c.Port),
+		Handler:      r,
+		ReadTimeout:  time.Second * time.Duration(c.ReadTimeout),
+		WriteTimeout: time.Second * time.Duration(c.WriteTimeout),
+		IdleTimeout:  time.Second * time.Duration(c.IdleTimeout),
+	}
+	s.RegisterOnShutdown(rest.bookHub.Close)
+	return s, nil
+}
+
 // MakeRouter makes the main router
 func MakeRouter(wireHelper *application.WireHelper) (*gin.Engine, error) {
-	rest := newRestHandler(wireHelper)
+	return makeRouter(wireHelper, newRestHandler(wireHelper))
+}
+
+func makeRouter(wireHelper *application.WireHelper, rest *RestHandler) (*gin.Engine, error) {
+	graphqlHandler, err := gql.MakeHandler(wireHelper)
+	if err != nil {
+		return nil, err
+	}
+	c := wireHelper.Config().App
+	return newRouter(&c, rest, graphqlHandler)
+}
+
+// newRouter registers all routes of the handlers, and checks that the OpenAPI document describes every one
+func newRouter(c *config.ApplicationConfig, rest *RestHandler, graphqlHandler gin.HandlerFunc) (*gin.Engine, error) {
 	// Create a new Gin router
-	r := gin.Default()
+	r := gin.New()
+	// Let handlers pass the gin context down, with the request context values in it
+	r.ContextWithFallback = true
+	// Rate limits and lockouts count callers by IP, so forwarded headers are only believed from known proxies
+	if err := r.SetTrustedProxies(c.ProxyList()); err != nil {
+		return nil, err
+	}
+	r.Use(Tracing(), RequestID(), AuditActor(), AccessLog(rest.logger), Metrics(rest.metrics), Recovery(rest.logger))
+
+	spec := makeSpec()
+	if c.OpenAPIValidation {
+		contract := spec
+		if c.OpenAPIFile != "" {
+			var err error
+			if contract, err = openapi.Load(c.OpenAPIFile); err != nil {
+				return nil, err
+			}
+		}
+		r.Use(ContractCheck(contract, c.MaxBodyBytes, gin.IsDebugging(), rest.logger))
+	}
 
 	// Define a health endpoint handler
 	r.GET("/", func(c *gin.Context) {
@@ -49,23 +126,260 @@ func MakeRouter(wireHelper *application.WireHelper) (*gin.Engine, error) {
 			"status": "ok",
 		})
 	})
+	r.GET("/healthz", rest.liveness)
+	r.GET("/readyz", rest.readiness)
 	r.GET("/books", rest.getBooks)
 	r.GET("/books/:id", rest.getBook)
-	r.POST("/books", rest.PermCheck(model.PermAuthor), rest.createBook)
-	r.PUT("/books/:id", rest.PermCheck(model.PermAuthor), rest.updateBook)
-	r.DELETE("/books/:id", rest.PermCheck(model.PermAuthor), rest.deleteBook)
+	r.POST("/books", rest.PermCheck(model.PermAuthor, model.ScopeBooksWrite), rest.createBook)
+	r.PUT("/books/:id", rest.PermCheck(model.PermAuthor, model.ScopeBooksWrite), rest.updateBook)
+	r.DELETE("/books/:id", rest.PermCheck(model.PermAuthor, model.ScopeBooksWrite), rest.deleteBook)
 	r.GET("/books/:id/reviews", rest.getReviewsOfBook)
+	r.GET("/books/:id/revisions", rest.getBookRevisions)
+	r.GET("/books/:id/revisions/:rev", rest.getBookRevision)
+	r.GET("/books/:id/revisions/:rev/diff", rest.diffBookRevisions)
+	r.POST("/books/:id/revisions/:rev/revert", rest.PermCheck(model.PermAuthor, model.ScopeBooksWrite),
+		rest.revertBook)
 	r.GET("/reviews/:id", rest.getReview)
-	r.POST("/reviews", rest.createReview)
-	r.PUT("/reviews/:id", rest.updateReview)
-	r.DELETE("/reviews/:id", rest.deleteReview)
+	limitReviews := rest.RateLimit(ratelimit.GroupReviews)
+	r.POST("/reviews", limitReviews, rest.PermCheck(model.PermUser, model.ScopeReviewsWrite),
+		rest.createReview)
+	r.PUT("/reviews/:id", limitReviews, rest.PermCheck(model.PermUser, model.ScopeReviewsWrite), rest.updateReview)
+	r.DELETE("/reviews/:id", limitReviews, rest.PermCheck(model.PermUser, model.ScopeReviewsWrite),
+		rest.deleteReview)
+	r.GET("/ws/books", rest.bookSocket)
+
+	limitGraphQL := rest.RateLimit(ratelimit.GroupGraphQL)
+	r.GET("/graphql", limitGraphQL, graphqlHandler)
+	r.POST("/graphql", limitGraphQL, graphqlHandler)
+
+	r.GET("/admin/config", rest.PermCheck(model.PermAdmin), rest.getConfig)
+	r.POST("/admin/unlock", rest.PermCheck(model.PermAdmin), rest.unlock)
+	r.DELETE("/admin/users/:id/mfa", rest.PermCheck(model.PermAdmin), rest.resetMFA)
+	r.DELETE("/admin/users/:id/api-keys", rest.PermCheck(model.PermAdmin), rest.revokeUserAPIKeys)
+	r.POST("/admin/users/:id/erasure", rest.PermCheck(model.PermAdmin), rest.eraseUser)
+	r.GET("/admin/audit", rest.PermCheck(model.PermAdmin), rest.listAudit)
+	r.GET("/admin/audit/verify", rest.PermCheck(model.PermAdmin), rest.verifyAudit)
 
-	userGroup := r.Group("/users")
+	userGroup := r.Group("/users", rest.RateLimit(ratelimit.GroupAuth))
 	userGroup.POST("", rest.userSignUp)
 	userGroup.POST("/sign-in", rest.userSignIn)
+	userGroup.POST("/sign-in/mfa", rest.userSignInMFA)
+	userGroup.POST("/mfa/totp", rest.PermCheck(model.PermUser), rest.enrollTOTP)
+	userGroup.POST("/mfa/totp/confirm", rest.PermCheck(model.PermUser), rest.confirmTOTP)
+	userGroup.POST("/mfa/disable", rest.PermCheck(model.PermUser), rest.disableMFA)
+	userGroup.POST("/mfa/recovery-codes", rest.PermCheck(model.PermUser), rest.regenerateRecoveryCodes)
+	userGroup.POST("/api-keys", rest.PermCheck(model.PermUser), rest.createAPIKey)
+	userGroup.GET("/api-keys", rest.PermCheck(model.PermUser), rest.listAPIKeys)
+	userGroup.DELETE("/api-keys/:id", rest.PermCheck(model.PermUser), rest.revokeAPIKey)
+	userGroup.POST("/verify-email", rest.PermCheck(model.PermUser), rest.requestEmailVerification)
+	userGroup.POST("/verify-email/confirm", rest.verifyEmail)
+	userGroup.POST("/password-reset", rest.requestPasswordReset)
+	userGroup.POST("/password-reset/confirm", rest.resetPassword)
+	userGroup.GET("/me", rest.PermCheck(model.PermUser), rest.getProfile)
+	userGroup.PATCH("/me", rest.PermCheck(model.PermUser), rest.updateProfile)
+	userGroup.DELETE("/me", rest.PermCheck(model.PermUser), rest.deleteAccount)
+	userGroup.POST("/me/password", rest.PermCheck(model.PermUser), rest.changePassword)
+	userGroup.POST("/me/email", rest.PermCheck(model.PermUser), rest.requestEmailChange)
+	userGroup.GET("/me/export", rest.PermCheck(model.PermUser), rest.exportData)
+	userGroup.POST("/email-change/confirm", rest.confirmEmailChange)
+
+	ssoGroup := r.Group("/auth/oidc", rest.RateLimit(ratelimit.GroupAuth))
+	ssoGroup.GET("/login", rest.startSSO)
+	ssoGroup.GET("/callback", rest.ssoCallback)
+
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	})
+	r.GET("/docs", serveDocs)
+	r.GET("/metrics", gin.WrapH(rest.metrics.Handler()))
+	if err := checkSpec(r, spec); err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
+// Tell that the process is alive
+func (r *RestHandler) liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Tell if the app can serve traffic, with the status of every dependency
+func (r *RestHandler) readiness(c *gin.Context) {
+	result := r.healthOperator.Readiness(c)
+	status := http.StatusOK
+	if result.Status == executor.StatusUnready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, result)
+}
+
+// Get the active config and the result of its last reload
+func (r *RestHandler) getConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, r.configStatus())
+}
+
+// Lift the sign-in lockouts of an account or an IP
+func (r *RestHandler) unlock(c *gin.Context) {
+	var body dto.Unlock
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.userOperator.Unlock(c, body.Email, body.IP); err != nil {
+		if errors.Is(err, model.ErrInvalidArgument) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		r.logger.ErrorContext(c, "Failed to unlock", logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Turn off two-factor authentication for a user who lost both the authenticator and the recovery codes
+func (r *RestHandler) resetMFA(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param(fieldID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := r.userOperator.ResetMFA(c, uint(id)); err != nil {
+		r.userError(c, err, "reset two-factor authentication")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Revoke all API keys of a user, like when they leak
+func (r *RestHandler) revokeUserAPIKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param(fieldID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := r.userOperator.RevokeUserAPIKeys(c, uint(id)); err != nil {
+		r.userError(c, err, "revoke the API keys")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Remove or pseudonymize all personal data of a user, and report what was done
+func (r *RestHandler) eraseUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param(fieldID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	admin, _ := identityFrom(c)
+	report, err := r.userOperator.EraseUser(c, admin.UserID, uint(id))
+	if err != nil {
+		r.userError(c, err, "erase the user")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// List the entries of the audit log, newest first
+func (r *RestHandler) listAudit(c *gin.Context) {
+	f, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries, err := r.audit.List(c, f)
+	if err != nil {
+		r.logger.ErrorContext(c, "Failed to list the audit log", logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list the audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// Check the hash chain of the audit log
+func (r *RestHandler) verifyAudit(c *gin.Context) {
+	anchor, err := auditAnchor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := r.audit.Verify(c, anchor)
+	if err != nil {
+		r.logger.ErrorContext(c, "Failed to verify the audit log", logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify the audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// auditAnchor reads the optional anchor of an audit log verification from the query string
+func auditAnchor(c *gin.Context) (*dto.AuditAnchor, error) {
+	head, entries := c.Query("expect_head"), c.Query("expect_entries")
+	if head == "" && entries == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(entries, 10, 64)
+	if err != nil || n <= 0 || head == "" {
+		return nil, errors.New("expect_head and expect_entries must be given together, from an earlier verification")
+	}
+	return &dto.AuditAnchor{Entries: n, HeadHash: head}, nil
+}
+
+// auditFilter reads the filter of an audit log query from the query string
+func auditFilter(c *gin.Context) (*model.AuditFilter, error) {
+	f := &model.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+	var err error
+	if f.ActorID, err = queryID(c, "actor_id"); err != nil {
+		return nil, err
+	}
+	if f.BeforeID, err = queryID(c, "before_id"); err != nil {
+		return nil, err
+	}
+	if f.Since, err = queryTime(c, "since"); err != nil {
+		return nil, err
+	}
+	if f.Until, err = queryTime(c, "until"); err != nil {
+		return nil, err
+	}
+	if v := c.Query("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return nil, errors.New("invalid limit")
+		}
+	}
+	return f, nil
+}
+
+// queryID reads an optional ID from the query string
+func queryID(c *gin.Context, name string) (uint, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return uint(id), nil
+}
+
+// queryTime reads an optional RFC 3339 time from the query string
+func queryTime(c *gin.Context, name string) (time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, expecting RFC 3339", name)
+	}
+	return t, nil
+}
+
 // Get all books
 func (r *RestHandler) getBooks(c *gin.Context) {
 	offset := 0
@@ -80,7 +394,7 @@ func (r *RestHandler) getBooks(c *gin.Context) {
 	}
 	books, err := r.bookOperator.GetBooks(c, offset, c.Query(fieldQuery))
 	if err != nil {
-		fmt.Printf("Failed to get books: %v\n", err)
+		r.logger.ErrorContext(c, "Failed to get books", logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to get books"})
 		return
 	}
@@ -96,7 +410,7 @@ func (r *RestHandler) getBook(c *gin.Context) {
 	}
 	book, err := r.bookOperator.GetBook(c, uint(id))
 	if err != nil {
-		fmt.Printf("Failed to get the book with %d: %v\n", id, err)
+		r.logger.ErrorContext(c, "Failed to get the book", "book_id", id, logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to get the book"})
 		return
 	}
@@ -113,7 +427,7 @@ func (r *RestHandler) createBook(c *gin.Context) {
 
 	book, err := r.bookOperator.CreateBook(c, &reqBody)
 	if err != nil {
-		fmt.Printf("Failed to create: %v\n", err)
+		r.logger.ErrorContext(c, "Failed to create book", logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to create"})
 		return
 	}
@@ -136,7 +450,7 @@ func (r *RestHandler) updateBook(c *gin.Context) {
 
 	book, err := r.bookOperator.UpdateBook(c, uint(id), &reqBody)
 	if err != nil {
-		fmt.Printf("Failed to update: %v\n", err)
+		r.logger.ErrorContext(c, "Failed to update book", "book_id", id, logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to update"})
 		return
 	}
@@ -152,13 +466,97 @@ func (r *RestHandler) deleteBook(c *gin.Context) {
 	}
 
 	if err := r.bookOperator.DeleteBook(c, uint(id)); err != nil {
-		fmt.Printf("Failed to delete: %v\n", err)
+		r.logger.ErrorContext(c, "Failed to delete book", "book_id", id, logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to delete"})
 		return
 	}
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// Get the revisions of a book, the latest first
+func (r *RestHandler) getBookRevisions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param(fieldID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	offset := 0
+	if v := c.Query(fieldOffset); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+	}
+	revisions, err := r.bookOperator.GetBookRevisions(c, uint(id), offset)
+	if err != nil {
+		r.userError(c, err, "get the revisions")
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// Get a revision of a book
+func (r *RestHandler) getBookRevision(c *gin.Context) {
+	id, rev, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+	revision, err := r.bookOperator.GetBookRevision(c, id, rev)
+	if err != nil {
+		r.userError(c, err, "get the revision")
+		return
+	}
+	c.JSON(http.StatusOK, revision)
+}
+
+// Show the fields a revision changed, from the revision before it or the one given
+func (r *RestHandler) diffBookRevisions(c *gin.Context) {
+	id, rev, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+	from, err := queryID(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	diff, err := r.bookOperator.DiffRevisions(c, id, rev, from)
+	if err != nil {
+		r.userError(c, err, "diff the revisions")
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// Restore a book to an earlier revision, as a new revision
+func (r *RestHandler) revertBook(c *gin.Context) {
+	id, rev, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+	book, err := r.bookOperator.RevertBook(c, id, rev)
+	if err != nil {
+		r.userError(c, err, "revert the book")
+		return
+	}
+	c.JSON(http.StatusOK, book)
+}
+
+// revisionParams reads the book ID and revision number of the path, answering 400 if either is invalid
+func revisionParams(c *gin.Context) (uint, uint, bool) {
+	id, err := strconv.ParseUint(c.Param(fieldID), 10, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, 0, false
+	}
+	rev, err := strconv.ParseUint(c.Param(fieldRev), 10, 0)
+	if err != nil || rev == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return 0, 0, false
+	}
+	return uint(id), uint(rev), true
+}
+
 // Get all book reviews
 func (r *RestHandler) getReviewsOfBook(c *gin.Context) {
 	bookID, err := strconv.Atoi(c.Param(fieldID))
@@ -168,7 +566,7 @@ func (r *RestHandler) getReviewsOfBook(c *gin.Context) {
 	}
 	books, err := r.reviewOperator.GetReviewsOfBook(c, uint(bookID), c.Query(fieldQuery))
 	if err != nil {
-		fmt.Printf("Failed to get reviews of book %d: %v\n", bookID, err)
+		r.logger.ErrorContext(c, "Failed to get reviews of book", "book_id", bookID, logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to get books"})
 		return
 	}
@@ -180,7 +578,7 @@ func (r *RestHandler) getReview(c *gin.Context) {
 	id := c.Param(fieldID)
 	review, err := r.reviewOperator.GetReview(c, id)
 	if err != nil {
-		fmt.Printf("Failed to get the review %s: %v\n", id, err)
+		r.logger.ErrorContext(c, "Failed to get the review", "review_id", id, logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to get the review"})
 		return
 	}
@@ -195,9 +593,17 @@ func (r *RestHandler) createReview(c *gin.Context) {
 		return
 	}
 
-	review, err := r.reviewOperator.CreateReview(c, &reviewBody)
-	if err != nil {
-		fmt.Printf("Failed to create: %v\n", err)
+	u, _ := identityFrom(c)
+	review, err := r.reviewOperator.CreateReview(c, u.UserID, &reviewBody)
+	switch {
+	case errors.Is(err, model.ErrInvalidArgument):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, model.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		r.logger.ErrorContext(c, "Failed to create review", logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to create the review"})
 		return
 	}
@@ -214,9 +620,14 @@ func (r *RestHandler) updateReview(c *gin.Context) {
 		return
 	}
 
-	book, err := r.reviewOperator.UpdateReview(c, id, &reqBody)
-	if err != nil {
-		fmt.Printf("Failed to update: %v\n", err)
+	u, _ := identityFrom(c)
+	book, err := r.reviewOperator.UpdateReview(c, u, id, &reqBody)
+	switch {
+	case errors.Is(err, model.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		r.logger.ErrorContext(c, "Failed to update review", "review_id", id, logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to update the review"})
 		return
 	}
@@ -227,8 +638,14 @@ func (r *RestHandler) updateReview(c *gin.Context) {
 func (r *RestHandler) deleteReview(c *gin.Context) {
 	id := c.Param(fieldID)
 
-	if err := r.reviewOperator.DeleteReview(c, id); err != nil {
-		fmt.Printf("Failed to delete: %v\n", err)
+	u, _ := identityFrom(c)
+	err := r.reviewOperator.DeleteReview(c, u, id)
+	switch {
+	case errors.Is(err, model.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		r.logger.ErrorContext(c, "Failed to delete review", "review_id", id, logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to delete the review"})
 		return
 	}
@@ -241,10 +658,13 @@ func (r *RestHandler) userSignUp(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if ucBody.Locale == "" {
+		ucBody.Locale = c.GetHeader("Accept-Language")
+	}
 
 	u, err := r.userOperator.CreateUser(c, &ucBody)
 	if err != nil {
-		fmt.Printf("Failed to create user: %v\n", err)
+		r.logger.ErrorContext(c, "Failed to create user", logging.KeyError, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "failed to sign up"})
 		return
 	}
@@ -257,10 +677,351 @@ func (r *RestHandler) userSignIn(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	u, err := r.userOperator.SignIn(c, m.Email, m.Password)
+	u, err := r.userOperator.SignIn(c, m.Email, m.Password, c.ClientIP())
+	switch {
+	case errors.Is(err, model.ErrInvalidArgument):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, model.ErrUnauthenticated):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, model.ErrTooManyRequests):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		r.logger.ErrorContext(c, "Failed to sign in", logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign in"})
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// Mail the signed-in user another link to verify the email
+func (r *RestHandler) requestEmailVerification(c *gin.Context) {
+	u, _ := identityFrom(c)
+	if err := r.userOperator.RequestEmailVerification(c, u.UserID); err != nil {
+		if errors.Is(err, model.ErrInvalidArgument) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		r.logger.ErrorContext(c, "Failed to send the verification mail", "user_id", u.UserID, logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send the mail"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Verify the email with the token of a verification mail
+func (r *RestHandler) verifyEmail(c *gin.Context) {
+	var body dto.EmailVerification
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.userOperator.VerifyEmail(c, body.Token); err != nil {
+		if errors.Is(err, model.ErrInvalidArgument) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		r.logger.ErrorContext(c, "Failed to verify email", logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify the email"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Mail a password reset link, answering alike whether the email is registered or not
+func (r *RestHandler) requestPasswordReset(c *gin.Context) {
+	var body dto.PasswordResetRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.userOperator.RequestPasswordReset(c, body.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// Set a new password with the token of a password reset mail
+func (r *RestHandler) resetPassword(c *gin.Context) {
+	var body dto.PasswordReset
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.userOperator.ResetPassword(c, body.Token, body.Password); err != nil {
+		if errors.Is(err, model.ErrInvalidArgument) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		r.logger.ErrorContext(c, "Failed to reset password", logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset the password"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Finish a sign-in with the second factor
+func (r *RestHandler) userSignInMFA(c *gin.Context) {
+	var body dto.MFAChallenge
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, err := r.userOperator.SignInMFA(c, body.ChallengeToken, body.Code, c.ClientIP())
+	if err != nil {
+		r.userError(c, err, "sign in")
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// Start the enrollment of an authenticator
+func (r *RestHandler) enrollTOTP(c *gin.Context) {
+	u, _ := identityFrom(c)
+	enrollment, err := r.userOperator.EnrollTOTP(c, u.UserID)
+	if err != nil {
+		r.userError(c, err, "enroll the authenticator")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Turn two-factor authentication on with a code of the enrolled authenticator
+func (r *RestHandler) confirmTOTP(c *gin.Context) {
+	var body dto.MFACode
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	codes, err := r.userOperator.ConfirmTOTP(c, u.UserID, body.Code, c.ClientIP())
+	if err != nil {
+		r.userError(c, err, "confirm the authenticator")
+		return
+	}
+	c.JSON(http.StatusOK, codes)
+}
+
+// Turn two-factor authentication off
+func (r *RestHandler) disableMFA(c *gin.Context) {
+	var body dto.MFACode
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	if err := r.userOperator.DisableMFA(c, u.UserID, body.Code, c.ClientIP()); err != nil {
+		r.userError(c, err, "disable two-factor authentication")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Replace the recovery codes
+func (r *RestHandler) regenerateRecoveryCodes(c *gin.Context) {
+	var body dto.MFACode
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	codes, err := r.userOperator.RegenerateRecoveryCodes(c, u.UserID, body.Code, c.ClientIP())
+	if err != nil {
+		r.userError(c, err, "regenerate the recovery codes")
+		return
+	}
+	c.JSON(http.StatusOK, codes)
+}
+
+// Create an API key, shown only this once
+func (r *RestHandler) createAPIKey(c *gin.Context) {
+	var body dto.APIKeyRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	key, err := r.userOperator.CreateAPIKey(c, u, &body)
+	if err != nil {
+		r.userError(c, err, "create the API key")
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+// List the API keys of the signed-in user
+func (r *RestHandler) listAPIKeys(c *gin.Context) {
+	u, _ := identityFrom(c)
+	keys, err := r.userOperator.ListAPIKeys(c, u.UserID)
+	if err != nil {
+		r.userError(c, err, "list the API keys")
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// Revoke an API key of the signed-in user
+func (r *RestHandler) revokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param(fieldID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	u, _ := identityFrom(c)
+	if err := r.userOperator.RevokeAPIKey(c, u.UserID, uint(id)); err != nil {
+		r.userError(c, err, "revoke the API key")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Get the profile of the signed-in user
+func (r *RestHandler) getProfile(c *gin.Context) {
+	u, _ := identityFrom(c)
+	profile, err := r.userOperator.GetProfile(c, u.UserID)
+	if err != nil {
+		r.userError(c, err, "get the profile")
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// Change the given fields of the profile
+func (r *RestHandler) updateProfile(c *gin.Context) {
+	var body dto.ProfileUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	profile, err := r.userOperator.UpdateProfile(c, u.UserID, &body)
+	if err != nil {
+		r.userError(c, err, "update the profile")
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// Change the password, proving the current one
+func (r *RestHandler) changePassword(c *gin.Context) {
+	var body dto.PasswordChange
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	err := r.userOperator.ChangePassword(c, u.UserID, body.CurrentPassword, body.NewPassword, c.ClientIP())
+	if err != nil {
+		r.userError(c, err, "change the password")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Mail the new email a link to confirm the change
+func (r *RestHandler) requestEmailChange(c *gin.Context) {
+	var body dto.EmailChange
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	if err := r.userOperator.RequestEmailChange(c, u.UserID, body.Email, body.Password, c.ClientIP()); err != nil {
+		r.userError(c, err, "change the email")
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// Confirm an email change with the token of the link mailed to the new email
+func (r *RestHandler) confirmEmailChange(c *gin.Context) {
+	var body dto.EmailVerification
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.userOperator.ConfirmEmailChange(c, body.Token); err != nil {
+		r.userError(c, err, "change the email")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Delete the account of the signed-in user, proving the password
+func (r *RestHandler) deleteAccount(c *gin.Context) {
+	var body dto.AccountDeletion
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ := identityFrom(c)
+	if err := r.userOperator.DeleteAccount(c, u.UserID, body.Password, c.ClientIP()); err != nil {
+		r.userError(c, err, "delete the account")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Download all personal data of the signed-in user as a JSON file
+func (r *RestHandler) exportData(c *gin.Context) {
+	u, _ := identityFrom(c)
+	export, err := r.userOperator.ExportData(c, u.UserID)
+	if err != nil {
+		r.userError(c, err, "export the personal data")
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="personal-data-%d.json"`, u.UserID))
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+// Send the user to sign in with the OpenID Connect provider
+func (r *RestHandler) startSSO(c *gin.Context) {
+	url, err := r.userOperator.StartSSO(c)
+	if err != nil {
+		r.userError(c, err, "start single sign-on")
+		return
+	}
+	c.Redirect(http.StatusFound, url)
+}
+
+// Finish a sign-in with the OpenID Connect provider
+func (r *RestHandler) ssoCallback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "single sign-on failed: " + reason})
+		return
+	}
+	u, err := r.userOperator.SignInSSO(c, c.Query("code"), c.Query("state"))
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+		r.userError(c, err, "sign in")
 		return
 	}
 	c.JSON(http.StatusOK, u)
 }
+
+// userError answers a failed account operation with the status of its domain error,
+// and logs the unexpected ones
+func (r *RestHandler) userError(c *gin.Context, err error, action string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, model.ErrInvalidArgument):
+		status = http.StatusBadRequest
+	case errors.Is(err, model.ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, model.ErrPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, model.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, model.ErrAlreadyExists):
+		status = http.StatusConflict
+	case errors.Is(err, model.ErrTooManyRequests):
+		status = http.StatusTooManyRequests
+	default:
+		r.logger.ErrorContext(c, "Failed to "+action, logging.KeyError, err)
+		c.JSON(status, gin.H{"error": "failed to " + action})
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,148 @@
+package adaptor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/config"
+	"literank.com/rest-books/infrastructure/metrics"
+	"literank.com/rest-books/infrastructure/ratelimit"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testHandler returns handlers without backends, enough for routes refused before reaching them
+func testHandler() *RestHandler {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &RestHandler{logger: logger, metrics: metrics.New(),
+		rateLimiter: ratelimit.NewLimiter(nil, &config.RateLimitConfig{}, logger)}
+}
+
+// testRouter builds the main router over the handlers
+func testRouter(t *testing.T, c *config.ApplicationConfig, rest *RestHandler) *gin.Engine {
+	t.Helper()
+	r, err := newRouter(c, rest, func(c *gin.Context) {})
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+	return r
+}
+
+func TestEveryRouteHasSpec(t *testing.T) {
+	r := testRouter(t, &config.ApplicationConfig{}, testHandler())
+	spec := makeSpec()
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+		if spec.Operation(route.Method, route.Path) == nil {
+			t.Errorf("%s %s has no spec entry in apiRoutes", route.Method, route.Path)
+		}
+	}
+	for _, route := range apiRoutes() {
+		if !registered[route.Method+" "+route.Path] {
+			t.Errorf("%s %s is in apiRoutes but not registered", route.Method, route.Path)
+		}
+	}
+}
+
+func TestCheckSpecRejectsMissingRoutes(t *testing.T) {
+	r := testRouter(t, &config.ApplicationConfig{}, testHandler())
+	r.GET("/undocumented", func(c *gin.Context) {})
+	if err := checkSpec(r, makeSpec()); err == nil {
+		t.Fatal("checkSpec passed a route without a spec entry")
+	}
+}
+
+func TestClientIPIgnoresSpoofedHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"no proxies trusted", "", "203.0.113.7:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"no proxies trusted, real IP header", "", "203.0.113.7:5000",
+			map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7"},
+		{"untrusted caller", "10.0.0.0/8", "203.0.113.7:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.0/8", "10.1.2.3:5000",
+			map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy, spoofed hops before it", "10.0.0.1", "10.0.0.1:5000",
+			map[string]string{"X-Forwarded-For": "192.0.2.66, 198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRouter(t, &config.ApplicationConfig{TrustedProxies: tt.proxies}, testHandler())
+			r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewChangesNeedToken(t *testing.T) {
+	r := testRouter(t, &config.ApplicationConfig{}, testHandler())
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		req := httptest.NewRequest(method, "/reviews/65f0c0ffee0000000000beef", strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without a token answered %d, want %d", method, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+// unknownKeys knows no API keys
+type unknownKeys struct {
+	gateway.APIKeyManager
+}
+
+func (unknownKeys) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	return nil, fmt.Errorf("%w: API key %s", model.ErrNotFound, prefix)
+}
+
+func TestRateLimitCountsMadeUpKeysByIP(t *testing.T) {
+	rest := testHandler()
+	keys := executor.NewAPIKeys(unknownKeys{}, nil, executor.APIKeyPolicy{}, rest.logger)
+	rest.userOperator = executor.NewUserOperator(nil, nil, nil, nil, nil, nil, keys, nil, rest.logger, rest.metrics)
+	// Redis is down, so the buckets are in memory
+	down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer down.Close()
+	rest.rateLimiter = ratelimit.NewLimiter(down, &config.RateLimitConfig{Enabled: true,
+		Policies: config.RateLimitPolicies{Reviews: config.RateLimitPolicy{Rate: 2, Period: 60, Key: "api_key"}}},
+		rest.logger)
+	r := testRouter(t, &config.ApplicationConfig{}, rest)
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/reviews", strings.NewReader(`{}`))
+		req.Header.Set(headerAPIKey, fmt.Sprintf("lrb_%012d_guess", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("request %d with a made-up key answered %d, want %d", i, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"literank.com/rest-books/adaptor/rpc/pb"
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/model"
+)
+
+type bookServer struct {
+	pb.UnimplementedBookServiceServer
+	bookOperator *executor.BookOperator
+	logger       *slog.Logger
+}
+
+// GetBook gets a book by ID
+func (s *bookServer) GetBook(ctx context.Context, req *pb.GetBookRequest) (*pb.Book, error) {
+	book, err := s.bookOperator.GetBook(ctx, uint(req.Id))
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return toPBBook(book), nil
+}
+
+// ListBooks gets a list of books by offset and keyword
+func (s *bookServer) ListBooks(ctx context.Context, req *pb.ListBooksRequest) (*pb.ListBooksResponse, error) {
+	books, err := s.bookOperator.GetBooks(ctx, int(req.Offset), req.Query)
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	resp := &pb.ListBooksResponse{Books: make([]*pb.Book, 0, len(books))}
+	for _, b := range books {
+		resp.Books = append(resp.Books, toPBBook(b))
+	}
+	return resp, nil
+}
+
+// CreateBook creates a new book
+func (s *bookServer) CreateBook(ctx context.Context, req *pb.CreateBookRequest) (*pb.Book, error) {
+	book, err := s.bookOperator.CreateBook(ctx, fromPBBook(req.Book))
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return toPBBook(book), nil
+}
+
+// UpdateBook updates a book by its ID and the new content
+func (s *bookServer) UpdateBook(ctx context.Context, req *pb.UpdateBookRequest) (*pb.Book, error) {
+	book, err := s.bookOperator.UpdateBook(ctx, uint(req.Id), fromPBBook(req.Book))
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return toPBBook(book), nil
+}
+
+// DeleteBook deletes a book by ID
+func (s *bookServer) DeleteBook(ctx context.Context, req *pb.DeleteBookRequest) (*emptypb.Empty, error) {
+	if err := s.bookOperator.DeleteBook(ctx, uint(req.Id)); err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func toPBBook(b *model.Book) *pb.Book {
+	return &pb.Book{
+		Id:          uint64(b.ID),
+		Title:       b.Title,
+		Author:      b.Author,
+		PublishedAt: b.PublishedAt,
+		Description: b.Description,
+		Isbn:        b.ISBN,
+		TotalPages:  int32(b.TotalPages),
+		CreatedAt:   timestamppb.New(b.CreatedAt),
+		UpdatedAt:   timestamppb.New(b.UpdatedAt),
+	}
+}
+
+func fromPBBook(b *pb.Book) *model.Book {
+	if b == nil {
+		return &model.Book{}
+	}
+	return &model.Book{
+		Title:       b.Title,
+		Author:      b.Author,
+		PublishedAt: b.PublishedAt,
+		Description: b.Description,
+		ISBN:        b.Isbn,
+		TotalPages:  int(b.TotalPages),
+	}
+}
@@ -0,0 +1,37 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{model.ErrNotFound, codes.NotFound},
+	{model.ErrAlreadyExists, codes.AlreadyExists},
+	{model.ErrInvalidArgument, codes.InvalidArgument},
+	{model.ErrUnauthenticated, codes.Unauthenticated},
+	{model.ErrPermissionDenied, codes.PermissionDenied},
+	{model.ErrTooManyRequests, codes.ResourceExhausted},
+}
+
+// statusError maps domain errors to gRPC status errors.
+// Other errors are logged and hidden from callers, which get an internal error only.
+func statusError(ctx context.Context, logger *slog.Logger, err error) error {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return status.Error(e.code, err.Error())
+		}
+	}
+	logger.ErrorContext(ctx, "Failed to serve gRPC call", logging.KeyError, err)
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"literank.com/rest-books/domain/model"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantMessage string
+		wantLogged  bool
+	}{
+		{"not found", fmt.Errorf("%w: book 7", model.ErrNotFound), codes.NotFound, "not found: book 7", false},
+		{"invalid argument", fmt.Errorf("%w: no title", model.ErrInvalidArgument), codes.InvalidArgument,
+			"invalid argument: no title", false},
+		{"rate limited", model.ErrTooManyRequests, codes.ResourceExhausted, model.ErrTooManyRequests.Error(), false},
+		{"backend failure", errors.New("dial tcp 10.0.0.5:3306: connection refused"), codes.Internal,
+			"internal error", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, nil))
+			s, ok := status.FromError(statusError(context.Background(), logger, tt.err))
+			if !ok {
+				t.Fatalf("statusError(%v) has no status", tt.err)
+			}
+			if s.Code() != tt.wantCode || s.Message() != tt.wantMessage {
+				t.Errorf("status = %v %q, want %v %q", s.Code(), s.Message(), tt.wantCode, tt.wantMessage)
+			}
+			if logged := strings.Contains(logs.String(), tt.err.Error()); logged != tt.wantLogged {
+				t.Errorf("error logged = %v, want %v", logged, tt.wantLogged)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"literank.com/rest-books/adaptor/rpc/pb"
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/model"
+)
+
+type reviewServer struct {
+	pb.UnimplementedReviewServiceServer
+	reviewOperator *executor.ReviewOperator
+	logger         *slog.Logger
+}
+
+// GetReview gets a review by ID
+func (s *reviewServer) GetReview(ctx context.Context, req *pb.GetReviewRequest) (*pb.Review, error) {
+	review, err := s.reviewOperator.GetReview(ctx, req.Id)
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return toPBReview(review), nil
+}
+
+// ListReviewsOfBook gets a list of reviews of a book by a keyword
+func (s *reviewServer) ListReviewsOfBook(ctx context.Context,
+	req *pb.ListReviewsOfBookRequest) (*pb.ListReviewsOfBookResponse, error) {
+	reviews, err := s.reviewOperator.GetReviewsOfBook(ctx, uint(req.BookId), req.Query)
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	resp := &pb.ListReviewsOfBookResponse{Reviews: make([]*pb.Review, 0, len(reviews))}
+	for _, r := range reviews {
+		resp.Reviews = append(resp.Reviews, toPBReview(r))
+	}
+	return resp, nil
+}
+
+// CreateReview creates a new review
+func (s *reviewServer) CreateReview(ctx context.Context, req *pb.CreateReviewRequest) (*pb.Review, error) {
+	u, _ := IdentityFrom(ctx)
+	review, err := s.reviewOperator.CreateReview(ctx, u.UserID, &dto.ReviewBody{
+		BookID:  uint(req.BookId),
+		Author:  req.Author,
+		Title:   req.Title,
+		Content: req.Content,
+	})
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return toPBReview(review), nil
+}
+
+// UpdateReview updates a review by its ID and the new content
+func (s *reviewServer) UpdateReview(ctx context.Context, req *pb.UpdateReviewRequest) (*pb.Review, error) {
+	u, _ := IdentityFrom(ctx)
+	review, err := s.reviewOperator.UpdateReview(ctx, u, req.Id, &model.Review{
+		Title:   req.Title,
+		Content: req.Content,
+	})
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	review.ID = req.Id
+	return toPBReview(review), nil
+}
+
+// DeleteReview deletes a review by ID
+func (s *reviewServer) DeleteReview(ctx context.Context, req *pb.DeleteReviewRequest) (*emptypb.Empty, error) {
+	u, _ := IdentityFrom(ctx)
+	if err := s.reviewOperator.DeleteReview(ctx, u, req.Id); err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func toPBReview(r *model.Review) *pb.Review {
+	return &pb.Review{
+		Id:        r.ID,
+		BookId:    uint64(r.BookID),
+		Author:    r.Author,
+		Title:     r.Title,
+		Content:   r.Content,
+		CreatedAt: timestamppb.New(r.CreatedAt),
+		UpdatedAt: timestamppb.New(r.UpdatedAt),
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Package rpc serves the gRPC API with the same operators as the REST adaptor.
+*/
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"literank.com/rest-books/adaptor/rpc/pb"
+	"literank.com/rest-books/application"
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/logging"
+	"literank.com/rest-books/infrastructure/metrics"
+	"literank.com/rest-books/infrastructure/ratelimit"
+)
+
+const (
+	authHeader       = "authorization"
+	apiKeyHeader     = "x-api-key"
+	requestIDHeader  = "x-request-id"
+	retryAfterHeader = "retry-after"
+	tokenPrefix      = "Bearer "
+)
+
+// methodPerms lists the methods that need a token, with their least permission
+var methodPerms = map[string]model.UserPermission{
+	pb.BookService_CreateBook_FullMethodName: model.PermAuthor,
+	pb.BookService_UpdateBook_FullMethodName: model.PermAuthor,
+	pb.BookService_DeleteBook_FullMethodName: model.PermAuthor,
+
+	pb.ReviewService_CreateReview_FullMethodName: model.PermUser,
+	pb.ReviewService_UpdateReview_FullMethodName: model.PermUser,
+	pb.ReviewService_DeleteReview_FullMethodName: model.PermUser,
+}
+
+// methodGroups lists the rate limited methods, with the same groups as their REST routes
+var methodGroups = map[string]ratelimit.Group{
+	pb.UserService_SignUp_FullMethodName:         ratelimit.GroupAuth,
+	pb.UserService_SignIn_FullMethodName:         ratelimit.GroupAuth,
+	pb.ReviewService_CreateReview_FullMethodName: ratelimit.GroupReviews,
+	pb.ReviewService_UpdateReview_FullMethodName: ratelimit.GroupReviews,
+	pb.ReviewService_DeleteReview_FullMethodName: ratelimit.GroupReviews,
+}
+
+type identityKey struct{}
+
+// MakeServer makes the gRPC server
+func MakeServer(wireHelper *application.WireHelper) *grpc.Server {
+	logger := wireHelper.Logger()
+	s := grpc.NewServer(
+		// Calls join the traces of their callers, with the tracer provider and propagator of the app
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			logInterceptor(logger),
+			rateLimitInterceptor(wireHelper.RateLimiter(), wireHelper.UserOperator(), wireHelper.Metrics()),
+			authInterceptor(wireHelper.UserOperator()),
+		),
+	)
+	pb.RegisterBookServiceServer(s, &bookServer{bookOperator: wireHelper.BookOperator(), logger: logger})
+	pb.RegisterReviewServiceServer(s, &reviewServer{reviewOperator: wireHelper.ReviewOperator(), logger: logger})
+	pb.RegisterUserServiceServer(s, &userServer{userOperator: wireHelper.UserOperator(), logger: logger})
+	reflection.Register(s)
+	return s
+}
+
+// IdentityFrom returns the authenticated user of the call, if any
+func IdentityFrom(ctx context.Context) (*model.UserIdentity, bool) {
+	u, ok := ctx.Value(identityKey{}).(*model.UserIdentity)
+	return u, ok
+}
+
+// logInterceptor puts the caller's request ID, or a new one, into the context and logs every call.
+// Errors without a status are logged and hidden from the caller.
+func logInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		id := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(requestIDHeader); len(values) > 0 {
+				id = values[0]
+			}
+		}
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		ctx = logging.WithRequestID(ctx, id)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if _, ok := status.FromError(err); !ok {
+			logger.ErrorContext(ctx, "Failed to serve gRPC call", "method", info.FullMethod, logging.KeyError, err)
+			err = status.Error(codes.Internal, "internal error")
+		}
+		logger.InfoContext(ctx, "gRPC call served", "method", info.FullMethod,
+			"code", status.Code(err).String(), "elapsed", time.Since(start))
+		return resp, err
+	}
+}
+
+// authInterceptor checks the bearer token in the call metadata, the same way PermCheck does for REST
+func authInterceptor(userOperator *executor.UserOperator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		perm, ok := methodPerms[info.FullMethod]
+		if !ok {
+			return handler(executor.WithActor(ctx, &executor.Actor{IP: clientIP(ctx)}), req)
+		}
+		token := bearerToken(ctx)
+		if token == "" {
+			return nil, status.Error(codes.Unauthenticated, "token is required")
+		}
+		user, err := userOperator.Authenticate(ctx, token)
+		if errors.Is(err, model.ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.Permission < perm {
+			return nil, status.Error(codes.PermissionDenied, "Unauthorized")
+		}
+		ctx = executor.WithActor(ctx, &executor.Actor{UserID: user.UserID, IP: clientIP(ctx)})
+		return handler(context.WithValue(ctx, identityKey{}, user), req)
+	}
+}
+
+// rateLimitInterceptor limits the calls of the rate limited methods, the same way RateLimit does for REST.
+// Rejected calls fail with ResourceExhausted and a retry-after header.
+func rateLimitInterceptor(limiter *ratelimit.Limiter, userOperator *executor.UserOperator,
+	m *metrics.Metrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		g, ok := methodGroups[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		kind := limiter.Policy(g).Key
+		var apiKeyID, userID uint
+		if kind != ratelimit.KeyIP {
+			if token := bearerToken(ctx); token != "" {
+				if u, err := userOperator.ParseToken(token); err == nil {
+					userID = u.UserID
+				}
+			} else if key := firstValue(ctx, apiKeyHeader); key != "" {
+				if u, err := userOperator.AuthenticateAPIKey(ctx, key); err == nil {
+					apiKeyID, userID = u.APIKeyID, u.UserID
+				}
+			}
+		}
+		result := limiter.Allow(ctx, g, ratelimit.Key(kind, clientIP(ctx), apiKeyID, userID))
+		if !result.Allowed {
+			m.CountRateLimited(string(g))
+			retryAfter := strconv.FormatInt(int64((result.RetryAfter+time.Second-1)/time.Second), 10)
+			_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterHeader, retryAfter))
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// clientIP returns the IP of the caller's connection
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// firstValue returns the first value of the metadata key, if any
+func firstValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func bearerToken(ctx context.Context) string {
+	return strings.Replace(firstValue(ctx, authHeader), tokenPrefix, "", 1)
+}
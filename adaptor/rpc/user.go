@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"literank.com/rest-books/adaptor/rpc/pb"
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/application/executor"
+)
+
+type userServer struct {
+	pb.UnimplementedUserServiceServer
+	userOperator *executor.UserOperator
+	logger       *slog.Logger
+}
+
+// SignUp creates a new user
+func (s *userServer) SignUp(ctx context.Context, req *pb.UserCredential) (*pb.User, error) {
+	u, err := s.userOperator.CreateUser(ctx, &dto.UserCredential{Email: req.Email, Password: req.Password})
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	return &pb.User{Id: uint64(u.ID), Email: u.Email}, nil
+}
+
+// SignIn signs an user in
+func (s *userServer) SignIn(ctx context.Context, req *pb.UserCredential) (*pb.SignInResponse, error) {
+	ut, err := s.userOperator.SignIn(ctx, req.Email, req.Password, clientIP(ctx))
+	if err != nil {
+		return nil, statusError(ctx, s.logger, err)
+	}
+	if ut.MFARequired {
+		// The gRPC API has no second step yet
+		return nil, status.Error(codes.FailedPrecondition,
+			"two-factor authentication is on, sign in over REST or GraphQL")
+	}
+	return &pb.SignInResponse{
+		User:  &pb.User{Id: uint64(ut.User.ID), Email: ut.User.Email},
+		Token: ut.Token,
+	}, nil
+}
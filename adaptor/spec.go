@@ -0,0 +1,384 @@
+package adaptor
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"literank.com/rest-books/adaptor/openapi"
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/domain/model"
+)
+
+const (
+	apiTitle   = "LiteRank Books API"
+	apiVersion = "1.0.0"
+
+	tagHealth  = "health"
+	tagBooks   = "books"
+	tagReviews = "reviews"
+	tagUsers   = "users"
+	tagDocs    = "docs"
+	tagAdmin   = "admin"
+)
+
+//go:embed static/docs.html
+var docsPage []byte
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// HealthResponse is the body of the health endpoint
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// GraphQLRequest is the body of a GraphQL request
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse is the body of a GraphQL response
+type GraphQLResponse struct {
+	Data   interface{}   `json:"data"`
+	Errors []interface{} `json:"errors,omitempty"`
+}
+
+var (
+	bookIDParam = &openapi.Param{Name: fieldID, In: "path", Description: "Book ID",
+		Schema: openapi.UnsignedInteger()}
+	reviewIDParam = &openapi.Param{Name: fieldID, In: "path", Description: "Review ID",
+		Schema: openapi.String()}
+	userIDParam = &openapi.Param{Name: fieldID, In: "path", Description: "User ID",
+		Schema: openapi.UnsignedInteger()}
+	revParam = &openapi.Param{Name: fieldRev, In: "path", Description: "Revision number, from 1",
+		Schema: openapi.UnsignedInteger()}
+	apiKeyIDParam = &openapi.Param{Name: fieldID, In: "path", Description: "API key ID",
+		Schema: openapi.UnsignedInteger()}
+	offsetParam = &openapi.Param{Name: fieldOffset, In: "query", Description: "Offset of the page",
+		Schema: openapi.UnsignedInteger()}
+	queryParam = &openapi.Param{Name: fieldQuery, In: "query", Description: "Search keyword",
+		Schema: openapi.String()}
+
+	badRequest   = &openapi.Reply{Status: http.StatusBadRequest, Body: ErrorResponse{}}
+	unauthorized = &openapi.Reply{Status: http.StatusUnauthorized, Body: ErrorResponse{}}
+	notFound     = &openapi.Reply{Status: http.StatusNotFound, Body: ErrorResponse{}}
+	noContent    = &openapi.Reply{Status: http.StatusNoContent}
+	serverError  = &openapi.Reply{Status: http.StatusInternalServerError, Body: ErrorResponse{}}
+	noScope      = &openapi.Reply{Status: http.StatusForbidden, Description: "The API key has no scope for this route",
+		Body: ErrorResponse{}}
+	notReviewer = &openapi.Reply{Status: http.StatusForbidden,
+		Description: "The review is another user's, or the API key has no scope", Body: ErrorResponse{}}
+	rateLimited = &openapi.Reply{Status: http.StatusTooManyRequests,
+		Description: "Rate limited, retry after the seconds in Retry-After", Body: ErrorResponse{}}
+	lockedOut = &openapi.Reply{Status: http.StatusTooManyRequests,
+		Description: "Rate limited, or locked out after too many wrong passwords", Body: ErrorResponse{}}
+	wrongPassword = &openapi.Reply{Status: http.StatusUnauthorized, Description: "Wrong password",
+		Body: ErrorResponse{}}
+	emailTaken = &openapi.Reply{Status: http.StatusConflict, Description: "The email belongs to another account",
+		Body: ErrorResponse{}}
+)
+
+// apiRoutes describes every route of the main router.
+// MakeRouter refuses to start if a registered route is missing here.
+func apiRoutes() []*openapi.Route {
+	return []*openapi.Route{
+		{Method: http.MethodGet, Path: "/", OperationID: "health", Summary: "Health check", Tag: tagHealth,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: HealthResponse{}}}},
+		{Method: http.MethodGet, Path: "/healthz", OperationID: "liveness", Summary: "Liveness check", Tag: tagHealth,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: HealthResponse{}}}},
+		{Method: http.MethodGet, Path: "/readyz", OperationID: "readiness", Summary: "Readiness check with dependencies",
+			Tag: tagHealth,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Description: "Ready, or degraded", Body: dto.Readiness{}},
+				{Status: http.StatusServiceUnavailable, Description: "Unready", Body: dto.Readiness{}}}},
+
+		{Method: http.MethodGet, Path: "/books", OperationID: "getBooks", Summary: "List or search books",
+			Tag: tagBooks, Params: []*openapi.Param{offsetParam, queryParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: []*model.Book{}}, badRequest, notFound}},
+		{Method: http.MethodGet, Path: "/books/:id", OperationID: "getBook", Summary: "Get a book",
+			Tag: tagBooks, Params: []*openapi.Param{bookIDParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: model.Book{}}, badRequest, notFound}},
+		{Method: http.MethodPost, Path: "/books", OperationID: "createBook", Summary: "Create a book",
+			Tag: tagBooks, Auth: true, Scopes: scopes(model.ScopeBooksWrite), Body: model.Book{},
+			Replies: []*openapi.Reply{{Status: http.StatusCreated, Body: model.Book{}}, badRequest, unauthorized,
+				noScope, notFound}},
+		{Method: http.MethodPut, Path: "/books/:id", OperationID: "updateBook", Summary: "Update a book",
+			Tag: tagBooks, Auth: true, Scopes: scopes(model.ScopeBooksWrite), Params: []*openapi.Param{bookIDParam},
+			Body: model.Book{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: model.Book{}}, badRequest, unauthorized,
+				noScope, notFound}},
+		{Method: http.MethodDelete, Path: "/books/:id", OperationID: "deleteBook", Summary: "Delete a book",
+			Tag: tagBooks, Auth: true, Scopes: scopes(model.ScopeBooksWrite), Params: []*openapi.Param{bookIDParam},
+			Replies: []*openapi.Reply{noContent, badRequest, unauthorized, noScope, notFound}},
+		{Method: http.MethodGet, Path: "/books/:id/revisions", OperationID: "getBookRevisions",
+			Summary: "List the revisions of a book, the latest first", Tag: tagBooks,
+			Params: []*openapi.Param{bookIDParam, offsetParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: []*model.BookRevision{}}, badRequest,
+				notFound, serverError}},
+		{Method: http.MethodGet, Path: "/books/:id/revisions/:rev", OperationID: "getBookRevision",
+			Summary: "Get a revision of a book", Tag: tagBooks, Params: []*openapi.Param{bookIDParam, revParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: model.BookRevision{}}, badRequest, notFound,
+				serverError}},
+		{Method: http.MethodGet, Path: "/books/:id/revisions/:rev/diff", OperationID: "diffBookRevisions",
+			Summary: "Show the fields a revision of a book changed", Tag: tagBooks,
+			Params: []*openapi.Param{bookIDParam, revParam,
+				{Name: "from", In: "query", Description: "Revision to compare with, the one before by default",
+					Schema: openapi.UnsignedInteger()}},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.RevisionDiff{}}, badRequest, notFound,
+				serverError}},
+		{Method: http.MethodPost, Path: "/books/:id/revisions/:rev/revert", OperationID: "revertBook",
+			Summary: "Restore a book to an earlier revision, as a new revision", Tag: tagBooks, Auth: true,
+			Scopes: scopes(model.ScopeBooksWrite), Params: []*openapi.Param{bookIDParam, revParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: model.Book{}}, badRequest, unauthorized,
+				noScope, notFound, serverError}},
+		{Method: http.MethodGet, Path: "/books/:id/reviews", OperationID: "getReviewsOfBook",
+			Summary: "List or search the reviews of a book", Tag: tagReviews,
+			Params:  []*openapi.Param{bookIDParam, queryParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: []*model.Review{}}, badRequest, notFound}},
+		{Method: http.MethodGet, Path: "/ws/books", OperationID: "bookSocket",
+			Summary: "Open a WebSocket for book changes and editing presence", Tag: tagBooks,
+			Params: []*openapi.Param{{Name: fieldToken, In: "query",
+				Description: "Token, for clients that cannot set the Authorization header", Schema: openapi.String()}},
+			Replies: []*openapi.Reply{{Status: http.StatusSwitchingProtocols}, unauthorized}},
+
+		{Method: http.MethodGet, Path: "/reviews/:id", OperationID: "getReview", Summary: "Get a review",
+			Tag: tagReviews, Params: []*openapi.Param{reviewIDParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: model.Review{}}, notFound}},
+		{Method: http.MethodPost, Path: "/reviews", OperationID: "createReview", Summary: "Create a review",
+			Tag: tagReviews, Auth: true, Scopes: scopes(model.ScopeReviewsWrite), Body: dto.ReviewBody{},
+			Replies: []*openapi.Reply{{Status: http.StatusCreated, Body: model.Review{}}, badRequest, unauthorized,
+				{Status: http.StatusForbidden, Description: "The email is not verified, or the API key has no scope",
+					Body: ErrorResponse{}},
+				notFound, rateLimited}},
+		{Method: http.MethodPut, Path: "/reviews/:id", OperationID: "updateReview", Summary: "Update a review",
+			Tag: tagReviews, Auth: true, Scopes: scopes(model.ScopeReviewsWrite),
+			Params: []*openapi.Param{reviewIDParam}, Body: model.Review{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: model.Review{}}, badRequest, unauthorized,
+				notReviewer, notFound, rateLimited}},
+		{Method: http.MethodDelete, Path: "/reviews/:id", OperationID: "deleteReview", Summary: "Delete a review",
+			Tag: tagReviews, Auth: true, Scopes: scopes(model.ScopeReviewsWrite),
+			Params:  []*openapi.Param{reviewIDParam},
+			Replies: []*openapi.Reply{noContent, unauthorized, notReviewer, notFound, rateLimited}},
+
+		{Method: http.MethodGet, Path: "/graphql", OperationID: "queryGraphQL", Summary: "Run a GraphQL query",
+			Tag: tagBooks, Params: []*openapi.Param{{Name: "query", In: "query", Required: true,
+				Schema: openapi.String()}},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: GraphQLResponse{}}, badRequest, rateLimited}},
+		{Method: http.MethodPost, Path: "/graphql", OperationID: "postGraphQL",
+			Summary: "Run a GraphQL query or mutation", Tag: tagBooks, Body: GraphQLRequest{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: GraphQLResponse{}}, badRequest, unauthorized,
+				rateLimited}},
+
+		{Method: http.MethodPost, Path: "/users", OperationID: "userSignUp", Summary: "Sign up",
+			Tag: tagUsers, Body: dto.UserCredential{},
+			Replies: []*openapi.Reply{{Status: http.StatusCreated, Body: dto.User{}}, badRequest, notFound,
+				rateLimited}},
+		{Method: http.MethodPost, Path: "/users/sign-in", OperationID: "userSignIn", Summary: "Sign in",
+			Tag: tagUsers, Body: dto.UserCredential{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK,
+				Description: "Signed in, or challenged for the second factor", Body: dto.UserToken{}}, badRequest,
+				{Status: http.StatusUnauthorized, Description: "Wrong email or password", Body: ErrorResponse{}},
+				{Status: http.StatusTooManyRequests,
+					Description: "Rate limited, or locked out after too many failed sign-ins", Body: ErrorResponse{}},
+				serverError}},
+		{Method: http.MethodPost, Path: "/users/sign-in/mfa", OperationID: "userSignInMFA",
+			Summary: "Finish a sign-in with a code of the authenticator or a recovery code", Tag: tagUsers,
+			Body: dto.MFAChallenge{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.UserToken{}}, badRequest,
+				{Status: http.StatusUnauthorized, Description: "Wrong code, or invalid challenge", Body: ErrorResponse{}},
+				{Status: http.StatusTooManyRequests,
+					Description: "Rate limited, or locked out after too many failed sign-ins", Body: ErrorResponse{}},
+				notFound, serverError}},
+		{Method: http.MethodPost, Path: "/users/mfa/totp", OperationID: "enrollTOTP",
+			Summary: "Start the enrollment of an authenticator", Tag: tagUsers, Auth: true,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.TOTPEnrollment{}}, badRequest, unauthorized,
+				notFound, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/mfa/totp/confirm", OperationID: "confirmTOTP",
+			Summary: "Turn two-factor authentication on with a code of the enrolled authenticator", Tag: tagUsers,
+			Auth: true, Body: dto.MFACode{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Description: "The recovery codes, shown only once",
+				Body: dto.RecoveryCodes{}}, badRequest, unauthorized, notFound, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/mfa/disable", OperationID: "disableMFA",
+			Summary: "Turn two-factor authentication off", Tag: tagUsers, Auth: true, Body: dto.MFACode{},
+			Replies: []*openapi.Reply{noContent, badRequest, unauthorized,
+				{Status: http.StatusForbidden, Description: "Two-factor authentication is enforced for the role",
+					Body: ErrorResponse{}}, notFound, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/mfa/recovery-codes", OperationID: "regenerateRecoveryCodes",
+			Summary: "Replace the recovery codes", Tag: tagUsers, Auth: true, Body: dto.MFACode{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Description: "The new recovery codes, shown only once",
+				Body: dto.RecoveryCodes{}}, badRequest, unauthorized, notFound, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/api-keys", OperationID: "createAPIKey",
+			Summary: "Create an API key", Tag: tagUsers, Auth: true, Body: dto.APIKeyRequest{},
+			Replies: []*openapi.Reply{{Status: http.StatusCreated, Description: "The API key, with the key shown only once",
+				Body: dto.APIKey{}}, badRequest, unauthorized,
+				{Status: http.StatusForbidden, Description: "Too many active API keys", Body: ErrorResponse{}},
+				rateLimited, serverError}},
+		{Method: http.MethodGet, Path: "/users/api-keys", OperationID: "listAPIKeys",
+			Summary: "List the API keys of the signed-in user", Tag: tagUsers, Auth: true,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: []*dto.APIKey{}}, unauthorized, rateLimited,
+				serverError}},
+		{Method: http.MethodDelete, Path: "/users/api-keys/:id", OperationID: "revokeAPIKey",
+			Summary: "Revoke an API key", Tag: tagUsers, Auth: true, Params: []*openapi.Param{apiKeyIDParam},
+			Replies: []*openapi.Reply{noContent, badRequest, unauthorized, notFound, rateLimited, serverError}},
+		{Method: http.MethodGet, Path: "/users/me", OperationID: "getProfile",
+			Summary: "Get the profile of the signed-in user", Tag: tagUsers, Auth: true,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.Profile{}}, unauthorized, notFound,
+				rateLimited, serverError}},
+		{Method: http.MethodPatch, Path: "/users/me", OperationID: "updateProfile",
+			Summary: "Change the given fields of the profile", Tag: tagUsers, Auth: true, Body: dto.ProfileUpdate{},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.Profile{}}, badRequest, unauthorized,
+				notFound, rateLimited, serverError}},
+		{Method: http.MethodDelete, Path: "/users/me", OperationID: "deleteAccount",
+			Summary: "Delete the account, anonymizing its reviews", Tag: tagUsers, Auth: true,
+			Body: dto.AccountDeletion{},
+			Replies: []*openapi.Reply{noContent,
+				{Status: http.StatusBadRequest, Description: "The account has no password", Body: ErrorResponse{}},
+				wrongPassword, notFound, lockedOut, serverError}},
+		{Method: http.MethodPost, Path: "/users/me/password", OperationID: "changePassword",
+			Summary: "Change the password, proving the current one", Tag: tagUsers, Auth: true,
+			Body:    dto.PasswordChange{},
+			Replies: []*openapi.Reply{noContent, badRequest, wrongPassword, notFound, lockedOut, serverError}},
+		{Method: http.MethodPost, Path: "/users/me/email", OperationID: "requestEmailChange",
+			Summary: "Mail the new email a link to confirm the change", Tag: tagUsers, Auth: true,
+			Body: dto.EmailChange{},
+			Replies: []*openapi.Reply{{Status: http.StatusAccepted, Description: "Mailed the new email"}, badRequest,
+				wrongPassword, notFound, emailTaken, lockedOut, serverError}},
+		{Method: http.MethodGet, Path: "/users/me/export", OperationID: "exportData",
+			Summary: "Download all personal data of the signed-in user", Tag: tagUsers, Auth: true,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Description: "A JSON file to download",
+				Body: dto.DataExport{}}, unauthorized, notFound, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/email-change/confirm", OperationID: "confirmEmailChange",
+			Summary: "Change the email with the token of a change link", Tag: tagUsers,
+			Body:    dto.EmailVerification{},
+			Replies: []*openapi.Reply{noContent, badRequest, emailTaken, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/verify-email", OperationID: "requestEmailVerification",
+			Summary: "Mail another email verification link", Tag: tagUsers, Auth: true,
+			Replies: []*openapi.Reply{noContent,
+				{Status: http.StatusBadRequest, Description: "The email is already verified", Body: ErrorResponse{}},
+				unauthorized, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/verify-email/confirm", OperationID: "verifyEmail",
+			Summary: "Verify the email with the token of a verification link", Tag: tagUsers,
+			Body:    dto.EmailVerification{},
+			Replies: []*openapi.Reply{noContent, badRequest, rateLimited, serverError}},
+		{Method: http.MethodPost, Path: "/users/password-reset", OperationID: "requestPasswordReset",
+			Summary: "Mail a password reset link", Tag: tagUsers, Body: dto.PasswordResetRequest{},
+			Replies: []*openapi.Reply{{Status: http.StatusAccepted,
+				Description: "Accepted, whether the email is registered or not"}, badRequest, rateLimited}},
+		{Method: http.MethodPost, Path: "/users/password-reset/confirm", OperationID: "resetPassword",
+			Summary: "Set a new password with the token of a reset link", Tag: tagUsers, Body: dto.PasswordReset{},
+			Replies: []*openapi.Reply{noContent, badRequest, rateLimited, serverError}},
+
+		{Method: http.MethodGet, Path: "/auth/oidc/login", OperationID: "startSSO",
+			Summary: "Sign in with the OpenID Connect provider", Tag: tagUsers,
+			Replies: []*openapi.Reply{{Status: http.StatusFound, Description: "Redirect to the provider"},
+				{Status: http.StatusNotFound, Description: "Single sign-on is off", Body: ErrorResponse{}},
+				rateLimited, serverError}},
+		{Method: http.MethodGet, Path: "/auth/oidc/callback", OperationID: "ssoCallback",
+			Summary: "Finish a sign-in with the OpenID Connect provider", Tag: tagUsers,
+			Params: []*openapi.Param{
+				{Name: "code", In: "query", Description: "Authorization code", Schema: openapi.String()},
+				{Name: "state", In: "query", Description: "State of the sign-in", Schema: openapi.String()},
+				{Name: "error", In: "query", Description: "Error of the provider", Schema: openapi.String()}},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.UserToken{}},
+				{Status: http.StatusUnauthorized, Description: "Refused by the provider, or an invalid state",
+					Body: ErrorResponse{}},
+				{Status: http.StatusForbidden, Description: "No account may be linked to the identity",
+					Body: ErrorResponse{}},
+				{Status: http.StatusNotFound, Description: "Single sign-on is off", Body: ErrorResponse{}},
+				rateLimited, serverError}},
+
+		{Method: http.MethodGet, Path: "/openapi.json", OperationID: "getOpenAPI",
+			Summary: "This OpenAPI document", Tag: tagDocs,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Schema: &openapi.Schema{Type: "object"}}}},
+		{Method: http.MethodGet, Path: "/docs", OperationID: "getDocs", Summary: "API reference page", Tag: tagDocs,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Description: "HTML page"}}},
+		{Method: http.MethodGet, Path: "/admin/config", OperationID: "getConfig",
+			Summary: "Active config, with secrets redacted", Tag: tagAdmin, Auth: true,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.ConfigStatus{}}, unauthorized}},
+		{Method: http.MethodPost, Path: "/admin/unlock", OperationID: "unlock",
+			Summary: "Lift the sign-in lockouts of an account or an IP", Tag: tagAdmin, Auth: true, Body: dto.Unlock{},
+			Replies: []*openapi.Reply{noContent, badRequest, unauthorized,
+				serverError}},
+		{Method: http.MethodDelete, Path: "/admin/users/:id/mfa", OperationID: "resetMFA",
+			Summary: "Turn off two-factor authentication of a user who lost the authenticator", Tag: tagAdmin,
+			Auth: true, Params: []*openapi.Param{userIDParam},
+			Replies: []*openapi.Reply{noContent, badRequest, unauthorized, notFound, serverError}},
+		{Method: http.MethodDelete, Path: "/admin/users/:id/api-keys", OperationID: "revokeUserAPIKeys",
+			Summary: "Revoke all API keys of a user", Tag: tagAdmin, Auth: true, Params: []*openapi.Param{userIDParam},
+			Replies: []*openapi.Reply{noContent, badRequest, unauthorized, notFound, serverError}},
+		{Method: http.MethodPost, Path: "/admin/users/:id/erasure", OperationID: "eraseUser",
+			Summary: "Remove or pseudonymize all personal data of a user", Tag: tagAdmin, Auth: true,
+			Params: []*openapi.Param{userIDParam},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Description: "What was done in each store",
+				Body: dto.ErasureReport{}}, badRequest, unauthorized, notFound, serverError}},
+		{Method: http.MethodGet, Path: "/admin/audit", OperationID: "listAudit",
+			Summary: "List the entries of the audit log, newest first", Tag: tagAdmin, Auth: true,
+			Params: []*openapi.Param{
+				{Name: "actor_id", In: "query", Description: "User who did the operation",
+					Schema: openapi.UnsignedInteger()},
+				{Name: "action", In: "query", Description: "Operation, like book.delete", Schema: openapi.String()},
+				{Name: "target_type", In: "query", Description: "Type of the target, like book",
+					Schema: openapi.String()},
+				{Name: "target_id", In: "query", Description: "ID of the target", Schema: openapi.String()},
+				{Name: "since", In: "query", Description: "Earliest time, in RFC 3339", Schema: openapi.String()},
+				{Name: "until", In: "query", Description: "Latest time, in RFC 3339", Schema: openapi.String()},
+				{Name: "before_id", In: "query", Description: "Page back from the entry, exclusive",
+					Schema: openapi.UnsignedInteger()},
+				{Name: "limit", In: "query", Description: "Most entries to return, up to 1000",
+					Schema: openapi.UnsignedInteger()}},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: []*dto.AuditEntry{}}, badRequest, unauthorized,
+				serverError}},
+		{Method: http.MethodGet, Path: "/admin/audit/verify", OperationID: "verifyAudit",
+			Summary: "Check the hash chain of the audit log", Tag: tagAdmin, Auth: true,
+			Params: []*openapi.Param{
+				{Name: "expect_head", In: "query", Description: "head_hash of an earlier verification",
+					Schema: openapi.String()},
+				{Name: "expect_entries", In: "query", Description: "entries of the same earlier verification",
+					Schema: openapi.UnsignedInteger()}},
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Body: dto.AuditVerification{}}, badRequest,
+				unauthorized, serverError}},
+		{Method: http.MethodGet, Path: "/metrics", OperationID: "getMetrics", Summary: "Prometheus metrics", Tag: tagHealth,
+			Replies: []*openapi.Reply{{Status: http.StatusOK, Description: "Prometheus text format"}}},
+	}
+}
+
+// scopes lists the API key scopes of a route
+func scopes(s ...model.APIScope) []string {
+	names := make([]string, len(s))
+	for i, scope := range s {
+		names[i] = string(scope)
+	}
+	return names
+}
+
+// makeSpec builds the OpenAPI document of the main router
+func makeSpec() *openapi.Document {
+	b := openapi.NewBuilder(&openapi.Info{
+		Title:       apiTitle,
+		Version:     apiVersion,
+		Description: "RESTful API of books, reviews and users.",
+	})
+	for _, route := range apiRoutes() {
+		b.Add(route)
+	}
+	return b.Document()
+}
+
+// checkSpec makes sure every registered route is described by the document
+func checkSpec(r *gin.Engine, doc *openapi.Document) error {
+	if missing := doc.Missing(r.Routes()); len(missing) > 0 {
+		return fmt.Errorf("routes without OpenAPI spec entries: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func serveDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
@@ -0,0 +1,119 @@
+package adaptor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"literank.com/rest-books/adaptor/openapi"
+)
+
+const contentTypeJSON = "application/json"
+
+// bodyRecorder keeps a copy of the response body for validation
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// ContractCheck validates requests against the OpenAPI document before they reach the handlers,
+// refusing bodies over maxBody bytes. With checkResponses on, it also validates responses and logs
+// the contract violations.
+func ContractCheck(doc *openapi.Document, maxBody int64, checkResponses bool, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := doc.Operation(c.Request.Method, c.FullPath())
+		if op == nil {
+			// Unknown routes are left to the router
+			c.Next()
+			return
+		}
+		// Handlers read the bodies that are not validated, so those are capped too
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+		problems, err := validateRequest(c, doc, op)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge,
+				gin.H{"error": fmt.Sprintf("body is larger than %d bytes", tooLarge.Limit)})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to read body: %v", err))
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": strings.Join(problems, "; ")})
+			c.Abort()
+			return
+		}
+		if !checkResponses || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		w := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		for _, p := range validateResponse(doc, op, w.Status(), w.body.Bytes()) {
+			logger.WarnContext(c, "Contract violation", "method", c.Request.Method, "route", c.FullPath(),
+				"problem", p)
+		}
+	}
+}
+
+// validateRequest lists the contract problems of the request, or fails if its body cannot be read
+func validateRequest(c *gin.Context, doc *openapi.Document, op *openapi.Operation) ([]string, error) {
+	path := make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		path[p.Key] = p.Value
+	}
+	problems := doc.ValidateParams(op, path, c.Request.URL.Query())
+	if op.RequestBody == nil {
+		return problems, nil
+	}
+	media, ok := op.RequestBody.Content[contentTypeJSON]
+	if !ok || c.ContentType() != contentTypeJSON {
+		return problems, nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return problems, err
+	}
+	// Put the body back for the handlers
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			problems = append(problems, "body is required")
+		}
+		return problems, nil
+	}
+	return append(problems, doc.ValidateBody(media.Schema, body)...), nil
+}
+
+func validateResponse(doc *openapi.Document, op *openapi.Operation, status int, body []byte) []string {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented", status)}
+	}
+	media, ok := resp.Content[contentTypeJSON]
+	if !ok || len(body) == 0 {
+		return nil
+	}
+	return doc.ValidateBody(media.Schema, body)
+}
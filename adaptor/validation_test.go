@@ -0,0 +1,78 @@
+package adaptor
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestContractCheck(t *testing.T) {
+	const maxBody = 64
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := gin.New()
+	r.Use(ContractCheck(makeSpec(), maxBody, false, logger))
+	// The handlers answer with the body they get, so that the tests see it was put back
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.String(http.StatusRequestEntityTooLarge, "handler: %v", err)
+			return
+		}
+		c.String(http.StatusOK, "%s", body)
+	}
+	r.POST("/users/sign-in", echo)
+	r.GET("/books", echo)
+	r.GET("/books/:id", echo)
+	r.GET("/undocumented", echo)
+
+	long := `{"email": "a@example.com", "password": "` + strings.Repeat("x", maxBody) + `"}`
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"valid body", http.MethodPost, "/users/sign-in", contentTypeJSON, `{"email": "a@example.com"}`,
+			http.StatusOK, `{"email": "a@example.com"}`},
+		{"malformed body", http.MethodPost, "/users/sign-in", contentTypeJSON, `{"email":`,
+			http.StatusBadRequest, "not valid JSON"},
+		{"wrong field type", http.MethodPost, "/users/sign-in", contentTypeJSON, `{"email": 5}`,
+			http.StatusBadRequest, "email"},
+		{"missing body", http.MethodPost, "/users/sign-in", contentTypeJSON, "",
+			http.StatusBadRequest, "body is required"},
+		{"body over the limit", http.MethodPost, "/users/sign-in", contentTypeJSON, long,
+			http.StatusRequestEntityTooLarge, "larger than 64 bytes"},
+		{"unvalidated body over the limit", http.MethodPost, "/users/sign-in", "text/plain", long,
+			http.StatusRequestEntityTooLarge, "handler"},
+		{"body at the limit", http.MethodPost, "/users/sign-in", contentTypeJSON,
+			`{"password": "` + strings.Repeat("x", maxBody-16) + `"}`, http.StatusOK, "xxx"},
+		{"valid query", http.MethodGet, "/books?o=5", "", "", http.StatusOK, ""},
+		{"bad query", http.MethodGet, "/books?o=five", "", "", http.StatusBadRequest, "not a number"},
+		{"bad path", http.MethodGet, "/books/dune", "", "", http.StatusBadRequest, "id"},
+		{"undocumented route", http.MethodGet, "/undocumented?o=five", "", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s = %d %s, want %d with %q", tt.method, tt.target, w.Code, w.Body.String(),
+					tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
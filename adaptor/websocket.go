@@ -0,0 +1,370 @@
+package adaptor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const (
+	fieldToken = "token"
+
+	wsSendBuffer     = 32
+	wsMaxMessageSize = 4096
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+)
+
+// Message types exchanged over the book socket
+const (
+	msgSubscribe   = "subscribe"
+	msgUnsubscribe = "unsubscribe"
+	msgEditing     = "editing"
+	msgIdle        = "idle"
+	msgPresence    = "presence"
+	msgBookChanged = "book_changed"
+	msgError       = "error"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// socketMessage is the envelope of every message on the book socket
+type socketMessage struct {
+	Type   string              `json:"type"`
+	BookID uint                `json:"book_id,omitempty"`
+	Event  *executor.BookEvent `json:"event,omitempty"`
+	Users  []*presenceEntry    `json:"users,omitempty"`
+	Error  string              `json:"error,omitempty"`
+}
+
+// presenceEntry tells who has a book open and whether they are editing it
+type presenceEntry struct {
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email"`
+	Editing bool   `json:"editing"`
+}
+
+// BookHub keeps per-book rooms of socket clients and pushes book changes to them.
+type BookHub struct {
+	mu      sync.Mutex
+	rooms   map[uint]map[*socketClient]bool
+	clients map[*socketClient]bool
+	logger  *slog.Logger
+}
+
+// socketClient is a single socket connection.
+// Its rooms map is guarded by the hub's mutex; the value tells if the client is editing.
+type socketClient struct {
+	hub       *BookHub
+	conn      *websocket.Conn
+	user      *model.UserIdentity
+	send      chan []byte
+	rooms     map[uint]bool
+	closed    bool
+	closeOnce sync.Once
+}
+
+// NewBookHub constructs a new BookHub
+func NewBookHub(logger *slog.Logger) *BookHub {
+	return &BookHub{
+		rooms:   make(map[uint]map[*socketClient]bool),
+		clients: make(map[*socketClient]bool),
+		logger:  logger,
+	}
+}
+
+// BookChanged pushes the book event to everyone who has the book open.
+// It has the signature of executor.BookListener.
+func (h *BookHub) BookChanged(ctx context.Context, e *executor.BookEvent) {
+	data, err := json.Marshal(&socketMessage{Type: msgBookChanged, BookID: e.BookID, Event: e})
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to marshal book event", logging.KeyError, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishLocked(e.BookID, data)
+}
+
+// Close disconnects every client.
+// The HTTP server lets go of upgraded connections, so they are not drained on shutdown.
+func (h *BookHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		h.dropLocked(c)
+	}
+}
+
+func (h *BookHub) register(conn *websocket.Conn, user *model.UserIdentity) *socketClient {
+	c := &socketClient{
+		hub:   h,
+		conn:  conn,
+		user:  user,
+		send:  make(chan []byte, wsSendBuffer),
+		rooms: make(map[uint]bool),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = true
+	return c
+}
+
+func (h *BookHub) join(c *socketClient, bookID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.closed {
+		return
+	}
+	room, ok := h.rooms[bookID]
+	if !ok {
+		room = make(map[*socketClient]bool)
+		h.rooms[bookID] = room
+	}
+	room[c] = true
+	if _, ok := c.rooms[bookID]; !ok {
+		c.rooms[bookID] = false
+	}
+	h.presenceLocked(bookID)
+}
+
+func (h *BookHub) leave(c *socketClient, bookID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := c.rooms[bookID]; !ok {
+		return
+	}
+	h.removeLocked(c, bookID)
+	h.presenceLocked(bookID)
+}
+
+func (h *BookHub) setEditing(c *socketClient, bookID uint, editing bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := c.rooms[bookID]; !ok {
+		return false
+	}
+	c.rooms[bookID] = editing
+	h.presenceLocked(bookID)
+	return true
+}
+
+// unregister removes the client from all its rooms and closes its send queue
+func (h *BookHub) unregister(c *socketClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, bookID := range h.dropLocked(c) {
+		h.presenceLocked(bookID)
+	}
+}
+
+func (h *BookHub) removeLocked(c *socketClient, bookID uint) {
+	delete(c.rooms, bookID)
+	if room, ok := h.rooms[bookID]; ok {
+		delete(room, c)
+		if len(room) == 0 {
+			delete(h.rooms, bookID)
+		}
+	}
+}
+
+// dropLocked disconnects the client and returns the rooms it has left
+func (h *BookHub) dropLocked(c *socketClient) []uint {
+	bookIDs := make([]uint, 0, len(c.rooms))
+	for bookID := range c.rooms {
+		bookIDs = append(bookIDs, bookID)
+	}
+	for _, bookID := range bookIDs {
+		h.removeLocked(c, bookID)
+	}
+	delete(h.clients, c)
+	c.closed = true
+	c.closeOnce.Do(func() { close(c.send) })
+	return bookIDs
+}
+
+// publishLocked sends data to every client in the room.
+// Slow consumers whose queue is full are dropped instead of blocking the others.
+func (h *BookHub) publishLocked(bookID uint, data []byte) {
+	pending := []uint{}
+	for c := range h.rooms[bookID] {
+		select {
+		case c.send <- data:
+		default:
+			pending = append(pending, h.dropLocked(c)...)
+		}
+	}
+	for _, id := range pending {
+		if id != bookID {
+			h.presenceLocked(id)
+		}
+	}
+	if len(pending) > 0 {
+		h.presenceLocked(bookID)
+	}
+}
+
+// presenceLocked tells everyone in the room who else has the book open
+func (h *BookHub) presenceLocked(bookID uint) {
+	room := h.rooms[bookID]
+	if len(room) == 0 {
+		return
+	}
+	users := make([]*presenceEntry, 0, len(room))
+	for c := range room {
+		users = append(users, &presenceEntry{
+			UserID:  c.user.UserID,
+			Email:   c.user.Email,
+			Editing: c.rooms[bookID],
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	data, err := json.Marshal(&socketMessage{Type: msgPresence, BookID: bookID, Users: users})
+	if err != nil {
+		h.logger.Error("Failed to marshal presence", logging.KeyError, err)
+		return
+	}
+	h.publishLocked(bookID, data)
+}
+
+// readPump handles messages from the client until the connection fails
+func (c *socketClient) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		c.conn.Close()
+	}()
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		var m socketMessage
+		if err := c.conn.ReadJSON(&m); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				c.hub.logger.Warn("Failed to read from socket", "user_id", c.user.UserID, logging.KeyError, err)
+			}
+			return
+		}
+		c.handle(&m)
+	}
+}
+
+func (c *socketClient) handle(m *socketMessage) {
+	if m.BookID == 0 {
+		c.reply(&socketMessage{Type: msgError, Error: "book_id is required"})
+		return
+	}
+	switch m.Type {
+	case msgSubscribe:
+		c.hub.join(c, m.BookID)
+	case msgUnsubscribe:
+		c.hub.leave(c, m.BookID)
+	case msgEditing, msgIdle:
+		if c.user.Permission < model.PermAuthor {
+			c.reply(&socketMessage{Type: msgError, BookID: m.BookID, Error: "permission denied"})
+			return
+		}
+		if !c.hub.setEditing(c, m.BookID, m.Type == msgEditing) {
+			c.reply(&socketMessage{Type: msgError, BookID: m.BookID, Error: "not subscribed"})
+		}
+	default:
+		c.reply(&socketMessage{Type: msgError, BookID: m.BookID, Error: "unknown message type"})
+	}
+}
+
+// reply sends a message to this client only
+func (c *socketClient) reply(m *socketMessage) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		for _, bookID := range c.hub.dropLocked(c) {
+			c.hub.presenceLocked(bookID)
+		}
+	}
+}
+
+// writePump writes queued messages and pings to the connection
+func (c *socketClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				// The hub closed the queue
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Open a book socket for real-time book changes and presence
+func (r *RestHandler) bookSocket(c *gin.Context) {
+	token := bearerToken(c)
+	if token == "" {
+		// Browsers cannot set headers on socket requests
+		token = c.Query(fieldToken)
+	}
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token is required"})
+		return
+	}
+	user, err := r.userOperator.Authenticate(c, token)
+	if errors.Is(err, model.ErrUnauthenticated) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		r.logger.ErrorContext(c, "Failed to check the token", logging.KeyError, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check the token"})
+		return
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already replied with an error
+		r.logger.WarnContext(c, "Failed to upgrade socket", logging.KeyError, err)
+		return
+	}
+	client := r.bookHub.register(conn, user)
+	go client.writePump()
+	client.readPump()
+}
@@ -0,0 +1,204 @@
+package adaptor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"literank.com/rest-books/application/executor"
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/config"
+	"literank.com/rest-books/infrastructure/token"
+)
+
+// queued returns the types of the messages waiting in the client's queue, and empties it
+func queued(t *testing.T, c *socketClient) []string {
+	t.Helper()
+	var types []string
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				return append(types, "closed")
+			}
+			var m socketMessage
+			if err := json.Unmarshal(data, &m); err != nil {
+				t.Fatal(err)
+			}
+			types = append(types, fmt.Sprintf("%s %d", m.Type, m.BookID))
+		default:
+			return types
+		}
+	}
+}
+
+func TestBookHubBroadcast(t *testing.T) {
+	tests := []struct {
+		name   string
+		bookID uint
+		// want are the messages each of the three clients gets
+		want [3][]string
+	}{
+		{"book open by two", 1, [3][]string{{"book_changed 1"}, {"book_changed 1"}, nil}},
+		{"book open by one", 2, [3][]string{nil, nil, {"book_changed 2"}}},
+		{"book open by none", 3, [3][]string{nil, nil, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewBookHub(testHandler().logger)
+			var clients [3]*socketClient
+			for i := range clients {
+				clients[i] = h.register(nil, &model.UserIdentity{UserID: uint(i + 1)})
+			}
+			h.join(clients[0], 1)
+			h.join(clients[1], 1)
+			h.join(clients[2], 2)
+			for _, c := range clients {
+				queued(t, c)
+			}
+			h.BookChanged(context.Background(), &executor.BookEvent{Action: "updated", BookID: tt.bookID})
+			for i, c := range clients {
+				if got := queued(t, c); !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("client %d got %q, want %q", i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBookHubUnregister(t *testing.T) {
+	h := NewBookHub(testHandler().logger)
+	a := h.register(nil, &model.UserIdentity{UserID: 1})
+	b := h.register(nil, &model.UserIdentity{UserID: 2})
+	h.join(a, 1)
+	h.join(a, 2)
+	h.join(b, 1)
+	queued(t, a)
+	queued(t, b)
+
+	h.unregister(a)
+	if got := queued(t, a); !reflect.DeepEqual(got, []string{"closed"}) {
+		t.Errorf("unregistered client got %q, want its queue closed", got)
+	}
+	if got := queued(t, b); !reflect.DeepEqual(got, []string{"presence 1"}) {
+		t.Errorf("client left in the room got %q, want the new presence", got)
+	}
+	if _, ok := h.rooms[2]; ok || len(h.rooms[1]) != 1 || h.clients[a] {
+		t.Errorf("rooms %v and clients %v still hold the unregistered client", h.rooms, h.clients)
+	}
+	// Leaving twice, like on shutdown after the read pump stopped, is harmless
+	h.unregister(a)
+	h.join(a, 3)
+	if _, ok := h.rooms[3]; ok {
+		t.Error("an unregistered client joined a room")
+	}
+
+	h.unregister(b)
+	if len(h.rooms) != 0 || len(h.clients) != 0 {
+		t.Errorf("rooms %v and clients %v left after everyone unregistered", h.rooms, h.clients)
+	}
+}
+
+func TestBookHubDropsSlowClients(t *testing.T) {
+	h := NewBookHub(testHandler().logger)
+	slow := h.register(nil, &model.UserIdentity{UserID: 1})
+	fast := h.register(nil, &model.UserIdentity{UserID: 2})
+	h.join(slow, 1)
+	h.join(fast, 1)
+	queued(t, fast)
+	for len(slow.send) < cap(slow.send) {
+		slow.send <- []byte(`{}`)
+	}
+	h.BookChanged(context.Background(), &executor.BookEvent{Action: "updated", BookID: 1})
+	if !slow.closed || h.clients[slow] {
+		t.Error("the client with a full queue was not dropped")
+	}
+	got := queued(t, fast)
+	if len(got) == 0 || got[len(got)-1] != "presence 1" {
+		t.Errorf("other client got %q, want the change and then the new presence", got)
+	}
+}
+
+// socketUsers knows every user, none of them with a role
+type socketUsers struct {
+	gateway.UserManager
+}
+
+func (socketUsers) GetUser(ctx context.Context, id uint) (*model.User, error) {
+	return &model.User{ID: id, Email: fmt.Sprintf("user%d@example.com", id)}, nil
+}
+
+func TestBookSocketRoundTrip(t *testing.T) {
+	rest := testHandler()
+	keeper := token.NewTokenKeeper("secret", 1)
+	rest.userOperator = executor.NewUserOperator(socketUsers{}, keeper, nil, nil, nil, nil, nil, nil, rest.logger,
+		rest.metrics)
+	rest.bookHub = NewBookHub(rest.logger)
+	defer rest.bookHub.Close()
+	srv := httptest.NewServer(testRouter(t, &config.ApplicationConfig{}, rest))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/books"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dial without a token = %v, want %d", err, http.StatusUnauthorized)
+	}
+	signed, err := keeper.GenerateToken(7, "user7@example.com", model.PermUser, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token="+signed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() *socketMessage {
+		t.Helper()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var m socketMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatal(err)
+		}
+		return &m
+	}
+
+	tests := []struct {
+		name string
+		send *socketMessage
+		// push is a book change to make after sending
+		push *executor.BookEvent
+		want socketMessage
+	}{
+		{"subscribe", &socketMessage{Type: msgSubscribe, BookID: 1}, nil,
+			socketMessage{Type: msgPresence, BookID: 1,
+				Users: []*presenceEntry{{UserID: 7, Email: "user7@example.com"}}}},
+		{"book changed", nil, &executor.BookEvent{Action: "updated", BookID: 1},
+			socketMessage{Type: msgBookChanged, BookID: 1, Event: &executor.BookEvent{Action: "updated", BookID: 1}}},
+		{"editing without the author role", &socketMessage{Type: msgEditing, BookID: 1}, nil,
+			socketMessage{Type: msgError, BookID: 1, Error: "permission denied"}},
+		{"no book", &socketMessage{Type: msgSubscribe}, nil,
+			socketMessage{Type: msgError, Error: "book_id is required"}},
+	}
+	for _, tt := range tests {
+		if tt.send != nil {
+			if err := conn.WriteJSON(tt.send); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.push != nil {
+			rest.bookHub.BookChanged(context.Background(), tt.push)
+		}
+		if got := read(); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
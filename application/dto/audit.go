@@ -0,0 +1,45 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is an entry of the audit log
+type AuditEntry struct {
+	ID         uint   `json:"id"`
+	ActorID    uint   `json:"actor_id,omitempty"`
+	APIKeyID   uint   `json:"api_key_id,omitempty"`
+	Action     string `json:"action"`
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   string `json:"target_id,omitempty"`
+	// Before and After are the fields the operation changed
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+	// Erased tells that the IP and the fields before and after were erased with the user
+	Erased bool `json:"erased,omitempty"`
+}
+
+// AuditVerification is the result of checking the hash chain of the audit log
+type AuditVerification struct {
+	Entries int64 `json:"entries"`
+	// HeadHash is the hash of the last entry; keep it with Entries elsewhere as an anchor for later verifications,
+	// which tells if entries were dropped from the end
+	HeadHash string `json:"head_hash"`
+	Verified bool   `json:"verified"`
+	// BrokenAt is the first entry that does not match its hash or the one before, and Problem tells how
+	BrokenAt  uint      `json:"broken_at,omitempty"`
+	Problem   string    `json:"problem,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// AuditAnchor is the head of the audit log at an earlier verification
+type AuditAnchor struct {
+	Entries  int64
+	HeadHash string
+}
@@ -0,0 +1,17 @@
+package dto
+
+// RevisionDiff lists the fields of a book that differ between two of its revisions
+type RevisionDiff struct {
+	BookID uint `json:"book_id"`
+	// From is 0 when To is the first revision, which is then compared with an empty book
+	From    uint           `json:"from"`
+	To      uint           `json:"to"`
+	Changes []*FieldChange `json:"changes"`
+}
+
+// FieldChange is a field of a book that a revision changed
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+import (
+	"time"
+
+	"literank.com/rest-books/infrastructure/config"
+)
+
+// ConfigStatus describes the active config and the last reload
+type ConfigStatus struct {
+	Version  int64          `json:"version"`
+	LoadedAt time.Time      `json:"loaded_at"`
+	Config   *config.Config `json:"config"`
+	// Rejected lists the keys changed by the last reload that need a restart
+	Rejected  []string `json:"rejected"`
+	LastError string   `json:"last_error,omitempty"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+// DependencyStatus is the health of a backend the app depends on
+type DependencyStatus struct {
+	Name string `json:"name"`
+	// Status is up or down
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+}
+
+// Readiness tells if the app can serve traffic, and why not
+type Readiness struct {
+	// Status is one of ready, degraded and unready
+	Status string `json:"status"`
+	// Phase is one of starting, serving and draining
+	Phase        string              `json:"phase"`
+	Dependencies []*DependencyStatus `json:"dependencies"`
+}
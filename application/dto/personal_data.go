@@ -0,0 +1,62 @@
+package dto
+
+import "time"
+
+// DataExport is all personal data the app keeps of a user, for the user to download
+type DataExport struct {
+	ExportedAt time.Time           `json:"exported_at"`
+	Account    *ExportedAccount    `json:"account"`
+	Identities []*ExportedIdentity `json:"identities"`
+	APIKeys    []*APIKey           `json:"api_keys"`
+	Reviews    []*ExportedReview   `json:"reviews"`
+	// AuditEntries are the entries of operations the user did, or which targeted the user
+	AuditEntries []*AuditEntry `json:"audit_entries"`
+}
+
+// ExportedAccount is the account of an export, without its password or secrets
+type ExportedAccount struct {
+	Profile
+	Locale    string    `json:"locale"`
+	IsAdmin   bool      `json:"is_admin"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportedIdentity is an account of an external provider linked to the user
+type ExportedIdentity struct {
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// ExportedReview is a review the user posted
+type ExportedReview struct {
+	ID        string    `json:"id"`
+	BookID    uint      `json:"book_id"`
+	Author    string    `json:"author"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ErasureReport tells what an erasure did in each store, and whether the checks afterwards found anything left
+type ErasureReport struct {
+	UserID      uint           `json:"user_id"`
+	RequestedBy uint           `json:"requested_by,omitempty"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt time.Time      `json:"completed_at"`
+	Steps       []*ErasureStep `json:"steps"`
+	// Verified tells that no step left any data of the user behind
+	Verified bool `json:"verified"`
+}
+
+// ErasureStep is what an erasure did with one kind of data in one store
+type ErasureStep struct {
+	Store  string `json:"store"`
+	Data   string `json:"data"`
+	Action string `json:"action"`
+	Count  int64  `json:"count"`
+	// Remaining is what a check after the step still found of the user
+	Remaining int64 `json:"remaining"`
+}
@@ -1,19 +1,172 @@
 package dto
 
+import (
+	"log/slog"
+	"time"
+)
+
 // UserCredential represents the user's sign-in email and password
 type UserCredential struct {
 	Email    string `json:"email,omitempty"`
 	Password string `json:"password,omitempty"`
+	// Locale is the language of the mails to the user, taken from Accept-Language if not given.
+	Locale string `json:"locale,omitempty"`
+}
+
+// LogValue keeps the password out of the logs
+func (u UserCredential) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("email", u.Email))
 }
 
 // User is used as result of a successful sign-in
 type User struct {
-	ID    uint   `json:"id,omitempty"`
-	Email string `json:"email,omitempty"`
+	ID            uint   `json:"id,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	MFAEnabled    bool   `json:"mfa_enabled,omitempty"`
+	DisplayName   string `json:"display_name,omitempty"`
+}
+
+// Profile is the account of the signed-in user
+type Profile struct {
+	User
+	Bio       string `json:"bio"`
+	AvatarURL string `json:"avatar_url"`
+	// PendingEmail is the new email of a change, until the link mailed to it is opened
+	PendingEmail string    `json:"pending_email,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ProfileUpdate has the profile fields to change, leaving out the others
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+}
+
+// PasswordChange carries the current password of the user and the new one
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// LogValue keeps the passwords out of the logs
+func (p PasswordChange) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
+// EmailChange carries the new email of the user, and the password that proves the user asks for it
+type EmailChange struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LogValue keeps the password out of the logs
+func (e EmailChange) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("email", e.Email))
+}
+
+// AccountDeletion carries the password that proves the user asks to delete the account
+type AccountDeletion struct {
+	Password string `json:"password"`
+}
+
+// LogValue keeps the password out of the logs
+func (a AccountDeletion) LogValue() slog.Value {
+	return slog.GroupValue()
 }
 
 // UserToken is a combination of the User struct and the token field
 type UserToken struct {
 	User  User   `json:"user,omitempty"`
 	Token string `json:"token,omitempty"`
+	// MFARequired tells that the sign-in needs a second factor, sent with the challenge token instead of a token
+	MFARequired    bool   `json:"mfa_required,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
+	// MFAEnrollmentRequired tells that the token carries the user permission only, until the user enrolls
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+// MFAChallenge answers the challenge of a sign-in with a code of the authenticator or a recovery code
+type MFAChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// LogValue keeps the code out of the logs
+func (m MFAChallenge) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
+// MFACode carries a code of the authenticator, or a recovery code where one is accepted
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+// LogValue keeps the code out of the logs
+func (m MFACode) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
+// TOTPEnrollment is the secret of an authenticator being enrolled, and its URI for QR codes
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes are the one-time codes for a lost authenticator, shown only once
+type RecoveryCodes struct {
+	Codes []string `json:"codes"`
+}
+
+// Unlock names the account, the IP or both whose sign-in lockouts to lift
+type Unlock struct {
+	Email string `json:"email,omitempty"`
+	IP    string `json:"ip,omitempty"`
+}
+
+// EmailVerification carries the token of an email verification link
+type EmailVerification struct {
+	Token string `json:"token"`
+}
+
+// PasswordResetRequest names the account whose password to reset
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordReset carries the token of a password reset link and the new password
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// LogValue keeps the token and the password out of the logs
+func (p PasswordReset) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
+// APIKeyRequest names a new API key, its scopes and how many days it works, the default if 0
+type APIKeyRequest struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	ExpiresDays int      `json:"expires_days,omitempty"`
+}
+
+// APIKey describes an API key of the user, with the key itself only when it is created
+type APIKey struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// LogValue keeps the key out of the logs
+func (k APIKey) LogValue() slog.Value {
+	return slog.GroupValue(slog.Any("id", k.ID), slog.String("prefix", k.Prefix))
 }
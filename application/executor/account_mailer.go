@@ -0,0 +1,135 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/mail"
+)
+
+// Purposes of account action tokens
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposeResetPassword = "reset_password"
+	purposeChangeEmail   = "change_email"
+)
+
+var errInvalidActionToken = fmt.Errorf("%w: invalid or expired token", model.ErrInvalidArgument)
+
+// AccountMailSettings tell where the links of account mails lead, and how long they work
+type AccountMailSettings struct {
+	// BaseURL starts the links, like https://books.example.com
+	BaseURL   string
+	VerifyTTL time.Duration
+	ResetTTL  time.Duration
+}
+
+// AccountMailer sends the mails of account actions, with the single-use links that confirm them
+type AccountMailer struct {
+	mailer    gateway.Mailer
+	templates *mail.Templates
+	tokens    gateway.ActionTokenManager
+	settings  AccountMailSettings
+	logger    *slog.Logger
+}
+
+// NewAccountMailer constructs a new AccountMailer
+func NewAccountMailer(m gateway.Mailer, t *mail.Templates, tokens gateway.ActionTokenManager, s AccountMailSettings,
+	logger *slog.Logger) *AccountMailer {
+	return &AccountMailer{mailer: m, templates: t, tokens: tokens, settings: s, logger: logger}
+}
+
+// Locale returns the supported mail locale closest to the language tags
+func (a *AccountMailer) Locale(tags string) string {
+	return a.templates.Match(tags)
+}
+
+// SendVerification mails the user a link to verify the email
+func (a *AccountMailer) SendVerification(ctx context.Context, user *model.User) error {
+	token, err := a.tokens.SignAction(purposeVerifyEmail, user.ID, verifyState(user), a.settings.VerifyTTL)
+	if err != nil {
+		return err
+	}
+	return a.send(ctx, user, user.Email, mail.TemplateVerifyEmail, "/verify-email", token, map[string]interface{}{
+		"Hours": int(a.settings.VerifyTTL.Hours()),
+	})
+}
+
+// SendPasswordReset mails the user a link to choose a new password
+func (a *AccountMailer) SendPasswordReset(ctx context.Context, user *model.User) error {
+	token, err := a.tokens.SignAction(purposeResetPassword, user.ID, resetState(user), a.settings.ResetTTL)
+	if err != nil {
+		return err
+	}
+	return a.send(ctx, user, user.Email, mail.TemplateResetPassword, "/reset-password", token, map[string]interface{}{
+		"Minutes": int(a.settings.ResetTTL.Minutes()),
+	})
+}
+
+// SendEmailChange mails the pending email of the user a link to confirm the change
+func (a *AccountMailer) SendEmailChange(ctx context.Context, user *model.User) error {
+	token, err := a.tokens.SignAction(purposeChangeEmail, user.ID, changeEmailState(user), a.settings.VerifyTTL)
+	if err != nil {
+		return err
+	}
+	return a.send(ctx, user, user.PendingEmail, mail.TemplateChangeEmail, "/change-email", token,
+		map[string]interface{}{
+			"OldEmail": user.Email,
+			"Hours":    int(a.settings.VerifyTTL.Hours()),
+		})
+}
+
+// send mails the user at the address, which is the user's email but for email changes
+func (a *AccountMailer) send(ctx context.Context, user *model.User, to, template, path, token string,
+	data map[string]interface{}) error {
+	data["Email"] = to
+	data["Link"] = strings.TrimSuffix(a.settings.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+	m, err := a.templates.Render(user.Locale, template, to, data)
+	if err != nil {
+		return err
+	}
+	if err := a.mailer.Send(ctx, m); err != nil {
+		return err
+	}
+	a.logger.InfoContext(ctx, "Mail sent", "user_id", user.ID, "template", template)
+	return nil
+}
+
+// subject returns the user of the token, before its state can be checked
+func (a *AccountMailer) subject(purpose, token string) (uint, error) {
+	id, err := a.tokens.ActionSubject(purpose, token)
+	if err != nil {
+		return 0, errInvalidActionToken
+	}
+	return id, nil
+}
+
+// verify checks the token against the state of the account
+func (a *AccountMailer) verify(purpose, token, state string) error {
+	if err := a.tokens.VerifyAction(purpose, token, state); err != nil {
+		return errInvalidActionToken
+	}
+	return nil
+}
+
+// verifyState changes once the email is verified, or changed
+func verifyState(user *model.User) string {
+	return user.Email + "|" + strconv.FormatBool(user.EmailVerified)
+}
+
+// changeEmailState changes once the email changes, or another change is asked for
+func changeEmailState(user *model.User) string {
+	return user.Email + "|" + user.PendingEmail
+}
+
+// resetState changes once the password is reset
+func resetState(user *model.User) string {
+	return user.Password + "|" + user.Salt
+}
@@ -0,0 +1,190 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+// API keys look like lrb_<prefix>_<secret>, the prefix finding the key and the secret proving it
+const (
+	apiKeyTag         = "lrb"
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+	apiKeyNameLen     = 100
+	// lastUsedPrecision spares a write on every request of busy keys
+	lastUsedPrecision = time.Minute
+)
+
+var (
+	errInvalidAPIKey = fmt.Errorf("%w: invalid, expired or revoked API key", model.ErrUnauthenticated)
+	errAPIKeyName    = fmt.Errorf("%w: API key names must be 1 to %d characters", model.ErrInvalidArgument,
+		apiKeyNameLen)
+	errNoScopes    = fmt.Errorf("%w: API keys need at least one scope", model.ErrInvalidArgument)
+	errTooManyKeys = fmt.Errorf("%w: too many active API keys, revoke one first", model.ErrPermissionDenied)
+)
+
+// APIKeyPolicy tells how many API keys users may have, and how long they work
+type APIKeyPolicy struct {
+	MaxPerUser int
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+}
+
+// APIKeys issues, checks and revokes the personal API keys of users
+type APIKeys struct {
+	keys   gateway.APIKeyManager
+	users  gateway.UserManager
+	policy APIKeyPolicy
+	logger *slog.Logger
+}
+
+// NewAPIKeys constructs a new APIKeys
+func NewAPIKeys(k gateway.APIKeyManager, u gateway.UserManager, p APIKeyPolicy, logger *slog.Logger) *APIKeys {
+	return &APIKeys{keys: k, users: u, policy: p, logger: logger}
+}
+
+// Create issues a key of the user with the permission, and returns it with the key itself, which is not kept.
+// Keys work for the default lifetime if days is 0.
+func (a *APIKeys) Create(ctx context.Context, userID uint, perm model.UserPermission, name string,
+	scopes []string, days int) (*model.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > apiKeyNameLen {
+		return nil, "", errAPIKeyName
+	}
+	scopeList, err := parseScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	ttl := a.policy.DefaultTTL
+	if days != 0 {
+		ttl = time.Duration(days) * 24 * time.Hour
+	}
+	if ttl <= 0 || ttl > a.policy.MaxTTL {
+		return nil, "", fmt.Errorf("%w: API keys may work for 1 to %d days", model.ErrInvalidArgument,
+			int(a.policy.MaxTTL/(24*time.Hour)))
+	}
+	keys, err := a.keys.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	active := 0
+	for _, k := range keys {
+		if k.Active(now) {
+			active++
+		}
+	}
+	if active >= a.policy.MaxPerUser {
+		return nil, "", errTooManyKeys
+	}
+	prefix, secret, err := newAPIKeyParts()
+	if err != nil {
+		return nil, "", err
+	}
+	raw := apiKeyTag + "_" + prefix + "_" + secret
+	k := &model.APIKey{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		KeyHash:    hashCode(raw),
+		Scopes:     scopeList,
+		Permission: perm,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if _, err := a.keys.CreateAPIKey(ctx, k); err != nil {
+		return nil, "", err
+	}
+	a.logger.InfoContext(ctx, "API key created", "user_id", userID, "api_key_id", k.ID, "scopes", scopeList)
+	return k, raw, nil
+}
+
+// Authenticate returns the active key of the raw key, and its user
+func (a *APIKeys) Authenticate(ctx context.Context, raw string) (*model.APIKey, *model.User, error) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyTag {
+		return nil, nil, errInvalidAPIKey
+	}
+	k, err := a.keys.GetAPIKeyByPrefix(ctx, parts[1])
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashCode(raw)), []byte(k.KeyHash)) != 1 || !k.Active(now) {
+		return nil, nil, errInvalidAPIKey
+	}
+	user, err := a.users.GetUser(ctx, k.UserID)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedPrecision {
+		// A missed record of use is no reason to refuse the request
+		if err := a.keys.TouchAPIKey(ctx, k.ID, now); err != nil {
+			a.logger.WarnContext(ctx, "Failed to record the use of the API key", "api_key_id", k.ID,
+				logging.KeyError, err)
+		}
+	}
+	return k, user, nil
+}
+
+// List lists the keys of the user, revoked and expired ones too
+func (a *APIKeys) List(ctx context.Context, userID uint) ([]*model.APIKey, error) {
+	return a.keys.ListAPIKeys(ctx, userID)
+}
+
+// Revoke revokes the key of the user
+func (a *APIKeys) Revoke(ctx context.Context, userID, id uint) error {
+	if err := a.keys.RevokeAPIKey(ctx, userID, id); err != nil {
+		return err
+	}
+	a.logger.InfoContext(ctx, "API key revoked", "user_id", userID, "api_key_id", id)
+	return nil
+}
+
+// RevokeAll revokes all keys of the user, and returns how many
+func (a *APIKeys) RevokeAll(ctx context.Context, userID uint) (int64, error) {
+	return a.keys.RevokeAPIKeys(ctx, userID)
+}
+
+// parseScopes checks the scopes, and joins them without duplicates
+func parseScopes(scopes []string) (string, error) {
+	var result []string
+	for _, s := range scopes {
+		if !slices.Contains(model.APIScopes, model.APIScope(s)) {
+			return "", fmt.Errorf("%w: unknown scope %q", model.ErrInvalidArgument, s)
+		}
+		if !slices.Contains(result, s) {
+			result = append(result, s)
+		}
+	}
+	if len(result) == 0 {
+		return "", errNoScopes
+	}
+	return strings.Join(result, " "), nil
+}
+
+func newAPIKeyParts() (prefix, secret string, err error) {
+	b := make([]byte, apiKeyPrefixBytes+apiKeySecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(b[:apiKeyPrefixBytes]), base64.RawURLEncoding.EncodeToString(b[apiKeyPrefixBytes:]), nil
+}
@@ -0,0 +1,197 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+)
+
+// fakeKeys keeps API keys by prefix, like the unique index of the table
+type fakeKeys struct {
+	gateway.APIKeyManager
+	keys    map[string]*model.APIKey
+	touched []uint
+}
+
+func (f *fakeKeys) CreateAPIKey(ctx context.Context, k *model.APIKey) (uint, error) {
+	k.ID = uint(len(f.keys) + 1)
+	f.keys[k.Prefix] = k
+	return k.ID, nil
+}
+
+func (f *fakeKeys) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	if k, ok := f.keys[prefix]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: API key %s", model.ErrNotFound, prefix)
+}
+
+func (f *fakeKeys) ListAPIKeys(ctx context.Context, userID uint) ([]*model.APIKey, error) {
+	var keys []*model.APIKey
+	for _, k := range f.keys {
+		if k.UserID == userID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (f *fakeKeys) TouchAPIKey(ctx context.Context, id uint, t time.Time) error {
+	f.touched = append(f.touched, id)
+	return nil
+}
+
+func newTestAPIKeys() (*APIKeys, *fakeKeys) {
+	keys := &fakeKeys{keys: map[string]*model.APIKey{}}
+	users := &fakeUsers{users: map[uint]*model.User{1: {ID: 1, Email: "a@example.com"}}}
+	policy := APIKeyPolicy{MaxPerUser: 2, DefaultTTL: 24 * time.Hour, MaxTTL: 30 * 24 * time.Hour}
+	return NewAPIKeys(keys, users, policy, testLogger()), keys
+}
+
+func TestCreateAPIKeyKeepsOnlyTheHash(t *testing.T) {
+	a, keys := newTestAPIKeys()
+	k, raw, err := a.Create(context.Background(), 1, model.PermUser, "ci",
+		[]string{"books:read", "books:read", "reviews:write"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] != k.Prefix || len(k.Prefix) != 2*apiKeyPrefixBytes {
+		t.Errorf("raw key %q does not carry the prefix %q", raw, k.Prefix)
+	}
+	stored := keys.keys[k.Prefix]
+	if stored.KeyHash == raw || strings.Contains(stored.KeyHash, parts[2]) || stored.KeyHash != hashCode(raw) {
+		t.Errorf("stored hash %q, want the hash of the key only", stored.KeyHash)
+	}
+	if stored.Scopes != "books:read reviews:write" {
+		t.Errorf("scopes = %q, want them without duplicates", stored.Scopes)
+	}
+}
+
+func TestCreateAPIKeyRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		scopes []string
+		days   int
+	}{
+		{"no name", " ", []string{"books:read"}, 0},
+		{"no scopes", "ci", nil, 0},
+		{"unknown scope", "ci", []string{"books:delete"}, 0},
+		{"too long", "ci", []string{"books:read"}, 31},
+		{"negative lifetime", "ci", []string{"books:read"}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAPIKeys()
+			_, _, err := a.Create(context.Background(), 1, model.PermUser, tt.key, tt.scopes, tt.days)
+			if !errors.Is(err, model.ErrInvalidArgument) {
+				t.Errorf("Create error = %v, want ErrInvalidArgument", err)
+			}
+		})
+	}
+	a, _ := newTestAPIKeys()
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, _, err := a.Create(ctx, 1, model.PermUser, "ci", []string{"books:read"}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := a.Create(ctx, 1, model.PermUser, "ci", []string{"books:read"}, 0); err != errTooManyKeys {
+		t.Errorf("Create over the limit error = %v, want %v", err, errTooManyKeys)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	a, keys := newTestAPIKeys()
+	k, raw, err := a.Create(ctx, 1, model.PermUser, "ci", []string{"books:read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedRaw, err := a.Create(ctx, 1, model.PermUser, "old", []string{"books:read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	revoked.RevokedAt = &now
+	expired := &model.APIKey{ID: 10, UserID: 1, Prefix: "aaaaaaaaaaaa", ExpiresAt: now.Add(-time.Minute)}
+	expired.KeyHash = hashCode("lrb_aaaaaaaaaaaa_secret")
+	keys.keys[expired.Prefix] = expired
+	orphan := &model.APIKey{ID: 11, UserID: 9, Prefix: "bbbbbbbbbbbb", ExpiresAt: now.Add(time.Hour)}
+	orphan.KeyHash = hashCode("lrb_bbbbbbbbbbbb_secret")
+	keys.keys[orphan.Prefix] = orphan
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+	}{
+		{"valid", raw, nil},
+		{"wrong secret", apiKeyTag + "_" + k.Prefix + "_guess", errInvalidAPIKey},
+		{"unknown prefix", apiKeyTag + "_cccccccccccc_secret", errInvalidAPIKey},
+		{"other tag", "xyz" + strings.TrimPrefix(raw, apiKeyTag), errInvalidAPIKey},
+		{"no secret", apiKeyTag + "_" + k.Prefix, errInvalidAPIKey},
+		{"empty", "", errInvalidAPIKey},
+		{"revoked", revokedRaw, errInvalidAPIKey},
+		{"expired", "lrb_aaaaaaaaaaaa_secret", errInvalidAPIKey},
+		{"deleted user", "lrb_bbbbbbbbbbbb_secret", errInvalidAPIKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, user, err := a.Authenticate(ctx, tt.raw)
+			if err != tt.wantErr {
+				t.Fatalf("Authenticate error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.ID != k.ID || user.ID != 1) {
+				t.Errorf("Authenticate = key %d of user %d, want key %d of user 1", got.ID, user.ID, k.ID)
+			}
+		})
+	}
+	if len(keys.touched) != 1 || keys.touched[0] != k.ID {
+		t.Errorf("touched keys = %v, want only %d", keys.touched, k.ID)
+	}
+}
+
+func TestAuthenticateAPIKeyCapsPermission(t *testing.T) {
+	tests := []struct {
+		name     string
+		minted   model.UserPermission
+		user     model.User
+		wantPerm model.UserPermission
+	}{
+		{"author", model.PermAuthor, model.User{IsAuthor: true}, model.PermAuthor},
+		{"author role revoked", model.PermAuthor, model.User{}, model.PermUser},
+		{"admin role revoked", model.PermAdmin, model.User{}, model.PermUser},
+		{"admin now an author only", model.PermAdmin, model.User{IsAuthor: true}, model.PermAuthor},
+		{"user granted the admin role", model.PermUser, model.User{IsAdmin: true}, model.PermUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, _ := newTestAPIKeys()
+			_, raw, err := a.Create(ctx, 1, tt.minted, "ci", []string{"books:write"}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The roles change after the key is minted, like when the provider revokes them
+			user := a.users.(*fakeUsers).users[1]
+			user.IsAdmin, user.IsAuthor = tt.user.IsAdmin, tt.user.IsAuthor
+			u := newTestUserOperator(a.users)
+			u.apiKeys = a
+			id, err := u.AuthenticateAPIKey(ctx, raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Permission != tt.wantPerm {
+				t.Errorf("permission = %v, want %v", id.Permission, tt.wantPerm)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"time"
+
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+	// auditVerifyBatch is how many entries a verification reads at once
+	auditVerifyBatch = 500
+)
+
+type actorKey struct{}
+
+// Actor is who does an operation and from where, as the audit log records it
+type Actor struct {
+	UserID   uint
+	APIKeyID uint
+	IP       string
+}
+
+// WithActor keeps the actor of a request in its context, for the audit log
+func WithActor(ctx context.Context, a *Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// actorFrom returns the actor of the context, anonymous if there is none
+func actorFrom(ctx context.Context) *Actor {
+	if a, ok := ctx.Value(actorKey{}).(*Actor); ok {
+		return a
+	}
+	return &Actor{}
+}
+
+// Audit appends privileged and destructive operations to the audit log, and answers queries on it
+type Audit struct {
+	entries gateway.AuditManager
+	logger  *slog.Logger
+}
+
+// NewAudit constructs a new Audit
+func NewAudit(m gateway.AuditManager, logger *slog.Logger) *Audit {
+	return &Audit{entries: m, logger: logger}
+}
+
+// Record appends an operation of the context's actor on the target to the audit log.
+// before and after are the target before and after the operation, either nil; only the fields that changed are kept.
+// The operation is done already, so a failure is only logged.
+func (a *Audit) Record(ctx context.Context, action, targetType, targetID string, before, after interface{}) {
+	a.record(ctx, actorFrom(ctx), action, targetType, targetID, before, after)
+}
+
+// RecordFor is Record for an operation of the user, who the context does not know yet, like a sign-in
+func (a *Audit) RecordFor(ctx context.Context, userID uint, action, targetType, targetID string,
+	before, after interface{}) {
+	actor := *actorFrom(ctx)
+	actor.UserID = userID
+	a.record(ctx, &actor, action, targetType, targetID, before, after)
+}
+
+func (a *Audit) record(ctx context.Context, actor *Actor, action, targetType, targetID string,
+	before, after interface{}) {
+	e := &model.AuditEntry{
+		ActorID:    actor.UserID,
+		APIKeyID:   actor.APIKeyID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         actor.IP,
+		RequestID:  logging.RequestID(ctx),
+		Salt:       newAuditSalt(),
+		// The databases keep microseconds, and the hash must match what they keep
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	var err error
+	if e.Before, e.After, err = auditDiff(before, after); err == nil {
+		err = a.entries.AppendAudit(ctx, e)
+	}
+	if err != nil {
+		a.logger.ErrorContext(ctx, "Failed to record audit entry", "action", action, "target_type", targetType,
+			"target_id", targetID, "actor_id", actor.UserID, logging.KeyError, err)
+	}
+}
+
+// List lists the entries of the audit log matching the filter, newest first
+func (a *Audit) List(ctx context.Context, f *model.AuditFilter) ([]*dto.AuditEntry, error) {
+	switch {
+	case f.Limit <= 0:
+		f.Limit = auditDefaultLimit
+	case f.Limit > auditMaxLimit:
+		f.Limit = auditMaxLimit
+	}
+	entries, err := a.entries.ListAudit(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return auditDTOs(entries), nil
+}
+
+// Verify walks the audit log from its first entry, and checks that every entry matches its hash
+// and is chained to the entry before it. With an anchor of an earlier verification, it also checks
+// that the log still has the entry that was its head, so that entries dropped from the end are caught.
+func (a *Audit) Verify(ctx context.Context, anchor *dto.AuditAnchor) (*dto.AuditVerification, error) {
+	result := &dto.AuditVerification{Verified: true}
+	var afterID uint
+	for {
+		entries, err := a.entries.ListAuditChain(ctx, afterID, auditVerifyBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch {
+			case e.PrevHash != result.HeadHash:
+				result.Problem = "the entry is not chained to the one before it"
+			case e.ComputeHash() != e.Hash:
+				result.Problem = "the entry does not match its hash"
+			case anchor != nil && result.Entries+1 == anchor.Entries && e.Hash != anchor.HeadHash:
+				result.Problem = "the entry is not the head of the anchor"
+			}
+			if result.Problem != "" {
+				result.BrokenAt = e.ID
+				return a.broken(ctx, result), nil
+			}
+			result.Entries++
+			result.HeadHash = e.Hash
+			afterID = e.ID
+		}
+		if len(entries) < auditVerifyBatch {
+			break
+		}
+	}
+	if anchor != nil && result.Entries < anchor.Entries {
+		result.Problem = "entries of the anchor were removed from the end"
+		return a.broken(ctx, result), nil
+	}
+	result.CheckedAt = time.Now()
+	return result, nil
+}
+
+// broken marks the verification as failed
+func (a *Audit) broken(ctx context.Context, result *dto.AuditVerification) *dto.AuditVerification {
+	result.Verified = false
+	a.logger.WarnContext(ctx, "Audit log broken", "entry_id", result.BrokenAt, "problem", result.Problem)
+	result.CheckedAt = time.Now()
+	return result
+}
+
+// ExportPersonalData adds the entries of operations the user did, or which targeted the user, to the export
+func (a *Audit) ExportPersonalData(ctx context.Context, userID uint, e *dto.DataExport) error {
+	entries, err := a.entries.ListAuditOfUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	e.AuditEntries = append(e.AuditEntries, auditDTOs(entries)...)
+	return nil
+}
+
+// ErasePersonalData pseudonymizes the entries of the user: they are kept, since they record what was done,
+// but their IPs and the fields before and after go. Each keeps a digest of them, so the chain still verifies.
+func (a *Audit) ErasePersonalData(ctx context.Context, userID uint) ([]*dto.ErasureStep, error) {
+	erased, err := a.entries.EraseAuditOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := a.entries.ListAuditOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var left int64
+	for _, e := range entries {
+		if !e.Erased() {
+			left++
+		}
+	}
+	return []*dto.ErasureStep{{Store: storeMySQL, Data: "audit_entries", Action: actionPseudonymized,
+		Count: erased, Remaining: left}}, nil
+}
+
+// newAuditSalt returns a salt too long to guess, so that the digests of erased entries cannot be
+// matched against guesses of what they held, like IPs
+func newAuditSalt() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// The entry is still chained; only its digest would be easier to guess once erased
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// auditDiff encodes the fields of before and after that differ as JSON objects, empty if there are none
+func auditDiff(before, after interface{}) (string, string, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return "", "", err
+	}
+	a, err := auditFields(after)
+	if err != nil {
+		return "", "", err
+	}
+	for k, v := range b {
+		if w, ok := a[k]; ok && reflect.DeepEqual(v, w) {
+			delete(b, k)
+			delete(a, k)
+		}
+	}
+	bs, err := encodeFields(b)
+	if err != nil {
+		return "", "", err
+	}
+	as, err := encodeFields(a)
+	return bs, as, err
+}
+
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("audit values must encode as JSON objects: %w", err)
+	}
+	return fields, nil
+}
+
+func encodeFields(fields map[string]interface{}) (string, error) {
+	if len(fields) == 0 {
+		return "", nil
+	}
+	// Maps encode with sorted keys, so that equal values encode alike
+	data, err := json.Marshal(fields)
+	return string(data), err
+}
+
+func auditDTOs(entries []*model.AuditEntry) []*dto.AuditEntry {
+	result := make([]*dto.AuditEntry, len(entries))
+	for i, e := range entries {
+		result[i] = &dto.AuditEntry{
+			ID:         e.ID,
+			ActorID:    e.ActorID,
+			APIKeyID:   e.APIKeyID,
+			Action:     e.Action,
+			TargetType: e.TargetType,
+			TargetID:   e.TargetID,
+			IP:         e.IP,
+			RequestID:  e.RequestID,
+			CreatedAt:  e.CreatedAt,
+			PrevHash:   e.PrevHash,
+			Hash:       e.Hash,
+			Erased:     e.Erased(),
+		}
+		if e.Before != "" {
+			result[i].Before = json.RawMessage(e.Before)
+		}
+		if e.After != "" {
+			result[i].After = json.RawMessage(e.After)
+		}
+	}
+	return result
+}
+
+// idString formats an ID as the target ID of an audit entry
+func idString(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,102 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/domain/model"
+)
+
+func TestAuditVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// tamper changes the log of five entries, after the anchor of its third entry was taken
+		tamper       func(c *chainAudit)
+		anchored     bool
+		wantVerified bool
+		wantBrokenAt uint
+	}{
+		{"intact", func(c *chainAudit) {}, false, true, 0},
+		{"intact, anchored", func(c *chainAudit) {}, true, true, 0},
+		{"entry changed", func(c *chainAudit) { c.entries[1].TargetID = "99" }, false, false, 2},
+		{"entry removed", func(c *chainAudit) { c.entries = append(c.entries[:2], c.entries[3:]...) }, false, false, 4},
+		{"entry erased", func(c *chainAudit) { c.entries[1].Erase() }, false, true, 0},
+		{"erased entry changed", func(c *chainAudit) {
+			c.entries[1].Erase()
+			c.entries[1].ErasedDigest = "forged"
+		}, false, false, 2},
+		{"end dropped", func(c *chainAudit) { c.entries = c.entries[:2] }, false, true, 0},
+		{"end dropped, anchored", func(c *chainAudit) { c.entries = c.entries[:2] }, true, false, 0},
+		{"end replaced, anchored", func(c *chainAudit) {
+			c.entries = c.entries[:2]
+			c.AppendAudit(context.Background(), &model.AuditEntry{Action: "forged"})
+		}, true, false, 3},
+	}
+	logger := testLogger()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &chainAudit{}
+			a := NewAudit(chain, logger)
+			ctx := context.Background()
+			for i := 0; i < 3; i++ {
+				a.Record(ctx, model.AuditBookUpdate, model.AuditTargetBook, idString(uint(i)), nil, nil)
+			}
+			head, err := a.Verify(ctx, nil)
+			if err != nil || !head.Verified || head.Entries != 3 {
+				t.Fatalf("Verify of a fresh log = %+v, %v", head, err)
+			}
+			for i := 3; i < 5; i++ {
+				a.Record(ctx, model.AuditBookUpdate, model.AuditTargetBook, idString(uint(i)), nil, nil)
+			}
+			tt.tamper(chain)
+			var anchor *dto.AuditAnchor
+			if tt.anchored {
+				anchor = &dto.AuditAnchor{Entries: head.Entries, HeadHash: head.HeadHash}
+			}
+			result, err := a.Verify(ctx, anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Verified != tt.wantVerified || result.BrokenAt != tt.wantBrokenAt {
+				t.Errorf("Verify = verified %v, broken at %d (%s); want %v, %d", result.Verified, result.BrokenAt,
+					result.Problem, tt.wantVerified, tt.wantBrokenAt)
+			}
+		})
+	}
+}
+
+func TestAuditErasePersonalData(t *testing.T) {
+	chain := &chainAudit{}
+	a := NewAudit(chain, testLogger())
+	user := WithActor(context.Background(), &Actor{UserID: 7, IP: "203.0.113.7"})
+	admin := WithActor(context.Background(), &Actor{UserID: 1, IP: "198.51.100.1"})
+	review := map[string]string{"author": "Ann", "content": "Loved it"}
+	a.Record(user, model.AuditReviewUpdate, model.AuditTargetReview, "r1", review, nil)
+	a.Record(admin, model.AuditRoleChange, model.AuditTargetUser, "7", nil, map[string]bool{"admin": true})
+	a.Record(admin, model.AuditBookUpdate, model.AuditTargetBook, "3", nil, map[string]string{"title": "Dune"})
+
+	steps, err := a.ErasePersonalData(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dto.ErasureStep{Store: storeMySQL, Data: "audit_entries", Action: actionPseudonymized, Count: 2}
+	if len(steps) != 1 || *steps[0] != want {
+		t.Errorf("ErasePersonalData = %+v, want %+v", steps, want)
+	}
+	for _, e := range chain.entries[:2] {
+		if e.IP != "" || e.Before != "" || e.After != "" || e.Salt != "" || !e.Erased() {
+			t.Errorf("entry %d of the user kept personal fields: %+v", e.ID, e)
+		}
+	}
+	if other := chain.entries[2]; other.IP != "198.51.100.1" || other.After == "" {
+		t.Errorf("entry of another user was erased: %+v", other)
+	}
+	result, err := a.Verify(context.Background(), nil)
+	if err != nil || !result.Verified || result.Entries != 3 {
+		t.Errorf("Verify after the erasure = %+v, %v", result, err)
+	}
+	if steps, err := a.ErasePersonalData(context.Background(), 7); err != nil || steps[0].Count != 0 {
+		t.Errorf("a second erasure = %+v, %v, want nothing left to erase", steps[0], err)
+	}
+}
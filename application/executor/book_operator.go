@@ -5,88 +5,242 @@ package executor
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strconv"
 
+	"literank.com/rest-books/application/dto"
 	"literank.com/rest-books/domain/gateway"
 	"literank.com/rest-books/domain/model"
 	"literank.com/rest-books/infrastructure/cache"
+	"literank.com/rest-books/infrastructure/tracing"
 )
 
-const booksKey = "lr-books"
+// Book change actions
+const (
+	BookCreated = "created"
+	BookUpdated = "updated"
+	BookDeleted = "deleted"
+)
+
+// BookEvent describes a change made to a book.
+type BookEvent struct {
+	Action string      `json:"action"`
+	BookID uint        `json:"book_id"`
+	Book   *model.Book `json:"book,omitempty"`
+}
+
+// BookListener is notified after a book has been changed.
+type BookListener func(ctx context.Context, e *BookEvent)
 
 // BookOperator handles book input/output and proxies operations to the book manager.
 type BookOperator struct {
 	bookManager gateway.BookManager
-	cacheHelper cache.Helper
+	cache       *cache.Cache
+	audit       *Audit
+	logger      *slog.Logger
+	listeners   []BookListener
 }
 
 // NewBookOperator constructs a new BookOperator
-func NewBookOperator(b gateway.BookManager, c cache.Helper) *BookOperator {
-	return &BookOperator{bookManager: b, cacheHelper: c}
+func NewBookOperator(b gateway.BookManager, c *cache.Cache, a *Audit, logger *slog.Logger) *BookOperator {
+	return &BookOperator{bookManager: b, cache: c, audit: a, logger: logger}
+}
+
+// AddListener registers a listener for book changes
+func (o *BookOperator) AddListener(l BookListener) {
+	o.listeners = append(o.listeners, l)
+}
+
+func (o *BookOperator) notify(ctx context.Context, e *BookEvent) {
+	for _, l := range o.listeners {
+		l(ctx, e)
+	}
 }
 
 // CreateBook creates a new book
 func (o *BookOperator) CreateBook(ctx context.Context, b *model.Book) (*model.Book, error) {
-	id, err := o.bookManager.CreateBook(ctx, b)
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.CreateBook")
+	defer span.End()
+	id, err := o.bookManager.CreateBook(ctx, b, actorFrom(ctx).UserID)
 	if err != nil {
 		return nil, err
 	}
 	b.ID = id
+	o.forget(ctx, id)
+	o.logger.InfoContext(ctx, "Book created", "book_id", id)
+	o.audit.Record(ctx, model.AuditBookCreate, model.AuditTargetBook, idString(id), nil, b)
+	o.notify(ctx, &BookEvent{Action: BookCreated, BookID: id, Book: b})
 	return b, nil
 }
 
-// GetBook gets a book by ID
+// GetBook gets a book by ID, and caches it if needed
 func (o *BookOperator) GetBook(ctx context.Context, id uint) (*model.Book, error) {
-	return o.bookManager.GetBook(ctx, id)
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.GetBook")
+	defer span.End()
+	key := strconv.FormatUint(uint64(id), 10)
+	book := &model.Book{}
+	if loadCache(ctx, o.cache, o.logger, cache.FamilyBooks, key, book) {
+		return book, nil
+	}
+	book, err := o.bookManager.GetBook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	saveCache(ctx, o.cache, o.logger, cache.FamilyBooks, key, book)
+	return book, nil
 }
 
 // GetBooks gets a list of books by offset and keyword, and caches its result if needed
 func (o *BookOperator) GetBooks(ctx context.Context, offset int, query string) ([]*model.Book, error) {
-	// Search results, don't cache it
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.GetBooks")
+	defer span.End()
+	family, key := cache.FamilyBookPages, strconv.Itoa(offset)
 	if query != "" {
-		return o.bookManager.GetBooks(ctx, offset, query)
+		family, key = cache.FamilySearches, fmt.Sprintf("%d:%s", offset, query)
 	}
-
-	// Normal list of results
-	k := fmt.Sprintf("%s-%d", booksKey, offset)
-	rawValue, err := o.cacheHelper.Load(ctx, k)
+	books := make([]*model.Book, 0)
+	if loadCache(ctx, o.cache, o.logger, family, key, &books) {
+		return books, nil
+	}
+	books, err := o.bookManager.GetBooks(ctx, offset, query)
 	if err != nil {
 		return nil, err
 	}
-
-	books := make([]*model.Book, 0)
-	if rawValue != "" {
-		// Cache key exists
-		if err = json.Unmarshal([]byte(rawValue), &books); err != nil {
-			return nil, err
-		}
-	} else {
-		// Cache key does not exist
-		books, err = o.bookManager.GetBooks(ctx, offset, "")
-		if err != nil {
-			return nil, err
-		}
-		value, err := json.Marshal(books)
-		if err != nil {
-			return nil, err
-		}
-		if err := o.cacheHelper.Save(ctx, k, string(value)); err != nil {
-			return nil, err
-		}
-	}
+	saveCache(ctx, o.cache, o.logger, family, key, books)
 	return books, nil
 }
 
+// forget drops the cached book and all cached pages and searches, which may list it, so that none is served stale
+func (o *BookOperator) forget(ctx context.Context, id uint) {
+	deleteCache(ctx, o.cache, o.logger, cache.FamilyBooks, strconv.FormatUint(uint64(id), 10))
+	invalidateCache(ctx, o.cache, o.logger, cache.FamilyBookPages, cache.FamilySearches)
+}
+
 // UpdateBook updates a book by its ID and the new content
 func (o *BookOperator) UpdateBook(ctx context.Context, id uint, b *model.Book) (*model.Book, error) {
-	if err := o.bookManager.UpdateBook(ctx, id, b); err != nil {
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.UpdateBook")
+	defer span.End()
+	before, err := o.bookManager.GetBook(ctx, id)
+	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	if err := o.bookManager.UpdateBook(ctx, id, b, actorFrom(ctx).UserID); err != nil {
+		return nil, err
+	}
+	b.ID = id
+	o.forget(ctx, id)
+	// The update leaves out zero fields, so listeners get the book as stored, not the request
+	after := o.stored(ctx, b)
+	o.logger.InfoContext(ctx, "Book updated", "book_id", id)
+	o.audit.Record(ctx, model.AuditBookUpdate, model.AuditTargetBook, idString(id), before, after)
+	o.notify(ctx, &BookEvent{Action: BookUpdated, BookID: id, Book: after})
+	return after, nil
 }
 
 // DeleteBook deletes a book by ID
 func (o *BookOperator) DeleteBook(ctx context.Context, id uint) error {
-	return o.bookManager.DeleteBook(ctx, id)
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.DeleteBook")
+	defer span.End()
+	before, err := o.bookManager.GetBook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := o.bookManager.DeleteBook(ctx, id); err != nil {
+		return err
+	}
+	o.forget(ctx, id)
+	o.logger.InfoContext(ctx, "Book deleted", "book_id", id)
+	o.audit.Record(ctx, model.AuditBookDelete, model.AuditTargetBook, idString(id), before, nil)
+	o.notify(ctx, &BookEvent{Action: BookDeleted, BookID: id})
+	return nil
+}
+
+// RevertBook restores a book to an earlier revision, which is kept as a new revision
+func (o *BookOperator) RevertBook(ctx context.Context, id, rev uint) (*model.Book, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.RevertBook")
+	defer span.End()
+	before, err := o.bookManager.GetBook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.bookManager.RevertBook(ctx, id, rev, actorFrom(ctx).UserID)
+	if err != nil {
+		return nil, err
+	}
+	o.forget(ctx, id)
+	b, err := o.bookManager.GetBook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	o.logger.InfoContext(ctx, "Book reverted", "book_id", id, "rev", rev, "new_rev", r.Rev)
+	o.audit.Record(ctx, model.AuditBookRevert, model.AuditTargetBook, idString(id), before, b)
+	o.notify(ctx, &BookEvent{Action: BookUpdated, BookID: id, Book: b})
+	return b, nil
+}
+
+// GetBookRevisions gets a page of the revisions of a book, the latest first
+func (o *BookOperator) GetBookRevisions(ctx context.Context, id uint, offset int) ([]*model.BookRevision, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.GetBookRevisions")
+	defer span.End()
+	return o.bookManager.GetBookRevisions(ctx, id, offset)
+}
+
+// GetBookRevision gets a revision of a book
+func (o *BookOperator) GetBookRevision(ctx context.Context, id, rev uint) (*model.BookRevision, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.GetBookRevision")
+	defer span.End()
+	return o.bookManager.GetBookRevision(ctx, id, rev)
+}
+
+// DiffRevisions lists the fields that differ from revision from to revision rev of a book.
+// from defaults to the revision before rev; the first revision is compared with an empty book.
+func (o *BookOperator) DiffRevisions(ctx context.Context, id, rev, from uint) (*dto.RevisionDiff, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "BookOperator.DiffRevisions")
+	defer span.End()
+	to, err := o.bookManager.GetBookRevision(ctx, id, rev)
+	if err != nil {
+		return nil, err
+	}
+	if from == 0 {
+		from = rev - 1
+	}
+	base := &model.BookRevision{}
+	if from > 0 {
+		if base, err = o.bookManager.GetBookRevision(ctx, id, from); err != nil {
+			return nil, err
+		}
+	}
+	return &dto.RevisionDiff{BookID: id, From: from, To: rev, Changes: diffRevisions(base, to)}, nil
+}
+
+// diffRevisions lists the fields of the book that changed between the revisions, in the order of the book
+func diffRevisions(from, to *model.BookRevision) []*dto.FieldChange {
+	fields := []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"title", from.Title, to.Title},
+		{"author", from.Author, to.Author},
+		{"published_at", from.PublishedAt, to.PublishedAt},
+		{"description", from.Description, to.Description},
+		{"isbn", from.ISBN, to.ISBN},
+		{"total_pages", from.TotalPages, to.TotalPages},
+	}
+	changes := make([]*dto.FieldChange, 0)
+	for _, f := range fields {
+		if f.before != f.after {
+			changes = append(changes, &dto.FieldChange{Field: f.name, Before: f.before, After: f.after})
+		}
+	}
+	return changes
+}
+
+// stored reads the book back as the update left it, or returns the request if that fails
+func (o *BookOperator) stored(ctx context.Context, b *model.Book) *model.Book {
+	stored, err := o.bookManager.GetBook(ctx, b.ID)
+	if err != nil {
+		return b
+	}
+	return stored
 }
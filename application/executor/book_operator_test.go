@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/cache"
+	"literank.com/rest-books/infrastructure/config"
+)
+
+// fakeBooks keeps books in a map, and counts the list queries that reach it
+type fakeBooks struct {
+	gateway.BookManager
+	books   map[uint]*model.Book
+	queries int
+}
+
+func (f *fakeBooks) CreateBook(ctx context.Context, b *model.Book, editorID uint) (uint, error) {
+	b.ID = uint(len(f.books) + 1)
+	f.books[b.ID] = b
+	return b.ID, nil
+}
+
+func (f *fakeBooks) GetBook(ctx context.Context, id uint) (*model.Book, error) {
+	if b, ok := f.books[id]; ok {
+		stored := *b
+		return &stored, nil
+	}
+	return nil, fmt.Errorf("%w: book %d", model.ErrNotFound, id)
+}
+
+func (f *fakeBooks) UpdateBook(ctx context.Context, id uint, b *model.Book, editorID uint) error {
+	f.books[id].Title = b.Title
+	return nil
+}
+
+func (f *fakeBooks) DeleteBook(ctx context.Context, id uint) error {
+	delete(f.books, id)
+	return nil
+}
+
+func (f *fakeBooks) GetBooks(ctx context.Context, offset int, keyword string) ([]*model.Book, error) {
+	f.queries++
+	result := make([]*model.Book, 0)
+	for id := uint(1); id <= uint(len(f.books))+1; id++ {
+		if b, ok := f.books[id]; ok {
+			result = append(result, b)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeBooks) RevertBook(ctx context.Context, id, rev uint, editorID uint) (*model.BookRevision, error) {
+	f.books[id].Title = "Dune"
+	return &model.BookRevision{BookID: id, Rev: rev + 1}, nil
+}
+
+func TestBookWritesInvalidateLists(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(ctx context.Context, o *BookOperator) error
+	}{
+		{"create", func(ctx context.Context, o *BookOperator) error {
+			_, err := o.CreateBook(ctx, &model.Book{Title: "Emma"})
+			return err
+		}},
+		{"update", func(ctx context.Context, o *BookOperator) error {
+			_, err := o.UpdateBook(ctx, 1, &model.Book{Title: "Dune Messiah"})
+			return err
+		}},
+		{"delete", func(ctx context.Context, o *BookOperator) error { return o.DeleteBook(ctx, 1) }},
+		{"revert", func(ctx context.Context, o *BookOperator) error {
+			_, err := o.RevertBook(ctx, 1, 1)
+			return err
+		}},
+	}
+	on := config.CachePolicy{Enabled: true}
+	cc := &config.CacheConfig{Policies: config.CachePolicies{BookPages: on, Books: on, Searches: on}}
+	logger := testLogger()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			books := &fakeBooks{books: map[uint]*model.Book{1: {ID: 1, Title: "Dune"}}}
+			o := NewBookOperator(books, cache.NewCache(memCounter{}, cc), NewAudit(&chainAudit{}, logger), logger)
+			for _, query := range []string{"", "dune"} {
+				for i := 0; i < 2; i++ {
+					if _, err := o.GetBooks(ctx, 0, query); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if books.queries != 2 {
+				t.Fatalf("lists reached the database %d times before the write, want 2", books.queries)
+			}
+			if err := tt.write(ctx, o); err != nil {
+				t.Fatal(err)
+			}
+			for _, query := range []string{"", "dune"} {
+				got, err := o.GetBooks(ctx, 0, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, _ := books.GetBooks(ctx, 0, query)
+				books.queries--
+				if len(got) != len(want) || len(got) > 0 && got[0].Title != want[0].Title {
+					t.Errorf("list %q after the %s = %+v, want %+v", query, tt.name, got, want)
+				}
+			}
+			if books.queries != 4 {
+				t.Errorf("lists reached the database %d times, want 4: the write left them cached", books.queries)
+			}
+		})
+	}
+}
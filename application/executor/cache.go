@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"context"
+	"log/slog"
+
+	"literank.com/rest-books/infrastructure/cache"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+// loadCache reads the cached value into v, and tells if it was there.
+// A failing cache is taken as empty, so that the databases still serve.
+func loadCache(ctx context.Context, c *cache.Cache, logger *slog.Logger, f cache.Family, key string,
+	v interface{}) bool {
+	found, err := c.Load(ctx, f, key, v)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to read cache", "family", f, "key", key, logging.KeyError, err)
+		return false
+	}
+	logger.DebugContext(ctx, "Cache lookup", "family", f, "key", key, "hit", found)
+	return found
+}
+
+func saveCache(ctx context.Context, c *cache.Cache, logger *slog.Logger, f cache.Family, key string, v interface{}) {
+	if err := c.Save(ctx, f, key, v); err != nil {
+		logger.WarnContext(ctx, "Failed to write cache", "family", f, "key", key, logging.KeyError, err)
+	}
+}
+
+// deleteCache drops the cached values, so that they are not served stale
+func deleteCache(ctx context.Context, c *cache.Cache, logger *slog.Logger, f cache.Family, keys ...string) {
+	if err := c.Delete(ctx, f, keys...); err != nil {
+		logger.WarnContext(ctx, "Failed to delete from cache", "family", f, "keys", keys, logging.KeyError, err)
+	}
+}
+
+// invalidateCache drops all values of the families, so that no list is served stale
+func invalidateCache(ctx context.Context, c *cache.Cache, logger *slog.Logger, families ...cache.Family) {
+	for _, f := range families {
+		if err := c.Invalidate(ctx, f); err != nil {
+			logger.WarnContext(ctx, "Failed to invalidate cache", "family", f, logging.KeyError, err)
+		}
+	}
+}
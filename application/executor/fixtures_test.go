@@ -0,0 +1,125 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/token"
+)
+
+// testLogger returns a logger that drops everything
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// fakeUsers serves users from a map; other methods of the gateway are not called by these tests
+type fakeUsers struct {
+	gateway.UserManager
+	users map[uint]*model.User
+}
+
+func (f *fakeUsers) GetUser(ctx context.Context, id uint) (*model.User, error) {
+	if u, ok := f.users[id]; ok {
+		return u, nil
+	}
+	return nil, fmt.Errorf("%w: user %d", model.ErrNotFound, id)
+}
+
+func (f *fakeUsers) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: user %s", model.ErrNotFound, email)
+}
+
+// chainAudit chains entries like the database does
+type chainAudit struct {
+	gateway.AuditManager
+	entries []*model.AuditEntry
+}
+
+func (c *chainAudit) AppendAudit(ctx context.Context, e *model.AuditEntry) error {
+	e.ID = uint(len(c.entries) + 1)
+	if n := len(c.entries); n > 0 {
+		e.PrevHash = c.entries[n-1].Hash
+	}
+	e.Hash = e.ComputeHash()
+	c.entries = append(c.entries, e)
+	return nil
+}
+
+func (c *chainAudit) ListAuditChain(ctx context.Context, afterID uint, limit int) ([]*model.AuditEntry, error) {
+	result := make([]*model.AuditEntry, 0)
+	for _, e := range c.entries {
+		if e.ID > afterID && len(result) < limit {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (c *chainAudit) ListAuditOfUser(ctx context.Context, userID uint) ([]*model.AuditEntry, error) {
+	result := make([]*model.AuditEntry, 0)
+	for _, e := range c.entries {
+		if e.ActorID == userID || e.TargetType == model.AuditTargetUser && e.TargetID == idString(userID) {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (c *chainAudit) EraseAuditOfUser(ctx context.Context, userID uint) (int64, error) {
+	entries, _ := c.ListAuditOfUser(ctx, userID)
+	var n int64
+	for _, e := range entries {
+		if !e.Erased() {
+			e.Erase()
+			n++
+		}
+	}
+	return n, nil
+}
+
+// memCounter is a cache.Counter over a map
+type memCounter map[string]string
+
+func (m memCounter) Save(ctx context.Context, key, value string, ttl time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func (m memCounter) Load(ctx context.Context, key string) (string, error) {
+	return m[key], nil
+}
+
+func (m memCounter) Delete(ctx context.Context, keys ...string) error {
+	for _, k := range keys {
+		delete(m, k)
+	}
+	return nil
+}
+
+func (m memCounter) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	n, _ := strconv.ParseInt(m[key], 10, 64)
+	m[key] = strconv.FormatInt(n+1, 10)
+	return n + 1, nil
+}
+
+// newTestUserOperator returns a UserOperator over the users, with tokens signed by "secret", no lockout policy,
+// optional two-factor authentication and an audit log in memory. Tests replace the parts they look at.
+func newTestUserOperator(users gateway.UserManager) *UserOperator {
+	logger := testLogger()
+	keeper := token.NewTokenKeeper("secret", 1)
+	audit := NewAudit(&chainAudit{}, logger)
+	return &UserOperator{userManager: users, permManager: keeper, audit: audit,
+		lockout: NewLockout(memCounter{}, LockoutPolicy{}, audit, logger),
+		mfa:     NewMFA(users, keeper, MFAPolicy{ChallengeTTL: time.Minute}, logger), logger: logger}
+}
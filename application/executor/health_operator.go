@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const pingTimeout = 2 * time.Second
+
+// Dependency statuses
+const (
+	DependencyUp   = "up"
+	DependencyDown = "down"
+)
+
+// Readiness statuses
+const (
+	StatusReady    = "ready"
+	StatusDegraded = "degraded"
+	StatusUnready  = "unready"
+)
+
+// Lifecycle phases
+const (
+	PhaseStarting = "starting"
+	PhaseServing  = "serving"
+	PhaseDraining = "draining"
+)
+
+// Dependency is a backend the app depends on
+type Dependency struct {
+	Name string
+	// Critical dependencies make the app unready when down, the others only degrade it
+	Critical bool
+	Ping     func(ctx context.Context) error
+}
+
+// HealthOperator checks the dependencies and tracks the lifecycle phase of the app.
+type HealthOperator struct {
+	deps   []*Dependency
+	phase  atomic.Value
+	logger *slog.Logger
+}
+
+// NewHealthOperator constructs a new HealthOperator in the starting phase
+func NewHealthOperator(logger *slog.Logger, deps ...*Dependency) *HealthOperator {
+	o := &HealthOperator{deps: deps, logger: logger}
+	o.phase.Store(PhaseStarting)
+	return o
+}
+
+// SetPhase moves the app into the lifecycle phase
+func (o *HealthOperator) SetPhase(phase string) {
+	o.phase.Store(phase)
+}
+
+// Phase returns the lifecycle phase of the app
+func (o *HealthOperator) Phase() string {
+	return o.phase.Load().(string)
+}
+
+// Readiness pings every dependency at once and tells if the app can serve traffic.
+// Why a dependency is down is logged only, as readiness is public.
+func (o *HealthOperator) Readiness(ctx context.Context) *dto.Readiness {
+	statuses := make([]*dto.DependencyStatus, len(o.deps))
+	var wg sync.WaitGroup
+	for i, d := range o.deps {
+		wg.Add(1)
+		go func(i int, d *Dependency) {
+			defer wg.Done()
+			statuses[i] = o.ping(ctx, d)
+		}(i, d)
+	}
+	wg.Wait()
+
+	r := &dto.Readiness{Status: StatusReady, Phase: o.Phase(), Dependencies: statuses}
+	for _, s := range statuses {
+		if s.Status == DependencyUp {
+			continue
+		}
+		if s.Critical {
+			r.Status = StatusUnready
+			break
+		}
+		r.Status = StatusDegraded
+	}
+	if r.Phase != PhaseServing {
+		r.Status = StatusUnready
+	}
+	return r
+}
+
+func (o *HealthOperator) ping(ctx context.Context, d *Dependency) *dto.DependencyStatus {
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := d.Ping(pingCtx)
+	s := &dto.DependencyStatus{Name: d.Name, Status: DependencyUp, Critical: d.Critical}
+	if err != nil {
+		s.Status = DependencyDown
+		o.logger.WarnContext(ctx, "Dependency down", "dependency", d.Name, "critical", d.Critical,
+			"elapsed", time.Since(start), logging.KeyError, err)
+	}
+	return s
+}
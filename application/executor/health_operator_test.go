@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestReadinessKeepsErrorsInTheLogs(t *testing.T) {
+	const reason = "dial tcp 10.0.0.5:3306: connection refused"
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New(reason) }
+	tests := []struct {
+		name       string
+		phase      string
+		mysql      func(ctx context.Context) error
+		redis      func(ctx context.Context) error
+		wantStatus string
+		wantLogged bool
+	}{
+		{"all up", PhaseServing, up, up, StatusReady, false},
+		{"cache down", PhaseServing, up, down, StatusDegraded, true},
+		{"database down", PhaseServing, down, up, StatusUnready, true},
+		{"draining", PhaseDraining, up, up, StatusUnready, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			o := NewHealthOperator(slog.New(slog.NewTextHandler(&logs, nil)),
+				&Dependency{Name: "mysql", Critical: true, Ping: tt.mysql},
+				&Dependency{Name: "redis", Ping: tt.redis})
+			o.SetPhase(tt.phase)
+			r := o.Readiness(context.Background())
+			if r.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", r.Status, tt.wantStatus)
+			}
+			body, err := json.Marshal(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(body), "10.0.0.5") {
+				t.Errorf("readiness %s tells why a dependency is down", body)
+			}
+			if logged := strings.Contains(logs.String(), "10.0.0.5"); logged != tt.wantLogged {
+				t.Errorf("reason logged = %v, want %v", logged, tt.wantLogged)
+			}
+		})
+	}
+}
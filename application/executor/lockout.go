@@ -0,0 +1,206 @@
+package executor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/cache"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const (
+	lockoutPrefix = "lr:lockout"
+	lockAccount   = "account"
+	lockIP        = "ip"
+)
+
+var errLockedOut = fmt.Errorf("%w: too many failed sign-ins, try again later", model.ErrTooManyRequests)
+
+// LockoutPolicy tells when failed sign-ins lock accounts and IPs out
+type LockoutPolicy struct {
+	// MaxFailures and MaxIPFailures are the failures within Window that lock an account or an IP, never if 0.
+	MaxFailures   int
+	MaxIPFailures int
+	Window        time.Duration
+	Duration      time.Duration
+	// Delay is how late the first failure is answered, doubled with every other one up to MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+// Lockout tracks failed sign-ins per account and per IP in the cache backend.
+// Accounts are tracked by email whether they exist or not, so that lockouts tell nothing about them.
+// While the cache backend fails, sign-ins are not limited.
+type Lockout struct {
+	store  cache.Counter
+	policy LockoutPolicy
+	audit  *Audit
+	logger *slog.Logger
+}
+
+// NewLockout constructs a new Lockout
+func NewLockout(store cache.Counter, p LockoutPolicy, a *Audit, logger *slog.Logger) *Lockout {
+	return &Lockout{store: store, policy: p, audit: a, logger: logger}
+}
+
+// Check fails if the account or the IP is locked out
+func (l *Lockout) Check(ctx context.Context, email, ip string) error {
+	for _, key := range l.lockKeys(email, ip) {
+		locked, err := l.store.Load(ctx, key)
+		if err != nil {
+			l.logger.WarnContext(ctx, "Failed to check lockout", logging.KeyError, err)
+			return nil
+		}
+		if locked != "" {
+			return errLockedOut
+		}
+	}
+	return nil
+}
+
+// Fail counts a failed sign-in, locks the account or the IP out when it has failed too often,
+// and answers late, more so with every failure
+func (l *Lockout) Fail(ctx context.Context, email, ip string) {
+	failures := 0
+	if l.policy.MaxFailures > 0 {
+		failures = l.count(ctx, lockAccount, accountKey(email), l.policy.MaxFailures)
+	}
+	if l.policy.MaxIPFailures > 0 && ip != "" {
+		l.count(ctx, lockIP, ip, l.policy.MaxIPFailures)
+	}
+	l.delay(ctx, failures)
+}
+
+// Succeed forgets the failures of the account
+func (l *Lockout) Succeed(ctx context.Context, email string) {
+	if l.policy.MaxFailures == 0 {
+		return
+	}
+	if err := l.store.Delete(ctx, failuresKey(lockAccount, accountKey(email))); err != nil {
+		l.logger.WarnContext(ctx, "Failed to reset sign-in failures", logging.KeyError, err)
+	}
+}
+
+// Unlock lifts the lockouts of the account and the IP, and forgets their failures. Either may be empty.
+func (l *Lockout) Unlock(ctx context.Context, email, ip string) error {
+	keys := make([]string, 0, 4)
+	if email != "" {
+		keys = append(keys, lockKey(lockAccount, accountKey(email)), failuresKey(lockAccount, accountKey(email)))
+	}
+	if ip != "" {
+		keys = append(keys, lockKey(lockIP, ip), failuresKey(lockIP, ip))
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: email or ip is required", model.ErrInvalidArgument)
+	}
+	return l.store.Delete(ctx, keys...)
+}
+
+// Forget drops the failures and the lockout of the account.
+// It returns how many of their keys there were, and how many a check afterwards still found.
+func (l *Lockout) Forget(ctx context.Context, email string) (int64, int64, error) {
+	keys := []string{lockKey(lockAccount, accountKey(email)), failuresKey(lockAccount, accountKey(email))}
+	found, err := l.present(ctx, keys)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := l.store.Delete(ctx, keys...); err != nil {
+		return 0, 0, err
+	}
+	left, err := l.present(ctx, keys)
+	if err != nil {
+		return 0, 0, err
+	}
+	return found, left, nil
+}
+
+// present counts the keys that are in the store
+func (l *Lockout) present(ctx context.Context, keys []string) (int64, error) {
+	var n int64
+	for _, key := range keys {
+		value, err := l.store.Load(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if value != "" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// count adds a failure of the account or IP, locks it out at the limit, and returns its failures.
+// Accounts go by the hash of their email, also in the log.
+func (l *Lockout) count(ctx context.Context, kind, id string, limit int) int {
+	n, err := l.store.Incr(ctx, failuresKey(kind, id), l.policy.Window)
+	if err != nil {
+		l.logger.WarnContext(ctx, "Failed to count sign-in failure", logging.KeyError, err)
+		return 0
+	}
+	if int(n) < limit {
+		return int(n)
+	}
+	until := time.Now().Add(l.policy.Duration)
+	if err := l.store.Save(ctx, lockKey(kind, id), until.Format(time.RFC3339), l.policy.Duration); err != nil {
+		l.logger.WarnContext(ctx, "Failed to lock out", logging.KeyError, err)
+		return int(n)
+	}
+	// Failures are counted afresh after the lockout
+	if err := l.store.Delete(ctx, failuresKey(kind, id)); err != nil {
+		l.logger.WarnContext(ctx, "Failed to reset sign-in failures", logging.KeyError, err)
+	}
+	l.logger.WarnContext(ctx, "Sign-in lockout", "target", kind, kind, id, "failures", n, "until", until)
+	l.audit.Record(ctx, model.AuditLockout, kind, id, nil, map[string]interface{}{"failures": n, "until": until})
+	return int(n)
+}
+
+// delay waits longer for every failure of the account, unless the request is gone
+func (l *Lockout) delay(ctx context.Context, failures int) {
+	if l.policy.Delay <= 0 || failures == 0 {
+		return
+	}
+	d := l.policy.Delay
+	for i := 1; i < failures && d < l.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if l.policy.MaxDelay > 0 && d > l.policy.MaxDelay {
+		d = l.policy.MaxDelay
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+func (l *Lockout) lockKeys(email, ip string) []string {
+	keys := make([]string, 0, 2)
+	if l.policy.MaxFailures > 0 {
+		keys = append(keys, lockKey(lockAccount, accountKey(email)))
+	}
+	if l.policy.MaxIPFailures > 0 && ip != "" {
+		keys = append(keys, lockKey(lockIP, ip))
+	}
+	return keys
+}
+
+// accountKey identifies the account of the email, without keeping the email in the cache
+func accountKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:16])
+}
+
+func failuresKey(kind, id string) string {
+	return lockoutPrefix + ":failures:" + kind + ":" + id
+}
+
+func lockKey(kind, id string) string {
+	return lockoutPrefix + ":locked:" + kind + ":" + id
+}
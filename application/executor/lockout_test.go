@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"literank.com/rest-books/domain/model"
+)
+
+func TestSignInLogsNoEmails(t *testing.T) {
+	const email = "Reader@Example.com"
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	u := newTestUserOperator(&fakeUsers{users: map[uint]*model.User{
+		1: {ID: 1, Email: email, Password: sha1Hash("right" + "salt"), Salt: "salt"},
+	}})
+	u.logger, u.audit = logger, NewAudit(&chainAudit{}, logger)
+	u.lockout = NewLockout(memCounter{}, LockoutPolicy{MaxFailures: 2, MaxIPFailures: 5}, u.audit, logger)
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  error
+	}{
+		{"wrong password", email, "wrong", errBadCredentials},
+		{"unknown email", "nobody@example.com", "wrong", errBadCredentials},
+		{"locking wrong password", email, "wrong", errBadCredentials},
+		{"locked out", email, "right", errLockedOut},
+	}
+	for _, tt := range tests {
+		if _, err := u.signIn(context.Background(), tt.email, tt.password, "203.0.113.7"); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: signIn error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := u.Unlock(context.Background(), email, ""); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.ToLower(logs.String())
+	for _, e := range []string{email, "nobody@example.com"} {
+		if strings.Contains(out, strings.ToLower(e)) {
+			t.Errorf("logs name %s:\n%s", e, logs.String())
+		}
+	}
+	for _, want := range []string{"Sign-in failed", "Sign-in lockout", "Sign-in refused", accountKey(email)} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs lack %q:\n%s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/token"
+)
+
+const (
+	purposeMFAChallenge = "mfa_challenge"
+	recoveryCodeBytes   = 5
+)
+
+var (
+	errMFAEnabled       = fmt.Errorf("%w: two-factor authentication is already on", model.ErrInvalidArgument)
+	errMFADisabled      = fmt.Errorf("%w: two-factor authentication is off", model.ErrInvalidArgument)
+	errNoEnrollment     = fmt.Errorf("%w: no authenticator is being enrolled", model.ErrInvalidArgument)
+	errMFAEnforced      = fmt.Errorf("%w: two-factor authentication is required for your role", model.ErrPermissionDenied)
+	errBadCode          = fmt.Errorf("%w: wrong or used code", model.ErrUnauthenticated)
+	errInvalidChallenge = fmt.Errorf("%w: invalid or expired challenge", model.ErrUnauthenticated)
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAPolicy tells how two-factor authentication works
+type MFAPolicy struct {
+	// Issuer names the app in authenticator apps
+	Issuer string
+	// Enforce requires authors and admins to use two factors
+	Enforce      bool
+	ChallengeTTL time.Duration
+	// Skew is the time steps of clock drift allowed either way
+	Skew          int
+	RecoveryCodes int
+}
+
+// MFA runs the second factor of sign-ins: TOTP authenticators, sign-in challenges and recovery codes
+type MFA struct {
+	users  gateway.UserManager
+	tokens gateway.ActionTokenManager
+	policy atomic.Pointer[MFAPolicy]
+	logger *slog.Logger
+}
+
+// NewMFA constructs a new MFA
+func NewMFA(u gateway.UserManager, tokens gateway.ActionTokenManager, p MFAPolicy, logger *slog.Logger) *MFA {
+	m := &MFA{users: u, tokens: tokens, logger: logger}
+	m.SetPolicy(p)
+	return m
+}
+
+// SetPolicy changes the policy, safe while serving
+func (m *MFA) SetPolicy(p MFAPolicy) {
+	m.policy.Store(&p)
+}
+
+// Enforced tells if users of the permission must use two factors
+func (m *MFA) Enforced(perm model.UserPermission) bool {
+	return m.policy.Load().Enforce && perm >= model.PermAuthor
+}
+
+// Challenge issues the token that the second step of the user's sign-in answers
+func (m *MFA) Challenge(user *model.User) (string, error) {
+	return m.tokens.SignAction(purposeMFAChallenge, user.ID, challengeState(user), m.policy.Load().ChallengeTTL)
+}
+
+// ChallengeUser returns the user a challenge was issued for
+func (m *MFA) ChallengeUser(ctx context.Context, challenge string) (*model.User, error) {
+	id, err := m.tokens.ActionSubject(purposeMFAChallenge, challenge)
+	if err != nil {
+		return nil, errInvalidChallenge
+	}
+	user, err := m.users.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled || m.tokens.VerifyAction(purposeMFAChallenge, challenge, challengeState(user)) != nil {
+		return nil, errInvalidChallenge
+	}
+	return user, nil
+}
+
+// Enroll gives the user a new authenticator secret, which works once a code of it is confirmed
+func (m *MFA) Enroll(ctx context.Context, user *model.User) (secret, uri string, err error) {
+	if user.MFAEnabled {
+		return "", "", errMFAEnabled
+	}
+	secret, err = token.NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := m.users.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		return "", "", err
+	}
+	return secret, token.TOTPURI(m.policy.Load().Issuer, user.Email, secret), nil
+}
+
+// Confirm turns two-factor authentication on with a code of the enrolled authenticator,
+// and returns the new recovery codes
+func (m *MFA) Confirm(ctx context.Context, user *model.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, errMFAEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, errNoEnrollment
+	}
+	if err := m.Verify(ctx, user, code, false); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.users.EnableMFA(ctx, user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a code of the user's authenticator, or a recovery code if recovery is allowed.
+// Every code works once.
+func (m *MFA) Verify(ctx context.Context, user *model.User, code string, recovery bool) error {
+	code = normalizeCode(code)
+	if step, ok := token.ValidateTOTP(user.TOTPSecret, code, time.Now(), m.policy.Load().Skew); ok {
+		fresh, err := m.users.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return errBadCode
+		}
+		return nil
+	}
+	if !recovery || !user.MFAEnabled {
+		return errBadCode
+	}
+	used, err := m.users.UseRecoveryCode(ctx, user.ID, hashCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errBadCode
+	}
+	m.logger.InfoContext(ctx, "Recovery code used", "user_id", user.ID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, and returns the new ones
+func (m *MFA) RegenerateRecoveryCodes(ctx context.Context, user *model.User) ([]string, error) {
+	if !user.MFAEnabled {
+		return nil, errMFADisabled
+	}
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.users.SetRecoveryCodes(ctx, user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (m *MFA) newRecoveryCodes() (codes, hashes []string, err error) {
+	n := m.policy.Load().RecoveryCodes
+	codes, hashes = make([]string, n), make([]string, n)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		// Grouped for reading, and accepted with or without the dash
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// challengeState binds a challenge to the password and the authenticator of the user,
+// and to the count of second factors used, so that a challenge is answered once, even with a recovery code
+func challengeState(user *model.User) string {
+	return user.Password + "|" + user.TOTPSecret + "|" + strconv.FormatUint(uint64(user.MFACounter), 10)
+}
+
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
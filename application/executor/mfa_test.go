@@ -0,0 +1,66 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/token"
+)
+
+// mfaUsers keeps the unused recovery codes of the users of the fake, and counts the second factors used
+type mfaUsers struct {
+	*fakeUsers
+	codes map[string]bool
+}
+
+func (m *mfaUsers) UseRecoveryCode(ctx context.Context, id uint, codeHash string) (bool, error) {
+	if !m.codes[codeHash] {
+		return false, nil
+	}
+	delete(m.codes, codeHash)
+	m.users[id].MFACounter++
+	return true, nil
+}
+
+func TestMFAChallengeIsAnsweredOnce(t *testing.T) {
+	tests := []struct {
+		name string
+		// answers are the codes sent to the challenge in turn, with the error each gets
+		answers []string
+		wantErr []error
+	}{
+		{"recovery code", []string{"aaaa-bbbb"}, []error{nil}},
+		{"replayed with another recovery code", []string{"aaaa-bbbb", "cccc-dddd"},
+			[]error{nil, errInvalidChallenge}},
+		{"replayed with the same recovery code", []string{"aaaa-bbbb", "aaaa-bbbb"},
+			[]error{nil, errInvalidChallenge}},
+		{"retried after a wrong code", []string{"zzzz-zzzz", "cccc-dddd"}, []error{errBadCode, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := token.NewTOTPSecret()
+			if err != nil {
+				t.Fatal(err)
+			}
+			users := &mfaUsers{
+				fakeUsers: &fakeUsers{users: map[uint]*model.User{
+					1: {ID: 1, Email: "a@example.com", Password: "hash", TOTPSecret: secret, MFAEnabled: true},
+				}},
+				codes: map[string]bool{hashCode("aaaabbbb"): true, hashCode("ccccdddd"): true},
+			}
+			u := newTestUserOperator(users)
+			challenge, err := u.mfa.Challenge(users.users[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, code := range tt.answers {
+				_, err := u.signInMFA(context.Background(), challenge, code, "203.0.113.7")
+				if !errors.Is(err, tt.wantErr[i]) || (err == nil) != (tt.wantErr[i] == nil) {
+					t.Fatalf("answer %d: signInMFA error = %v, want %v", i+1, err, tt.wantErr[i])
+				}
+			}
+		})
+	}
+}
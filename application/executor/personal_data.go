@@ -0,0 +1,149 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/domain/model"
+)
+
+// Stores and actions of erasure steps
+const (
+	storeMySQL          = "mysql"
+	storeMongo          = "mongo"
+	storeRedis          = "redis"
+	actionDeleted       = "deleted"
+	actionPseudonymized = "pseudonymized"
+	actionRevoked       = "revoked"
+)
+
+// PersonalDataHolder keeps personal data of users outside their accounts, like their reviews
+type PersonalDataHolder interface {
+	// ExportPersonalData adds what it keeps of the user to the export
+	ExportPersonalData(ctx context.Context, userID uint, e *dto.DataExport) error
+	// ErasePersonalData removes or pseudonymizes what it keeps of the user, and checks that nothing is left
+	ErasePersonalData(ctx context.Context, userID uint) ([]*dto.ErasureStep, error)
+}
+
+// AddDataHolder registers a holder of personal data, for exports and erasures
+func (u *UserOperator) AddDataHolder(h PersonalDataHolder) {
+	u.holders = append(u.holders, h)
+}
+
+// ExportData collects all personal data of the user.
+// Secrets, like the password hash, the authenticator secret and the API keys themselves, are left out.
+func (u *UserOperator) ExportData(ctx context.Context, userID uint) (*dto.DataExport, error) {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := u.userManager.ListIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := u.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	e := &dto.DataExport{
+		ExportedAt: time.Now(),
+		Account: &dto.ExportedAccount{
+			Profile:   *profileDTO(user),
+			Locale:    user.Locale,
+			IsAdmin:   user.IsAdmin,
+			UpdatedAt: user.UpdatedAt,
+		},
+		Identities: make([]*dto.ExportedIdentity, len(identities)),
+		APIKeys:    keys,
+		Reviews:    make([]*dto.ExportedReview, 0),
+	}
+	for i, ext := range identities {
+		e.Identities[i] = &dto.ExportedIdentity{Issuer: ext.Issuer, Subject: ext.Subject, Email: ext.Email,
+			LinkedAt: ext.CreatedAt}
+	}
+	for _, h := range u.holders {
+		if err := h.ExportPersonalData(ctx, userID, e); err != nil {
+			return nil, err
+		}
+	}
+	u.logger.InfoContext(ctx, "Personal data exported", "user_id", userID)
+	return e, nil
+}
+
+// EraseUser removes or pseudonymizes all personal data of the user for an admin, and reports what it did
+func (u *UserOperator) EraseUser(ctx context.Context, adminID, userID uint) (*dto.ErasureReport, error) {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report, err := u.erase(ctx, user.ID, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	report.RequestedBy = adminID
+	u.logger.InfoContext(ctx, "User erased", "user_id", userID, "admin_id", adminID, "verified", report.Verified)
+	u.audit.Record(ctx, model.AuditErase, model.AuditTargetUser, idString(userID), nil,
+		map[string]bool{"verified": report.Verified})
+	return report, nil
+}
+
+// erase runs the erasure of the user in every store.
+// The account goes last, so that a failed erasure can be run again.
+func (u *UserOperator) erase(ctx context.Context, userID uint, email string) (*dto.ErasureReport, error) {
+	report := &dto.ErasureReport{UserID: userID, StartedAt: time.Now(), Steps: make([]*dto.ErasureStep, 0)}
+	// Tokens stop working first, so that nothing is written for the user while the erasure runs
+	if err := u.userManager.RevokeTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+	for _, h := range u.holders {
+		steps, err := h.ErasePersonalData(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		report.Steps = append(report.Steps, steps...)
+	}
+	found, left, err := u.lockout.Forget(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	report.Steps = append(report.Steps, &dto.ErasureStep{Store: storeRedis, Data: "sign-in failures",
+		Action: actionDeleted, Count: found, Remaining: left})
+	deleted, err := u.userManager.DeleteUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := u.userManager.CountUserRows(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0, len(deleted))
+	for t := range deleted {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	for _, t := range tables {
+		report.Steps = append(report.Steps, &dto.ErasureStep{Store: storeMySQL, Data: t, Action: actionDeleted,
+			Count: deleted[t], Remaining: rows[t]})
+	}
+	// Tokens are not kept, so they count as one revocation of them all; Authenticate refuses every one
+	// of them once the account they name is gone
+	var tokensLeft int64
+	if _, err := u.userManager.GetUser(ctx, userID); err == nil {
+		tokensLeft = 1
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return nil, err
+	}
+	report.Steps = append(report.Steps, &dto.ErasureStep{Store: storeMySQL, Data: "sign-in tokens",
+		Action: actionRevoked, Count: 1, Remaining: tokensLeft})
+	report.Verified = true
+	for _, s := range report.Steps {
+		if s.Remaining > 0 {
+			report.Verified = false
+		}
+	}
+	report.CompletedAt = time.Now()
+	return report, nil
+}
@@ -0,0 +1,75 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// erasedUsers deletes users from the fake, or keeps them when stuck is set
+type erasedUsers struct {
+	*fakeUsers
+	revoked []uint
+	stuck   bool
+}
+
+func (e *erasedUsers) RevokeTokens(ctx context.Context, id uint) error {
+	e.revoked = append(e.revoked, id)
+	return nil
+}
+
+func (e *erasedUsers) DeleteUser(ctx context.Context, id uint) (map[string]int64, error) {
+	if e.stuck {
+		return map[string]int64{"users": 0}, nil
+	}
+	delete(e.users, id)
+	return map[string]int64{"users": 1}, nil
+}
+
+func (e *erasedUsers) CountUserRows(ctx context.Context, id uint) (map[string]int64, error) {
+	if _, ok := e.users[id]; ok {
+		return map[string]int64{"users": 1}, nil
+	}
+	return map[string]int64{"users": 0}, nil
+}
+
+func TestEraseRevokesTokens(t *testing.T) {
+	tests := []struct {
+		name         string
+		stuck        bool
+		wantLeft     int64
+		wantVerified bool
+	}{
+		{"account deleted", false, 0, true},
+		{"account left", true, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &erasedUsers{fakeUsers: &fakeUsers{users: map[uint]*model.User{1: {ID: 1}}}, stuck: tt.stuck}
+			u := newTestUserOperator(users)
+			report, err := u.erase(context.Background(), 1, "a@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users.revoked) != 1 || users.revoked[0] != 1 {
+				t.Errorf("revoked tokens of %v, want [1]", users.revoked)
+			}
+			var found bool
+			for _, s := range report.Steps {
+				if s.Action == actionRevoked {
+					found = true
+					if s.Remaining != tt.wantLeft {
+						t.Errorf("tokens remaining = %d, want %d", s.Remaining, tt.wantLeft)
+					}
+				}
+			}
+			if !found {
+				t.Error("report has no step for the sign-in tokens")
+			}
+			if report.Verified != tt.wantVerified {
+				t.Errorf("verified = %v, want %v", report.Verified, tt.wantVerified)
+			}
+		})
+	}
+}
@@ -2,30 +2,63 @@ package executor
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"literank.com/rest-books/application/dto"
 	"literank.com/rest-books/domain/gateway"
 	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/cache"
+	"literank.com/rest-books/infrastructure/tracing"
 )
 
+var (
+	errUnverified  = fmt.Errorf("%w: verify your email to post reviews", model.ErrPermissionDenied)
+	errNotReviewer = fmt.Errorf("%w: only the user who posted the review or an admin may change it",
+		model.ErrPermissionDenied)
+)
+
+// deletedAuthor is the author of the reviews of deleted accounts
+const deletedAuthor = "Deleted user"
+
 // ReviewOperator handles review input/output and proxies operations to the review manager.
 type ReviewOperator struct {
 	reviewManager gateway.ReviewManager
+	userManager   gateway.UserManager
+	cache         *cache.Cache
+	audit         *Audit
+	logger        *slog.Logger
 }
 
 // NewReviewOperator constructs a new ReviewOperator
-func NewReviewOperator(b gateway.ReviewManager) *ReviewOperator {
-	return &ReviewOperator{reviewManager: b}
+func NewReviewOperator(b gateway.ReviewManager, u gateway.UserManager, c *cache.Cache, a *Audit,
+	logger *slog.Logger) *ReviewOperator {
+	return &ReviewOperator{reviewManager: b, userManager: u, cache: c, audit: a, logger: logger}
 }
 
-// CreateReview creates a new review
-func (o *ReviewOperator) CreateReview(ctx context.Context, body *dto.ReviewBody) (*model.Review, error) {
+// CreateReview creates a new review by the user, who must have verified the email.
+// The author is the user's display name unless given.
+func (o *ReviewOperator) CreateReview(ctx context.Context, userID uint, body *dto.ReviewBody) (*model.Review, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.CreateReview")
+	defer span.End()
+	user, err := o.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, errUnverified
+	}
+	author := body.Author
+	if author == "" {
+		author = user.DisplayName
+	}
 	now := time.Now()
 	b := &model.Review{
 		BookID:    body.BookID,
-		Author:    body.Author,
+		UserID:    user.ID,
+		Author:    author,
 		Title:     body.Title,
 		Content:   body.Content,
 		CreatedAt: now,
@@ -36,32 +69,166 @@ func (o *ReviewOperator) CreateReview(ctx context.Context, body *dto.ReviewBody)
 		return nil, err
 	}
 	b.ID = id
+	o.forget(ctx, b.BookID)
+	o.logger.InfoContext(ctx, "Review created", "review_id", id, "book_id", b.BookID, "user_id", userID)
 	return b, nil
 }
 
 // GetReview gets a review by ID
 func (o *ReviewOperator) GetReview(ctx context.Context, id string) (*model.Review, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.GetReview")
+	defer span.End()
 	return o.reviewManager.GetReview(ctx, id)
 }
 
-// GetReviewsOfBook gets a list of reviews by a query
+// GetReviewsOfBook gets a list of reviews by a query, and caches the unfiltered list if needed
 func (o *ReviewOperator) GetReviewsOfBook(ctx context.Context, bookID uint, query string) ([]*model.Review, error) {
-	return o.reviewManager.GetReviewsOfBook(ctx, bookID, query)
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.GetReviewsOfBook")
+	defer span.End()
+	if query != "" {
+		return o.reviewManager.GetReviewsOfBook(ctx, bookID, query)
+	}
+	key := strconv.FormatUint(uint64(bookID), 10)
+	reviews := make([]*model.Review, 0)
+	if loadCache(ctx, o.cache, o.logger, cache.FamilyReviews, key, &reviews) {
+		return reviews, nil
+	}
+	reviews, err := o.reviewManager.GetReviewsOfBook(ctx, bookID, "")
+	if err != nil {
+		return nil, err
+	}
+	saveCache(ctx, o.cache, o.logger, cache.FamilyReviews, key, reviews)
+	return reviews, nil
+}
+
+// GetReviewsOfBooks gets the reviews of several books at once, grouped by book ID
+func (o *ReviewOperator) GetReviewsOfBooks(ctx context.Context, bookIDs []uint) (map[uint][]*model.Review, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.GetReviewsOfBooks")
+	defer span.End()
+	reviews, err := o.reviewManager.GetReviewsOfBooks(ctx, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint][]*model.Review, len(bookIDs))
+	for _, r := range reviews {
+		result[r.BookID] = append(result[r.BookID], r)
+	}
+	return result, nil
 }
 
-// UpdateReview updates a review by its ID and the new content
-func (o *ReviewOperator) UpdateReview(ctx context.Context, id string, b *model.Review) (*model.Review, error) {
+// UpdateReview updates a review by its ID and the new content, for the user who posted it or an admin
+func (o *ReviewOperator) UpdateReview(ctx context.Context, u *model.UserIdentity, id string,
+	b *model.Review) (*model.Review, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.UpdateReview")
+	defer span.End()
 	if b.Title == "" || b.Content == "" {
-		return nil, errors.New("required field cannot be empty")
+		return nil, fmt.Errorf("%w: required field cannot be empty", model.ErrInvalidArgument)
 	}
 	b.UpdatedAt = time.Now()
+	before, err := o.reviewManager.GetReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !mayChange(u, before) {
+		return nil, errNotReviewer
+	}
 	if err := o.reviewManager.UpdateReview(ctx, id, b); err != nil {
 		return nil, err
 	}
+	o.forget(ctx, before.BookID)
+	after, err := o.reviewManager.GetReview(ctx, id)
+	if err != nil {
+		after = b
+	}
+	o.audit.Record(ctx, model.AuditReviewUpdate, model.AuditTargetReview, id, before, after)
 	return b, nil
 }
 
-// DeleteReview deletes a review by ID
-func (o *ReviewOperator) DeleteReview(ctx context.Context, id string) error {
-	return o.reviewManager.DeleteReview(ctx, id)
+// DeleteReview deletes a review by ID, for the user who posted it or an admin
+func (o *ReviewOperator) DeleteReview(ctx context.Context, u *model.UserIdentity, id string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.DeleteReview")
+	defer span.End()
+	before, err := o.reviewManager.GetReview(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !mayChange(u, before) {
+		return errNotReviewer
+	}
+	if err := o.reviewManager.DeleteReview(ctx, id); err != nil {
+		return err
+	}
+	o.forget(ctx, before.BookID)
+	o.audit.Record(ctx, model.AuditReviewDelete, model.AuditTargetReview, id, before, nil)
+	return nil
+}
+
+// ExportPersonalData adds the reviews the user posted to the export
+func (o *ReviewOperator) ExportPersonalData(ctx context.Context, userID uint, e *dto.DataExport) error {
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.ExportPersonalData")
+	defer span.End()
+	reviews, err := o.reviewManager.GetReviewsOfUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, r := range reviews {
+		e.Reviews = append(e.Reviews, &dto.ExportedReview{ID: r.ID, BookID: r.BookID, Author: r.Author,
+			Title: r.Title, Content: r.Content, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt})
+	}
+	return nil
+}
+
+// ErasePersonalData unlinks the reviews of the user under deletedAuthor, keeping their contents,
+// and drops the cached reviews of their books
+func (o *ReviewOperator) ErasePersonalData(ctx context.Context, userID uint) ([]*dto.ErasureStep, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ReviewOperator.ErasePersonalData")
+	defer span.End()
+	bookIDs, n, err := o.reviewManager.AnonymizeReviews(ctx, userID, deletedAuthor)
+	if err != nil {
+		return nil, err
+	}
+	left, err := o.reviewManager.GetReviewsOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	reviews := &dto.ErasureStep{Store: storeMongo, Data: "reviews", Action: actionPseudonymized, Count: n,
+		Remaining: int64(len(left))}
+	cached := &dto.ErasureStep{Store: storeRedis, Data: "cached reviews", Action: actionDeleted}
+	if o.cache.Enabled(cache.FamilyReviews) && len(bookIDs) > 0 {
+		keys := make([]string, len(bookIDs))
+		for i, id := range bookIDs {
+			keys[i] = strconv.FormatUint(uint64(id), 10)
+		}
+		if err := o.cache.Delete(ctx, cache.FamilyReviews, keys...); err != nil {
+			return nil, err
+		}
+		cached.Count = int64(len(keys))
+		// Readers may cache the reviews again meanwhile, but only as anonymized
+		for _, key := range keys {
+			var list []*model.Review
+			if _, err := o.cache.Load(ctx, cache.FamilyReviews, key, &list); err != nil {
+				return nil, err
+			}
+			for _, r := range list {
+				if r.UserID == userID {
+					cached.Remaining++
+				}
+			}
+		}
+	}
+	o.logger.InfoContext(ctx, "Reviews anonymized", "user_id", userID, "reviews", n, "books", len(bookIDs))
+	return []*dto.ErasureStep{reviews, cached}, nil
+}
+
+// mayChange tells if the user may change the review. Reviews of deleted accounts, and those stored
+// without their user, are left to admins.
+func mayChange(u *model.UserIdentity, r *model.Review) bool {
+	return u.Permission >= model.PermAdmin || (r.UserID != 0 && r.UserID == u.UserID)
+}
+
+// forget drops the cached reviews of the book
+func (o *ReviewOperator) forget(ctx context.Context, bookID uint) {
+	if bookID != 0 {
+		deleteCache(ctx, o.cache, o.logger, cache.FamilyReviews, strconv.FormatUint(uint64(bookID), 10))
+	}
 }
@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/cache"
+	"literank.com/rest-books/infrastructure/config"
+)
+
+// fakeReviews keeps reviews in a map; other methods of the gateway are not called by these tests
+type fakeReviews struct {
+	gateway.ReviewManager
+	reviews map[string]*model.Review
+}
+
+func (f *fakeReviews) GetReview(ctx context.Context, id string) (*model.Review, error) {
+	if r, ok := f.reviews[id]; ok {
+		copied := *r
+		return &copied, nil
+	}
+	return nil, fmt.Errorf("%w: review %s", model.ErrNotFound, id)
+}
+
+func (f *fakeReviews) UpdateReview(ctx context.Context, id string, r *model.Review) error {
+	f.reviews[id].Title, f.reviews[id].Content = r.Title, r.Content
+	return nil
+}
+
+func (f *fakeReviews) DeleteReview(ctx context.Context, id string) error {
+	delete(f.reviews, id)
+	return nil
+}
+
+func TestReviewChangesNeedOwnerOrAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *model.UserIdentity
+		owner   uint
+		wantErr error
+	}{
+		{"owner", &model.UserIdentity{UserID: 1, Permission: model.PermUser}, 1, nil},
+		{"other user", &model.UserIdentity{UserID: 2, Permission: model.PermUser}, 1, errNotReviewer},
+		{"author of books", &model.UserIdentity{UserID: 2, Permission: model.PermAuthor}, 1, errNotReviewer},
+		{"admin", &model.UserIdentity{UserID: 3, Permission: model.PermAdmin}, 1, nil},
+		{"review without a user", &model.UserIdentity{UserID: 0, Permission: model.PermUser}, 0, errNotReviewer},
+		{"admin, review without a user", &model.UserIdentity{UserID: 3, Permission: model.PermAdmin}, 0, nil},
+	}
+	logger := testLogger()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviews := &fakeReviews{reviews: map[string]*model.Review{
+				"r1": {ID: "r1", BookID: 1, UserID: tt.owner, Title: "Good", Content: "Liked it"},
+				"r2": {ID: "r2", BookID: 1, UserID: tt.owner, Title: "Bad", Content: "Did not"},
+			}}
+			audit := &chainAudit{}
+			o := NewReviewOperator(reviews, nil, cache.NewCache(nil, &config.CacheConfig{}),
+				NewAudit(audit, logger), logger)
+			ctx := context.Background()
+			_, err := o.UpdateReview(ctx, tt.user, "r1", &model.Review{Title: "Great", Content: "Loved it"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateReview error = %v, want %v", err, tt.wantErr)
+			}
+			if err := o.DeleteReview(ctx, tt.user, "r2"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteReview error = %v, want %v", err, tt.wantErr)
+			}
+			_, kept := reviews.reviews["r2"]
+			changed := reviews.reviews["r1"].Title == "Great"
+			if allowed := tt.wantErr == nil; changed != allowed || kept == allowed {
+				t.Errorf("review changed %v, deleted %v; want both %v", changed, !kept, allowed)
+			}
+			if want := map[bool]int{true: 2, false: 0}[tt.wantErr == nil]; len(audit.entries) != want {
+				t.Errorf("audit entries = %d, want %d", len(audit.entries), want)
+			}
+		})
+	}
+}
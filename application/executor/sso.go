@@ -0,0 +1,211 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"literank.com/rest-books/domain/gateway"
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/cache"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const ssoStatePrefix = "lr:sso:state:"
+
+var (
+	errSSODisabled    = fmt.Errorf("%w: single sign-on is off", model.ErrNotFound)
+	errInvalidState   = fmt.Errorf("%w: invalid or expired sign-in state", model.ErrUnauthenticated)
+	errNotProvisioned = fmt.Errorf("%w: no account is linked to this identity", model.ErrPermissionDenied)
+	errNoEmail        = fmt.Errorf("%w: the provider shared no email", model.ErrPermissionDenied)
+	// An unverified email at the provider does not prove the account is the same person's
+	errEmailTaken = fmt.Errorf("%w: the email belongs to an account, verify it at the provider to link them",
+		model.ErrPermissionDenied)
+)
+
+// SSOPolicy tells how identities of the provider become users
+type SSOPolicy struct {
+	// Provision creates users for unknown identities
+	Provision bool
+	// MapRoles sets the permission of users from the roles of their ID tokens, on every sign-in
+	MapRoles    bool
+	AdminRoles  []string
+	AuthorRoles []string
+	// StateTTL is how long a sign-in may take at the provider
+	StateTTL time.Duration
+}
+
+// ssoState is what a sign-in keeps between its start and its callback
+type ssoState struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// SSO signs users in with an OpenID Connect provider, linking its identities to users.
+// The state of pending sign-ins lives in the cache backend, so any instance can take the callback.
+type SSO struct {
+	provider gateway.IdentityProvider
+	users    gateway.UserManager
+	store    cache.Helper
+	locale   func(tags string) string
+	policy   SSOPolicy
+	audit    *Audit
+	logger   *slog.Logger
+}
+
+// NewSSO constructs a new SSO. Locale picks the mail locale of provisioned users from the locale claim.
+func NewSSO(p gateway.IdentityProvider, u gateway.UserManager, store cache.Helper, locale func(tags string) string,
+	policy SSOPolicy, a *Audit, logger *slog.Logger) *SSO {
+	return &SSO{provider: p, users: u, store: store, locale: locale, policy: policy, audit: a, logger: logger}
+}
+
+// Start begins a sign-in, and returns the URL of the provider to send the user to
+func (s *SSO) Start(ctx context.Context) (string, error) {
+	var tokens [3]string
+	for i := range tokens {
+		t, err := randomToken()
+		if err != nil {
+			return "", err
+		}
+		tokens[i] = t
+	}
+	state, nonce, verifier := tokens[0], tokens[1], tokens[2]
+	b, err := json.Marshal(&ssoState{Verifier: verifier, Nonce: nonce})
+	if err != nil {
+		return "", err
+	}
+	if err := s.store.Save(ctx, ssoStatePrefix+state, string(b), s.policy.StateTTL); err != nil {
+		return "", err
+	}
+	return s.provider.AuthURL(ctx, state, nonce, verifier)
+}
+
+// Finish completes the sign-in of a callback, and returns its user with the permission to grant
+func (s *SSO) Finish(ctx context.Context, code, state string) (*model.User, model.UserPermission, error) {
+	if code == "" || state == "" {
+		return nil, model.PermNone, errInvalidState
+	}
+	raw, err := s.store.Load(ctx, ssoStatePrefix+state)
+	if err != nil {
+		return nil, model.PermNone, err
+	}
+	if raw == "" {
+		return nil, model.PermNone, errInvalidState
+	}
+	// Every state is used once
+	if err := s.store.Delete(ctx, ssoStatePrefix+state); err != nil {
+		return nil, model.PermNone, err
+	}
+	var st ssoState
+	if err := json.Unmarshal([]byte(raw), &st); err != nil {
+		return nil, model.PermNone, errInvalidState
+	}
+	claims, err := s.provider.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		return nil, model.PermNone, err
+	}
+	user, err := s.user(ctx, claims)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Single sign-on refused", "issuer", claims.Issuer, "subject", claims.Subject,
+			logging.KeyError, err)
+		return nil, model.PermNone, err
+	}
+	perm, err := s.permission(ctx, user, claims)
+	if err != nil {
+		return nil, model.PermNone, err
+	}
+	return user, perm, nil
+}
+
+// user returns the user linked to the identity, linking or provisioning one if there is none yet
+func (s *SSO) user(ctx context.Context, claims *model.ExternalClaims) (*model.User, error) {
+	user, err := s.users.GetUserByIdentity(ctx, claims.Issuer, claims.Subject)
+	if err == nil || !errors.Is(err, model.ErrNotFound) {
+		return user, err
+	}
+	if claims.Email == "" {
+		return nil, errNoEmail
+	}
+	ext := &model.ExternalIdentity{Issuer: claims.Issuer, Subject: claims.Subject, Email: claims.Email}
+	user, err = s.users.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if !claims.EmailVerified {
+			return nil, errEmailTaken
+		}
+		ext.UserID = user.ID
+		if err := s.users.LinkIdentity(ctx, ext); err != nil {
+			return nil, err
+		}
+		s.logger.InfoContext(ctx, "External identity linked", "user_id", user.ID, "issuer", claims.Issuer)
+		return user, nil
+	case !errors.Is(err, model.ErrNotFound):
+		return nil, err
+	case !s.policy.Provision:
+		return nil, errNotProvisioned
+	}
+	// Provisioned users have no password, until they reset one
+	user = &model.User{
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Locale:        s.locale(claims.Locale),
+	}
+	if _, err := s.users.ProvisionUser(ctx, user, ext); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "User provisioned", "user_id", user.ID, "issuer", claims.Issuer)
+	return user, nil
+}
+
+// permission maps the roles of the ID token to a permission, keeping the roles of the user in step
+func (s *SSO) permission(ctx context.Context, user *model.User, claims *model.ExternalClaims) (
+	model.UserPermission, error) {
+	if !s.policy.MapRoles {
+		return calcPerm(user), nil
+	}
+	perm := model.PermUser
+	if anyOf(claims.Roles, s.policy.AuthorRoles) {
+		perm = model.PermAuthor
+	}
+	if anyOf(claims.Roles, s.policy.AdminRoles) {
+		perm = model.PermAdmin
+	}
+	isAdmin, isAuthor := perm == model.PermAdmin, perm == model.PermAuthor
+	if user.IsAdmin != isAdmin || user.IsAuthor != isAuthor {
+		if err := s.users.SetRoles(ctx, user.ID, isAdmin, isAuthor); err != nil {
+			return model.PermNone, err
+		}
+		before := map[string]bool{"is_admin": user.IsAdmin, "is_author": user.IsAuthor}
+		user.IsAdmin, user.IsAuthor = isAdmin, isAuthor
+		s.logger.InfoContext(ctx, "Roles mapped", "user_id", user.ID, "is_admin", isAdmin, "is_author", isAuthor)
+		// The provider's roles decide, as the user signs in
+		s.audit.RecordFor(ctx, user.ID, model.AuditRoleChange, model.AuditTargetUser, idString(user.ID),
+			before, map[string]bool{"is_admin": isAdmin, "is_author": isAuthor})
+	}
+	return perm, nil
+}
+
+func anyOf(values, options []string) bool {
+	for _, v := range values {
+		for _, o := range options {
+			if v == o {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// randomToken returns 32 random bytes in base64url, fit for states, nonces and PKCE verifiers
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,254 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/token"
+)
+
+// stubProvider answers the code of a sign-in with its claims, if the verifier and the nonce are the ones
+// the sign-in started with. Its codes are the states they answer.
+type stubProvider struct {
+	started map[string]ssoState
+	claims  *model.ExternalClaims
+}
+
+func (p *stubProvider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	p.started[state] = ssoState{Verifier: verifier, Nonce: nonce}
+	return "https://idp.test/auth?state=" + url.QueryEscape(state), nil
+}
+
+func (p *stubProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*model.ExternalClaims, error) {
+	st, ok := p.started[code]
+	if !ok || st.Verifier != verifier || st.Nonce != nonce {
+		return nil, fmt.Errorf("%w: invalid grant", model.ErrUnauthenticated)
+	}
+	return p.claims, nil
+}
+
+// ssoUsers links identities to the users of the fake
+type ssoUsers struct {
+	*fakeUsers
+	links map[string]uint
+}
+
+func (s *ssoUsers) GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	if id, ok := s.links[issuer+" "+subject]; ok {
+		return s.GetUser(ctx, id)
+	}
+	return nil, fmt.Errorf("%w: identity", model.ErrNotFound)
+}
+
+func (s *ssoUsers) LinkIdentity(ctx context.Context, ext *model.ExternalIdentity) error {
+	s.links[ext.Issuer+" "+ext.Subject] = ext.UserID
+	return nil
+}
+
+func (s *ssoUsers) SetRoles(ctx context.Context, id uint, isAdmin, isAuthor bool) error {
+	s.users[id].IsAdmin, s.users[id].IsAuthor = isAdmin, isAuthor
+	return nil
+}
+
+func newTestSSO(claims *model.ExternalClaims, users ...*model.User) (*SSO, *ssoUsers) {
+	fake := &ssoUsers{fakeUsers: &fakeUsers{users: make(map[uint]*model.User)}, links: make(map[string]uint)}
+	for _, u := range users {
+		fake.users[u.ID] = u
+	}
+	p := &stubProvider{started: make(map[string]ssoState), claims: claims}
+	logger := testLogger()
+	s := NewSSO(p, fake, memCounter{}, func(string) string { return "" }, SSOPolicy{StateTTL: time.Minute},
+		NewAudit(&chainAudit{}, logger), logger)
+	return s, fake
+}
+
+// startSSO starts a sign-in, and returns its state
+func startSSO(t *testing.T, s *SSO) string {
+	t.Helper()
+	to, err := s.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("state")
+}
+
+func TestSSOFinishChecksState(t *testing.T) {
+	claims := &model.ExternalClaims{Issuer: "https://idp.test", Subject: "s1", Email: "a@example.com",
+		EmailVerified: true}
+	tests := []struct {
+		name string
+		// finish returns the code and the state of the callback, from two started sign-ins
+		finish  func(s *SSO, first, second string) (string, string)
+		wantErr error
+	}{
+		{"matching", func(s *SSO, first, second string) (string, string) { return first, first }, nil},
+		{"unknown state", func(s *SSO, first, second string) (string, string) { return first, "forged" },
+			errInvalidState},
+		{"no state", func(s *SSO, first, second string) (string, string) { return first, "" }, errInvalidState},
+		{"no code", func(s *SSO, first, second string) (string, string) { return "", first }, errInvalidState},
+		{"verifier of another sign-in", func(s *SSO, first, second string) (string, string) { return first, second },
+			model.ErrUnauthenticated},
+		{"state used before", func(s *SSO, first, second string) (string, string) {
+			if _, _, err := s.Finish(context.Background(), first, first); err != nil {
+				panic(err)
+			}
+			return first, first
+		}, errInvalidState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestSSO(claims, &model.User{ID: 1, Email: "a@example.com"})
+			first, second := startSSO(t, s), startSSO(t, s)
+			code, state := tt.finish(s, first, second)
+			user, _, err := s.Finish(context.Background(), code, state)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Finish error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != 1 {
+				t.Errorf("signed in user %d, want 1", user.ID)
+			}
+		})
+	}
+}
+
+func TestSSOLinksVerifiedEmailsOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		verified bool
+		wantErr  error
+	}{
+		{"verified email", true, nil},
+		{"unverified email", false, errEmailTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &model.ExternalClaims{Issuer: "https://idp.test", Subject: "s1", Email: "a@example.com",
+				EmailVerified: tt.verified}
+			s, users := newTestSSO(claims, &model.User{ID: 1, Email: "a@example.com"})
+			state := startSSO(t, s)
+			_, _, err := s.Finish(context.Background(), state, state)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Finish error = %v, want %v", err, tt.wantErr)
+			}
+			_, linked := users.links["https://idp.test s1"]
+			if linked != (tt.wantErr == nil) {
+				t.Errorf("identity linked = %v, want %v", linked, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestSignInSSOUsesMFA(t *testing.T) {
+	tests := []struct {
+		name          string
+		enforce       bool
+		mfaEnabled    bool
+		wantChallenge bool
+		wantPerm      model.UserPermission
+		wantEnroll    bool
+	}{
+		{"not enforced", false, false, false, model.PermAdmin, false},
+		{"enforced, not enrolled", true, false, false, model.PermUser, true},
+		{"enrolled", false, true, true, model.PermAdmin, false},
+		{"enforced, enrolled", true, true, true, model.PermAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			claims := &model.ExternalClaims{Issuer: "https://idp.test", Subject: "s1", Email: "a@example.com",
+				EmailVerified: true}
+			s, users := newTestSSO(claims,
+				&model.User{ID: 1, Email: "a@example.com", IsAdmin: true, MFAEnabled: tt.mfaEnabled})
+			codes := &mfaUsers{fakeUsers: users.fakeUsers, codes: map[string]bool{hashCode("aaaabbbb"): true}}
+			u := newTestUserOperator(users)
+			u.sso = s
+			u.mfa = NewMFA(codes, token.NewTokenKeeper("secret", 1),
+				MFAPolicy{Enforce: tt.enforce, ChallengeTTL: time.Minute}, u.logger)
+			state := startSSO(t, s)
+			ut, err := u.signInSSO(ctx, state, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ut.MFARequired != tt.wantChallenge || (ut.Token == "") != tt.wantChallenge {
+				t.Fatalf("challenged %v with token %q, want challenged %v", ut.MFARequired, ut.Token, tt.wantChallenge)
+			}
+			if tt.wantChallenge {
+				if ut, err = u.signInMFA(ctx, ut.ChallengeToken, "aaaa-bbbb", "203.0.113.7"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			id, err := u.permManager.ParseToken(ut.Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Permission != tt.wantPerm || ut.MFAEnrollmentRequired != tt.wantEnroll {
+				t.Errorf("permission %v, enrollment required %v; want %v, %v", id.Permission,
+					ut.MFAEnrollmentRequired, tt.wantPerm, tt.wantEnroll)
+			}
+		})
+	}
+}
+
+func TestSSOMapsRoles(t *testing.T) {
+	tests := []struct {
+		name         string
+		roles        []string
+		user         model.User
+		wantPerm     model.UserPermission
+		wantAdmin    bool
+		wantAuthor   bool
+		wantRecorded bool
+	}{
+		{"no roles", nil, model.User{}, model.PermUser, false, false, false},
+		{"author granted", []string{"writers"}, model.User{}, model.PermAuthor, false, true, true},
+		{"author kept", []string{"writers"}, model.User{IsAuthor: true}, model.PermAuthor, false, true, false},
+		{"author revoked", nil, model.User{IsAuthor: true}, model.PermUser, false, false, true},
+		{"admin granted", []string{"writers", "ops"}, model.User{IsAuthor: true}, model.PermAdmin, true, false,
+			true},
+		{"admin revoked", nil, model.User{IsAdmin: true}, model.PermUser, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &model.ExternalClaims{Issuer: "https://idp.test", Subject: "s1", Email: "a@example.com",
+				EmailVerified: true, Roles: tt.roles}
+			user := tt.user
+			user.ID, user.Email = 1, "a@example.com"
+			s, users := newTestSSO(claims, &user)
+			s.policy.MapRoles, s.policy.AdminRoles, s.policy.AuthorRoles = true, []string{"ops"}, []string{"writers"}
+			chain := &chainAudit{}
+			s.audit = NewAudit(chain, s.logger)
+			state := startSSO(t, s)
+			_, perm, err := s.Finish(context.Background(), state, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := users.users[1]
+			if perm != tt.wantPerm || kept.IsAdmin != tt.wantAdmin || kept.IsAuthor != tt.wantAuthor {
+				t.Errorf("permission %v, admin %v, author %v; want %v, %v, %v", perm, kept.IsAdmin, kept.IsAuthor,
+					tt.wantPerm, tt.wantAdmin, tt.wantAuthor)
+			}
+			if recorded := len(chain.entries) == 1; recorded != tt.wantRecorded {
+				t.Errorf("role change recorded = %v, want %v", recorded, tt.wantRecorded)
+			}
+			// The persisted roles are the ones the user signs in with afterwards
+			if got := calcPerm(kept); got != tt.wantPerm {
+				t.Errorf("calcPerm = %v, want %v", got, tt.wantPerm)
+			}
+		})
+	}
+}
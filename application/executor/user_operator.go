@@ -5,96 +5,817 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"log/slog"
 	"math/rand"
+	netmail "net/mail"
+	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"literank.com/rest-books/application/dto"
 	"literank.com/rest-books/domain/gateway"
 	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/logging"
+	"literank.com/rest-books/infrastructure/metrics"
+)
+
+const (
+	saltLen     = 4
+	mailTimeout = 30 * time.Second
+)
+
+// Sign-in methods, as the audit log records them
+const (
+	signInPassword = "password"
+	signInMFA      = "mfa"
+	signInSSO      = "sso"
+)
+
+var (
+	errEmptyEmail    = fmt.Errorf("%w: empty email", model.ErrInvalidArgument)
+	errEmptyPassword = fmt.Errorf("%w: empty password", model.ErrInvalidArgument)
+	// Unknown emails and wrong passwords fail alike, so that sign-ins do not tell which emails are registered
+	errBadCredentials  = fmt.Errorf("%w: wrong email or password", model.ErrUnauthenticated)
+	errAlreadyVerified = fmt.Errorf("%w: email is already verified", model.ErrInvalidArgument)
+	errWrongPassword   = fmt.Errorf("%w: wrong password", model.ErrUnauthenticated)
+	// Accounts made by single sign-on have no password until they reset one
+	errNoPassword = fmt.Errorf("%w: the account has no password, set one with a password reset",
+		model.ErrInvalidArgument)
+	errInvalidEmail  = fmt.Errorf("%w: invalid email", model.ErrInvalidArgument)
+	errSameEmail     = fmt.Errorf("%w: that is the email of the account already", model.ErrInvalidArgument)
+	errEmailInUse    = fmt.Errorf("%w: the email belongs to another account", model.ErrAlreadyExists)
+	errNoEmailChange = fmt.Errorf("%w: no email change is pending", model.ErrInvalidArgument)
+	errDisplayName   = fmt.Errorf("%w: display names must be at most %d characters", model.ErrInvalidArgument,
+		displayNameLen)
+	errBio       = fmt.Errorf("%w: bios must be at most %d characters", model.ErrInvalidArgument, bioLen)
+	errAvatarURL = fmt.Errorf("%w: avatar URLs must be http or https URLs of at most %d characters",
+		model.ErrInvalidArgument, avatarURLLen)
+	errAccountGone  = fmt.Errorf("%w: the account no longer exists", model.ErrUnauthenticated)
+	errTokenRevoked = fmt.Errorf("%w: the token was revoked, sign in again", model.ErrUnauthenticated)
 )
 
+// Limits of the profile fields
 const (
-	saltLen          = 4
-	errEmptyEmail    = "empty email"
-	errEmptyPassword = "empty password"
+	displayNameLen = 64
+	bioLen         = 1000
+	avatarURLLen   = 2048
 )
 
 // UserOperator wraps all user and permission operations.
 type UserOperator struct {
 	userManager gateway.UserManager
 	permManager gateway.PermissionManager
+	lockout     *Lockout
+	mailer      *AccountMailer
+	mfa         *MFA
+	sso         *SSO
+	apiKeys     *APIKeys
+	audit       *Audit
+	holders     []PersonalDataHolder
+	logger      *slog.Logger
+	metrics     *metrics.Metrics
 }
 
 // NewUserOperator constructs a new UserOperator
-func NewUserOperator(u gateway.UserManager, p gateway.PermissionManager) *UserOperator {
-	return &UserOperator{userManager: u, permManager: p}
+// Single sign-on is off if s is nil.
+func NewUserOperator(u gateway.UserManager, p gateway.PermissionManager, l *Lockout, a *AccountMailer, f *MFA,
+	s *SSO, k *APIKeys, audit *Audit, logger *slog.Logger, m *metrics.Metrics) *UserOperator {
+	return &UserOperator{userManager: u, permManager: p, lockout: l, mailer: a, mfa: f, sso: s, apiKeys: k,
+		audit: audit, logger: logger, metrics: m}
 }
 
 // CreateUser creates a new user
 func (u *UserOperator) CreateUser(ctx context.Context, uc *dto.UserCredential) (*dto.User, error) {
 	if uc.Email == "" {
-		return nil, errors.New(errEmptyEmail)
+		return nil, errEmptyEmail
 	}
 	if uc.Password == "" {
-		return nil, errors.New(errEmptyPassword)
+		return nil, errEmptyPassword
 	}
 	salt := randomString(saltLen)
 	user := &model.User{
 		Email:    uc.Email,
 		Password: sha1Hash(uc.Password + salt),
 		Salt:     salt,
+		Locale:   u.mailer.Locale(uc.Locale),
 	}
 	uid, err := u.userManager.CreateUser(ctx, user)
 	if err != nil {
 		return nil, err
 	}
+	u.logger.InfoContext(ctx, "User signed up", "user_id", uid)
+	// The user can ask for another mail if this one fails
+	if err := u.mailer.SendVerification(ctx, user); err != nil {
+		u.logger.WarnContext(ctx, "Failed to send the verification mail", "user_id", uid, logging.KeyError, err)
+	}
 	return &dto.User{
 		ID:    uid,
 		Email: uc.Email,
 	}, nil
 }
 
-// SignIn signs an user in
-func (u *UserOperator) SignIn(ctx context.Context, email, password string) (*dto.UserToken, error) {
+// SignIn signs an user in from the client IP.
+// Users with two-factor authentication get a challenge to answer with SignInMFA instead of a token.
+func (u *UserOperator) SignIn(ctx context.Context, email, password, ip string) (*dto.UserToken, error) {
+	ut, err := u.signIn(ctx, email, password, ip)
+	return u.countSignIn(ctx, signInPassword, email, ut, err)
+}
+
+// SignInMFA finishes the sign-in of a challenge with a code of the user's authenticator or a recovery code
+func (u *UserOperator) SignInMFA(ctx context.Context, challenge, code, ip string) (*dto.UserToken, error) {
+	ut, err := u.signInMFA(ctx, challenge, code, ip)
+	return u.countSignIn(ctx, signInMFA, "", ut, err)
+}
+
+// StartSSO begins a sign-in with the OpenID Connect provider, and returns the URL to send the user to
+func (u *UserOperator) StartSSO(ctx context.Context) (string, error) {
+	if u.sso == nil {
+		return "", errSSODisabled
+	}
+	return u.sso.Start(ctx)
+}
+
+// SignInSSO finishes a sign-in with the OpenID Connect provider, from the code and the state of its callback.
+// Two-factor authentication applies as it does to password sign-ins.
+func (u *UserOperator) SignInSSO(ctx context.Context, code, state string) (*dto.UserToken, error) {
+	ut, err := u.signInSSO(ctx, code, state)
+	return u.countSignIn(ctx, signInSSO, "", ut, err)
+}
+
+func (u *UserOperator) signInSSO(ctx context.Context, code, state string) (*dto.UserToken, error) {
+	if u.sso == nil {
+		return nil, errSSODisabled
+	}
+	user, perm, err := u.sso.Finish(ctx, code, state)
+	if err != nil {
+		return nil, err
+	}
+	// The provider stands for the password only; the mapped roles are kept with the user for the second step
+	if user.MFAEnabled {
+		return u.challenge(ctx, user)
+	}
+	return u.issueToken(ctx, user, perm)
+}
+
+// countSignIn counts the result of a sign-in, and records it in the audit log.
+// Refused sign-ins name the account by the hash of the email tried, if any.
+func (u *UserOperator) countSignIn(ctx context.Context, method, email string, ut *dto.UserToken,
+	err error) (*dto.UserToken, error) {
+	detail := map[string]string{"method": method}
+	targetType, targetID := "", ""
+	if email != "" {
+		targetType, targetID = model.AuditTargetAccount, accountKey(email)
+	}
+	switch {
+	case errors.Is(err, model.ErrTooManyRequests):
+		u.metrics.CountSignIn(metrics.ResultLocked)
+		u.audit.Record(ctx, model.AuditSignInLocked, targetType, targetID, nil, detail)
+		return nil, err
+	case err != nil:
+		u.metrics.CountSignIn(metrics.ResultFailure)
+		// Malformed requests and server failures are not sign-in attempts worth auditing
+		if errors.Is(err, model.ErrUnauthenticated) || errors.Is(err, model.ErrPermissionDenied) {
+			u.audit.Record(ctx, model.AuditSignInFailed, targetType, targetID, nil, detail)
+		}
+		return nil, err
+	case ut.MFARequired:
+		u.metrics.CountSignIn(metrics.ResultChallenge)
+		u.audit.RecordFor(ctx, ut.User.ID, model.AuditSignInChallenged, model.AuditTargetUser, idString(ut.User.ID),
+			nil, detail)
+		return ut, nil
+	}
+	u.metrics.CountSignIn(metrics.ResultSuccess)
+	u.audit.RecordFor(ctx, ut.User.ID, model.AuditSignIn, model.AuditTargetUser, idString(ut.User.ID), nil, detail)
+	return ut, nil
+}
+
+func (u *UserOperator) signIn(ctx context.Context, email, password, ip string) (*dto.UserToken, error) {
 	if email == "" {
-		return nil, errors.New(errEmptyEmail)
+		return nil, errEmptyEmail
 	}
 	if password == "" {
-		return nil, errors.New(errEmptyPassword)
+		return nil, errEmptyPassword
+	}
+	if err := u.lockout.Check(ctx, email, ip); err != nil {
+		u.logger.WarnContext(ctx, "Sign-in refused", "account", accountKey(email), "client_ip", ip, logging.KeyError, err)
+		return nil, err
 	}
 	user, err := u.userManager.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return nil, err
+	}
+	// Hash even for unknown emails, so that they take as long as wrong passwords
+	salt := ""
+	if user != nil {
+		salt = user.Salt
+	}
+	passwordHash := sha1Hash(password + salt)
+	if user == nil || user.Password != passwordHash {
+		u.logger.WarnContext(ctx, "Sign-in failed", "account", accountKey(email), "client_ip", ip,
+			logging.KeyError, errBadCredentials)
+		u.lockout.Fail(ctx, email, ip)
+		return nil, errBadCredentials
+	}
+	if user.MFAEnabled {
+		// Failures are forgotten once the second factor is right too, so that
+		// the password cannot be used to reset the count of wrong codes
+		return u.challenge(ctx, user)
+	}
+	u.lockout.Succeed(ctx, email)
+	return u.issueToken(ctx, user, calcPerm(user))
+}
+
+// challenge answers the first step of a sign-in of a user with two-factor authentication,
+// with the challenge that the second step answers instead of a token
+func (u *UserOperator) challenge(ctx context.Context, user *model.User) (*dto.UserToken, error) {
+	challenge, err := u.mfa.Challenge(user)
+	if err != nil {
+		return nil, err
+	}
+	u.logger.InfoContext(ctx, "Sign-in challenged", "user_id", user.ID)
+	return &dto.UserToken{User: userDTO(user), MFARequired: true, ChallengeToken: challenge}, nil
+}
+
+func (u *UserOperator) signInMFA(ctx context.Context, challenge, code, ip string) (*dto.UserToken, error) {
+	user, err := u.mfa.ChallengeUser(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.checkCode(ctx, user, code, ip, true); err != nil {
+		return nil, err
+	}
+	return u.issueToken(ctx, user, calcPerm(user))
+}
+
+// issueToken issues the token of a signed-in user with the permission. Authors and admins without two-factor
+// authentication get the user permission only while it is enforced, enough to enroll.
+func (u *UserOperator) issueToken(ctx context.Context, user *model.User, perm model.UserPermission) (
+	*dto.UserToken, error) {
+	enroll := !user.MFAEnabled && u.mfa.Enforced(perm)
+	if enroll {
+		perm = model.PermUser
+	}
+	token, err := u.permManager.GenerateToken(user.ID, user.Email, perm, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+	u.logger.InfoContext(ctx, "User signed in", "user_id", user.ID, "mfa", user.MFAEnabled)
+	return &dto.UserToken{User: userDTO(user), Token: token, MFAEnrollmentRequired: enroll}, nil
+}
+
+// checkCode checks a second factor of the user under the sign-in lockout, so that codes cannot be guessed
+func (u *UserOperator) checkCode(ctx context.Context, user *model.User, code, ip string, recovery bool) error {
+	if err := u.lockout.Check(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	if err := u.mfa.Verify(ctx, user, code, recovery); err != nil {
+		if errors.Is(err, model.ErrUnauthenticated) {
+			u.logger.WarnContext(ctx, "Second factor failed", "user_id", user.ID, "client_ip", ip,
+				logging.KeyError, err)
+			u.lockout.Fail(ctx, user.Email, ip)
+		}
+		return err
+	}
+	u.lockout.Succeed(ctx, user.Email)
+	return nil
+}
+
+// EnrollTOTP starts the enrollment of an authenticator for the user
+func (u *UserOperator) EnrollTOTP(ctx context.Context, userID uint) (*dto.TOTPEnrollment, error) {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	secret, uri, err := u.mfa.Enroll(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.TOTPEnrollment{Secret: secret, URI: uri}, nil
+}
+
+// ConfirmTOTP turns two-factor authentication on with a code of the enrolled authenticator
+func (u *UserOperator) ConfirmTOTP(ctx context.Context, userID uint, code, ip string) (*dto.RecoveryCodes, error) {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.lockout.Check(ctx, user.Email, ip); err != nil {
+		return nil, err
+	}
+	codes, err := u.mfa.Confirm(ctx, user, code)
+	if errors.Is(err, model.ErrUnauthenticated) {
+		u.lockout.Fail(ctx, user.Email, ip)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.logger.InfoContext(ctx, "Two-factor authentication enabled", "user_id", user.ID)
+	return &dto.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableMFA turns two-factor authentication off for the user, with a code of the authenticator or a recovery code.
+// Authors and admins cannot while it is enforced.
+func (u *UserOperator) DisableMFA(ctx context.Context, userID uint, code, ip string) error {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.MFAEnabled {
+		return errMFADisabled
+	}
+	if u.mfa.Enforced(calcPerm(user)) {
+		return errMFAEnforced
+	}
+	if err := u.checkCode(ctx, user, code, ip, true); err != nil {
+		return err
+	}
+	if err := u.userManager.DisableMFA(ctx, user.ID); err != nil {
+		return err
+	}
+	u.logger.InfoContext(ctx, "Two-factor authentication disabled", "user_id", user.ID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, with a code of the authenticator
+func (u *UserOperator) RegenerateRecoveryCodes(ctx context.Context, userID uint, code, ip string) (
+	*dto.RecoveryCodes, error) {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, errMFADisabled
+	}
+	if err := u.checkCode(ctx, user, code, ip, false); err != nil {
+		return nil, err
+	}
+	codes, err := u.mfa.RegenerateRecoveryCodes(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	u.logger.InfoContext(ctx, "Recovery codes regenerated", "user_id", user.ID)
+	return &dto.RecoveryCodes{Codes: codes}, nil
+}
+
+// ResetMFA turns two-factor authentication off for a user who lost both the authenticator and the recovery codes
+func (u *UserOperator) ResetMFA(ctx context.Context, userID uint) error {
+	if _, err := u.userManager.GetUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := u.userManager.DisableMFA(ctx, userID); err != nil {
+		return err
+	}
+	u.logger.InfoContext(ctx, "Two-factor authentication reset", "user_id", userID)
+	u.audit.Record(ctx, model.AuditMFAReset, model.AuditTargetUser, idString(userID),
+		map[string]bool{"mfa_enabled": true}, map[string]bool{"mfa_enabled": false})
+	return nil
+}
+
+// SetMFAPolicy changes the policy of two-factor authentication, safe while serving
+func (u *UserOperator) SetMFAPolicy(p MFAPolicy) {
+	u.mfa.SetPolicy(p)
+}
+
+func userDTO(user *model.User) dto.User {
+	return dto.User{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFAEnabled,
+		DisplayName:   user.DisplayName,
+	}
+}
+
+// RequestEmailVerification mails the user a link to verify the email
+func (u *UserOperator) RequestEmailVerification(ctx context.Context, userID uint) error {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return errAlreadyVerified
+	}
+	return u.mailer.SendVerification(ctx, user)
+}
+
+// VerifyEmail marks the email of the token's user as verified
+func (u *UserOperator) VerifyEmail(ctx context.Context, token string) error {
+	user, err := u.actionUser(ctx, purposeVerifyEmail, token)
+	if err != nil {
+		return err
+	}
+	if err := u.mailer.verify(purposeVerifyEmail, token, verifyState(user)); err != nil {
+		return err
+	}
+	if err := u.userManager.SetEmailVerified(ctx, user.ID); err != nil {
+		return err
+	}
+	u.logger.InfoContext(ctx, "Email verified", "user_id", user.ID)
+	return nil
+}
+
+// RequestPasswordReset mails a link to reset the password to the user of the email, if there is one.
+// It answers alike either way, so that it tells nothing about which emails are registered.
+func (u *UserOperator) RequestPasswordReset(ctx context.Context, email string) error {
+	if email == "" {
+		return errEmptyEmail
+	}
+	// The mail is sent in the background, so that the answer takes as long whether it is sent or not
+	ctx, cancel := context.WithTimeout(detach(ctx), mailTimeout)
+	go func() {
+		defer cancel()
+		user, err := u.userManager.GetUserByEmail(ctx, email)
+		if err != nil {
+			if !errors.Is(err, model.ErrNotFound) {
+				u.logger.ErrorContext(ctx, "Failed to find the user to reset", logging.KeyError, err)
+			}
+			return
+		}
+		if err := u.mailer.SendPasswordReset(ctx, user); err != nil {
+			u.logger.ErrorContext(ctx, "Failed to send the password reset mail", "user_id", user.ID,
+				logging.KeyError, err)
+		}
+	}()
+	return nil
+}
+
+// ResetPassword sets a new password for the token's user, and lifts the lockout of the account
+func (u *UserOperator) ResetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return errEmptyPassword
+	}
+	user, err := u.actionUser(ctx, purposeResetPassword, token)
+	if err != nil {
+		return err
+	}
+	if err := u.mailer.verify(purposeResetPassword, token, resetState(user)); err != nil {
+		return err
+	}
+	salt := randomString(saltLen)
+	if err := u.userManager.UpdatePassword(ctx, user.ID, sha1Hash(password+salt), salt); err != nil {
+		return err
+	}
+	// The reset link proves the user owns the email
+	if !user.EmailVerified {
+		if err := u.userManager.SetEmailVerified(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	if err := u.lockout.Unlock(ctx, user.Email, ""); err != nil {
+		u.logger.WarnContext(ctx, "Failed to lift the lockout", "user_id", user.ID, logging.KeyError, err)
+	}
+	u.logger.InfoContext(ctx, "Password reset, tokens revoked", "user_id", user.ID)
+	return nil
+}
+
+// detach returns a context for work that outlives the request, with the request's correlation IDs only.
+// Adaptors may reuse the request context, like gin does, once the request is served.
+func detach(ctx context.Context) context.Context {
+	detached := logging.WithRequestID(context.Background(), logging.RequestID(ctx))
+	return trace.ContextWithSpanContext(detached, trace.SpanContextFromContext(ctx))
+}
+
+// actionUser returns the user an action token was issued for
+func (u *UserOperator) actionUser(ctx context.Context, purpose, token string) (*model.User, error) {
+	id, err := u.mailer.subject(purpose, token)
 	if err != nil {
 		return nil, err
 	}
-	passwordHash := sha1Hash(password + user.Salt)
-	if user.Password != passwordHash {
-		return nil, errors.New("wrong password")
+	user, err := u.userManager.GetUser(ctx, id)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, errInvalidActionToken
+	}
+	return user, err
+}
+
+// Unlock lifts the sign-in lockouts of the account and the IP
+func (u *UserOperator) Unlock(ctx context.Context, email, ip string) error {
+	if err := u.lockout.Unlock(ctx, email, ip); err != nil {
+		return err
+	}
+	// Accounts go by the hash of their email, as in the lockout
+	account := ""
+	if email != "" {
+		account = accountKey(email)
+		u.audit.Record(ctx, model.AuditUnlock, model.AuditTargetAccount, account, nil, nil)
+	}
+	u.logger.InfoContext(ctx, "Sign-in lockout lifted", "account", account, "ip", ip)
+	if ip != "" {
+		u.audit.Record(ctx, model.AuditUnlock, model.AuditTargetIP, ip, nil, nil)
 	}
-	token, err := u.permManager.GenerateToken(user.ID, user.Email, calcPerm(user.IsAdmin))
+	return nil
+}
+
+// GetProfile gets the profile of the user
+func (u *UserOperator) GetProfile(ctx context.Context, userID uint) (*dto.Profile, error) {
+	user, err := u.userManager.GetUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	return profileDTO(user), nil
+}
 
-	return &dto.UserToken{
-		User: dto.User{
-			ID:    user.ID,
-			Email: user.Email,
-		},
-		Token: token,
+// UpdateProfile changes the given fields of the user's profile
+func (u *UserOperator) UpdateProfile(ctx context.Context, userID uint, p *dto.ProfileUpdate) (*dto.Profile, error) {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if p.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*p.DisplayName)
+	}
+	if p.Bio != nil {
+		user.Bio = strings.TrimSpace(*p.Bio)
+	}
+	if p.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*p.AvatarURL)
+	}
+	if utf8.RuneCountInString(user.DisplayName) > displayNameLen {
+		return nil, errDisplayName
+	}
+	if utf8.RuneCountInString(user.Bio) > bioLen {
+		return nil, errBio
+	}
+	if user.AvatarURL != "" && !validAvatarURL(user.AvatarURL) {
+		return nil, errAvatarURL
+	}
+	if err := u.userManager.UpdateProfile(ctx, user.ID, user.DisplayName, user.Bio, user.AvatarURL); err != nil {
+		return nil, err
+	}
+	return profileDTO(user), nil
+}
+
+// ChangePassword sets a new password for the user, who proves the current one from the client IP
+func (u *UserOperator) ChangePassword(ctx context.Context, userID uint, current, password, ip string) error {
+	if password == "" {
+		return errEmptyPassword
+	}
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := u.checkPassword(ctx, user, current, ip); err != nil {
+		return err
+	}
+	salt := randomString(saltLen)
+	if err := u.userManager.UpdatePassword(ctx, user.ID, sha1Hash(password+salt), salt); err != nil {
+		return err
+	}
+	u.logger.InfoContext(ctx, "Password changed, tokens revoked", "user_id", user.ID)
+	return nil
+}
+
+// RequestEmailChange mails the new email a link to confirm it, and keeps the old email until then
+func (u *UserOperator) RequestEmailChange(ctx context.Context, userID uint, email, password, ip string) error {
+	email = strings.TrimSpace(email)
+	if addr, err := netmail.ParseAddress(email); err != nil || addr.Address != email {
+		return errInvalidEmail
+	}
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(email, user.Email) {
+		return errSameEmail
+	}
+	if err := u.checkPassword(ctx, user, password, ip); err != nil {
+		return err
+	}
+	if err := u.checkEmailFree(ctx, user.ID, email); err != nil {
+		return err
+	}
+	if err := u.userManager.SetPendingEmail(ctx, user.ID, email); err != nil {
+		return err
+	}
+	user.PendingEmail = email
+	return u.mailer.SendEmailChange(ctx, user)
+}
+
+// ConfirmEmailChange makes the pending email of the token's user its verified email
+func (u *UserOperator) ConfirmEmailChange(ctx context.Context, token string) error {
+	user, err := u.actionUser(ctx, purposeChangeEmail, token)
+	if err != nil {
+		return err
+	}
+	if err := u.mailer.verify(purposeChangeEmail, token, changeEmailState(user)); err != nil {
+		return err
+	}
+	if user.PendingEmail == "" {
+		return errNoEmailChange
+	}
+	// Another account may have taken the email since the change was asked for
+	if err := u.checkEmailFree(ctx, user.ID, user.PendingEmail); err != nil {
+		return err
+	}
+	if err := u.userManager.ChangeEmail(ctx, user.ID, user.PendingEmail); err != nil {
+		return err
+	}
+	u.logger.InfoContext(ctx, "Email changed", "user_id", user.ID)
+	return nil
+}
+
+// DeleteAccount deletes the user, who proves the password from the client IP.
+// Like an erasure, it removes or pseudonymizes what the user leaves behind, like the user's reviews.
+func (u *UserOperator) DeleteAccount(ctx context.Context, userID uint, password, ip string) error {
+	user, err := u.userManager.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := u.checkPassword(ctx, user, password, ip); err != nil {
+		return err
+	}
+	report, err := u.erase(ctx, user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+	u.logger.InfoContext(ctx, "Account deleted", "user_id", user.ID, "verified", report.Verified)
+	u.audit.Record(ctx, model.AuditAccountDelete, model.AuditTargetUser, idString(user.ID), nil,
+		map[string]bool{"verified": report.Verified})
+	return nil
+}
+
+// checkPassword checks the password of the user under the sign-in lockout, so that it cannot be guessed
+func (u *UserOperator) checkPassword(ctx context.Context, user *model.User, password, ip string) error {
+	if user.Password == "" {
+		return errNoPassword
+	}
+	if err := u.lockout.Check(ctx, user.Email, ip); err != nil {
+		return err
+	}
+	if sha1Hash(password+user.Salt) != user.Password {
+		u.logger.WarnContext(ctx, "Password check failed", "user_id", user.ID, "client_ip", ip)
+		u.lockout.Fail(ctx, user.Email, ip)
+		return errWrongPassword
+	}
+	u.lockout.Succeed(ctx, user.Email)
+	return nil
+}
+
+// checkEmailFree makes sure no other user has the email
+func (u *UserOperator) checkEmailFree(ctx context.Context, userID uint, email string) error {
+	other, err := u.userManager.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	case other.ID != userID:
+		return errEmailInUse
+	}
+	return nil
+}
+
+func validAvatarURL(s string) bool {
+	if len(s) > avatarURLLen {
+		return false
+	}
+	parsed, err := url.Parse(s)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func profileDTO(user *model.User) *dto.Profile {
+	return &dto.Profile{
+		User:         userDTO(user),
+		Bio:          user.Bio,
+		AvatarURL:    user.AvatarURL,
+		PendingEmail: user.PendingEmail,
+		CreatedAt:    user.CreatedAt,
+	}
+}
+
+// CreateAPIKey issues an API key of the caller, which gets the caller's permission, narrowed by its scopes
+func (u *UserOperator) CreateAPIKey(ctx context.Context, caller *model.UserIdentity, req *dto.APIKeyRequest) (
+	*dto.APIKey, error) {
+	k, raw, err := u.apiKeys.Create(ctx, caller.UserID, caller.Permission, req.Name, req.Scopes, req.ExpiresDays)
+	if err != nil {
+		return nil, err
+	}
+	result := apiKeyDTO(k)
+	result.Key = raw
+	return result, nil
+}
+
+// ListAPIKeys lists the API keys of the user
+func (u *UserOperator) ListAPIKeys(ctx context.Context, userID uint) ([]*dto.APIKey, error) {
+	keys, err := u.apiKeys.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*dto.APIKey, len(keys))
+	for i, k := range keys {
+		result[i] = apiKeyDTO(k)
+	}
+	return result, nil
+}
+
+// RevokeAPIKey revokes an API key of the user
+func (u *UserOperator) RevokeAPIKey(ctx context.Context, userID, id uint) error {
+	return u.apiKeys.Revoke(ctx, userID, id)
+}
+
+// RevokeUserAPIKeys revokes all API keys of a user, like when they leak
+func (u *UserOperator) RevokeUserAPIKeys(ctx context.Context, userID uint) error {
+	if _, err := u.userManager.GetUser(ctx, userID); err != nil {
+		return err
+	}
+	n, err := u.apiKeys.RevokeAll(ctx, userID)
+	if err != nil {
+		return err
+	}
+	u.logger.InfoContext(ctx, "API keys revoked", "user_id", userID, "count", n)
+	u.audit.Record(ctx, model.AuditAPIKeysRevoke, model.AuditTargetUser, idString(userID), nil,
+		map[string]int64{"revoked": n})
+	return nil
+}
+
+// AuthenticateAPIKey returns the identity behind the API key.
+// Keys keep the permission they were created with, capped at the roles their user still has.
+func (u *UserOperator) AuthenticateAPIKey(ctx context.Context, key string) (*model.UserIdentity, error) {
+	k, user, err := u.apiKeys.Authenticate(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	perm := k.Permission
+	if max := calcPerm(user); perm > max {
+		perm = max
+	}
+	if !user.MFAEnabled && u.mfa.Enforced(perm) {
+		perm = model.PermUser
+	}
+	return &model.UserIdentity{
+		UserID:     user.ID,
+		Email:      user.Email,
+		Permission: perm,
+		APIKeyID:   k.ID,
+		Scopes:     k.ScopeList(),
 	}, nil
 }
 
+func apiKeyDTO(k *model.APIKey) *dto.APIKey {
+	scopes := k.ScopeList()
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+	return &dto.APIKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     names,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
 // HasPermission checks if user has the given permission.
 func (u *UserOperator) HasPermission(tokenResult string, perm model.UserPermission) (bool, error) {
 	return u.permManager.HasPermission(tokenResult, perm)
 }
 
-func calcPerm(isAdmin bool) model.UserPermission {
-	perm := model.PermUser
-	if isAdmin {
-		perm = model.PermAdmin
+// ParseToken returns the user identity behind the token, without checking that the token still stands.
+// Use Authenticate for anything but telling callers apart.
+func (u *UserOperator) ParseToken(tokenResult string) (*model.UserIdentity, error) {
+	return u.permManager.ParseToken(tokenResult)
+}
+
+// Authenticate returns the user identity behind the token, as long as the account still exists
+// and has not revoked its tokens since, like by changing its password
+func (u *UserOperator) Authenticate(ctx context.Context, tokenResult string) (*model.UserIdentity, error) {
+	id, err := u.permManager.ParseToken(tokenResult)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", model.ErrUnauthenticated, err)
+	}
+	user, err := u.userManager.GetUser(ctx, id.UserID)
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		return nil, errAccountGone
+	case err != nil:
+		return nil, err
+	case user.TokenVersion != id.TokenVersion:
+		return nil, errTokenRevoked
+	}
+	// Users who lost a role since keep the permission of the roles they still have
+	if max := calcPerm(user); id.Permission > max {
+		id.Permission = max
+	}
+	return id, nil
+}
+
+// calcPerm returns the permission of the roles the user has now
+func calcPerm(user *model.User) model.UserPermission {
+	switch {
+	case user.IsAdmin:
+		return model.PermAdmin
+	case user.IsAuthor:
+		return model.PermAuthor
 	}
-	return perm
+	return model.PermUser
 }
 
 func randomString(length int) string {
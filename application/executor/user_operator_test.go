@@ -0,0 +1,62 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/token"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keeper := token.NewTokenKeeper("secret", 1)
+	users := &fakeUsers{users: map[uint]*model.User{
+		1: {ID: 1, Email: "a@example.com", TokenVersion: 2},
+		2: {ID: 2, Email: "admin@example.com", IsAdmin: true},
+		3: {ID: 3, Email: "former-admin@example.com"},
+		4: {ID: 4, Email: "author@example.com", IsAuthor: true},
+	}}
+	u := newTestUserOperator(users)
+	tests := []struct {
+		name     string
+		userID   uint
+		perm     model.UserPermission
+		version  uint
+		wantErr  error
+		wantPerm model.UserPermission
+	}{
+		{"current token", 1, model.PermUser, 2, nil, model.PermUser},
+		{"issued before a password change", 1, model.PermUser, 1, errTokenRevoked, 0},
+		{"deleted account", 9, model.PermUser, 0, errAccountGone, 0},
+		{"admin", 2, model.PermAdmin, 0, nil, model.PermAdmin},
+		{"admin role removed since", 3, model.PermAdmin, 0, nil, model.PermUser},
+		{"author role removed since", 3, model.PermAuthor, 0, nil, model.PermUser},
+		{"admin now an author only", 4, model.PermAdmin, 0, nil, model.PermAuthor},
+		{"author", 4, model.PermAuthor, 0, nil, model.PermAuthor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := keeper.GenerateToken(tt.userID, "", tt.perm, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := u.Authenticate(context.Background(), signed)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !errors.Is(err, model.ErrUnauthenticated) {
+					t.Fatalf("Authenticate error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Permission != tt.wantPerm {
+				t.Errorf("permission = %v, want %v", id.Permission, tt.wantPerm)
+			}
+		})
+	}
+	if _, err := u.Authenticate(context.Background(), "not.a.token"); !errors.Is(err, model.ErrUnauthenticated) {
+		t.Errorf("Authenticate of a bad token = %v, want ErrUnauthenticated", err)
+	}
+}
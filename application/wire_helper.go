@@ -4,36 +4,264 @@ Package application provides all common structures and functions of the applicat
 package application
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+
+	"literank.com/rest-books/application/dto"
+	"literank.com/rest-books/application/executor"
 	"literank.com/rest-books/domain/gateway"
 	"literank.com/rest-books/infrastructure/cache"
 	"literank.com/rest-books/infrastructure/config"
 	"literank.com/rest-books/infrastructure/database"
+	"literank.com/rest-books/infrastructure/logging"
+	"literank.com/rest-books/infrastructure/mail"
+	"literank.com/rest-books/infrastructure/metrics"
+	"literank.com/rest-books/infrastructure/ratelimit"
+	"literank.com/rest-books/infrastructure/sso"
 	"literank.com/rest-books/infrastructure/token"
+	"literank.com/rest-books/infrastructure/tracing"
 )
 
 // WireHelper is the helper for dependency injection
 type WireHelper struct {
+	config           atomic.Pointer[config.Config]
+	reloadMu         sync.Mutex
+	configStatus     dto.ConfigStatus
+	logger           *slog.Logger
+	logLevel         *slog.LevelVar
+	metrics          *metrics.Metrics
+	tracerProvider   *tracing.Provider
 	sqlPersistence   *database.MySQLPersistence
 	noSQLPersistence *database.MongoPersistence
 	kvStore          *cache.RedisCache
+	cache            *cache.Cache
+	rateLimiter      *ratelimit.Limiter
 	tokenKeeper      *token.Keeper
+
+	bookOperator   *executor.BookOperator
+	reviewOperator *executor.ReviewOperator
+	userOperator   *executor.UserOperator
+	healthOperator *executor.HealthOperator
+	audit          *executor.Audit
 }
 
 // NewWireHelper constructs a new WireHelper
 func NewWireHelper(c *config.Config) (*WireHelper, error) {
-	db, err := database.NewMySQLPersistence(c.DB.DSN, c.App.PageSize)
+	logger, logLevel, err := logging.NewLogger(&c.Log)
+	if err != nil {
+		return nil, err
+	}
+	// Metrics are registered here once, so that every backend reports the same names
+	m := metrics.New()
+	tp, err := tracing.NewProvider(&c.Trace)
 	if err != nil {
 		return nil, err
 	}
-	mdb, err := database.NewMongoPersistence(c.DB.MongoURI, c.DB.MongoDBName)
+	// Operators and adaptors take the global tracer, so set it before building them
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(tracing.Propagator)
+	db, err := database.NewMySQLPersistence(&c.DB, c.App.PageSize, logger, m.GormPlugin(), tp.GormPlugin())
 	if err != nil {
 		return nil, err
 	}
-	kv := cache.NewRedisCache(&c.Cache)
+	mdb, err := database.NewMongoPersistence(&c.DB, logger, m.MongoMonitor(), tp.MongoMonitor())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if c.DB.AutoMigrate {
+		if err := Migrate(context.Background(), db, mdb, logger); err != nil {
+			mdb.Close(context.Background())
+			db.Close()
+			return nil, err
+		}
+	}
+	kv := cache.NewRedisCache(&c.Cache, tp.RedisHook())
 	tk := token.NewTokenKeeper(c.App.TokenSecret, uint(c.App.TokenHours))
-	return &WireHelper{
+	w := &WireHelper{logger: logger, logLevel: logLevel, metrics: m, tracerProvider: tp,
 		sqlPersistence: db, noSQLPersistence: mdb,
-		kvStore: kv, tokenKeeper: tk}, nil
+		kvStore: kv, tokenKeeper: tk}
+	w.config.Store(c)
+	w.cache = cache.NewCache(m.CacheHelper(kv), &c.Cache)
+	w.rateLimiter = ratelimit.NewLimiter(kv.Client(), &c.RateLimit, logger)
+	w.configStatus = dto.ConfigStatus{Version: 1, LoadedAt: time.Now(), Rejected: []string{}}
+	// Operators are shared by all adaptors, so that every protocol sees the same listeners
+	w.audit = executor.NewAudit(w.AuditManager(), logger)
+	w.bookOperator = executor.NewBookOperator(w.BookManager(), w.cache, w.audit, logger)
+	w.reviewOperator = executor.NewReviewOperator(w.ReviewManager(), w.UserManager(), w.cache, w.audit, logger)
+	accountMailer, err := w.accountMailer(&c.Mail)
+	if err != nil {
+		w.Close(context.Background())
+		return nil, err
+	}
+	w.userOperator = executor.NewUserOperator(w.UserManager(), w.PermManager(),
+		executor.NewLockout(kv, lockoutPolicy(&c.Lockout), w.audit, logger), accountMailer,
+		executor.NewMFA(w.UserManager(), tk, mfaPolicy(&c.MFA), logger),
+		w.singleSignOn(&c.OIDC, kv, accountMailer),
+		executor.NewAPIKeys(w.APIKeyManager(), w.UserManager(), apiKeyPolicy(&c.APIKeys), logger), w.audit, logger, m)
+	w.userOperator.AddDataHolder(w.reviewOperator)
+	w.userOperator.AddDataHolder(w.audit)
+	// The app can still serve from the databases when the cache is down
+	w.healthOperator = executor.NewHealthOperator(logger,
+		&executor.Dependency{Name: "mysql", Critical: true, Ping: db.Ping},
+		&executor.Dependency{Name: "mongo", Critical: true, Ping: mdb.Ping},
+		&executor.Dependency{Name: "redis", Critical: false, Ping: kv.Ping},
+	)
+	return w, nil
+}
+
+// Close shuts down every backend, the cache first and the tracer last,
+// so that the spans of the other shutdowns are still exported
+func (w *WireHelper) Close(ctx context.Context) error {
+	return errors.Join(
+		w.kvStore.Close(),
+		w.noSQLPersistence.Close(ctx),
+		w.sqlPersistence.Close(),
+		w.tracerProvider.Shutdown(ctx),
+	)
+}
+
+// Migrate applies the pending MySQL migrations and brings the MongoDB validator and indexes up to date
+func Migrate(ctx context.Context, db *database.MySQLPersistence, mdb *database.MongoPersistence,
+	logger *slog.Logger) error {
+	m, err := db.Migrator(logger)
+	if err != nil {
+		return err
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		return err
+	}
+	return mdb.EnsureSchema(ctx, logger)
+}
+
+// BookOperator returns the shared BookOperator
+func (w *WireHelper) BookOperator() *executor.BookOperator {
+	return w.bookOperator
+}
+
+// ReviewOperator returns the shared ReviewOperator
+func (w *WireHelper) ReviewOperator() *executor.ReviewOperator {
+	return w.reviewOperator
+}
+
+// UserOperator returns the shared UserOperator
+func (w *WireHelper) UserOperator() *executor.UserOperator {
+	return w.userOperator
+}
+
+// Audit returns the shared audit log
+func (w *WireHelper) Audit() *executor.Audit {
+	return w.audit
+}
+
+// HealthOperator returns the shared HealthOperator
+func (w *WireHelper) HealthOperator() *executor.HealthOperator {
+	return w.healthOperator
+}
+
+// Config returns the active global configuration
+func (w *WireHelper) Config() *config.Config {
+	return w.config.Load()
+}
+
+// Reload validates the new config and applies the settings that are safe to change while serving.
+// Changes of other settings are rejected, and kept until a restart.
+func (w *WireHelper) Reload(next *config.Config) (*dto.ConfigStatus, error) {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	if err := next.Validate(); err != nil {
+		w.configStatus.LastError = err.Error()
+		return nil, err
+	}
+	// Whatever can fail is done before anything is applied, so that a reload applies all of its changes or none
+	level, err := logging.ParseLevel(next.Log.Level)
+	if err != nil {
+		w.configStatus.LastError = err.Error()
+		return nil, err
+	}
+	active := *w.Config()
+	applied := false
+	if active.App.PageSize != next.App.PageSize {
+		// Cached pages of the old size are served until they expire
+		w.sqlPersistence.SetPageSize(next.App.PageSize)
+		active.App.PageSize = next.App.PageSize
+		applied = true
+	}
+	if active.App.DrainDelay != next.App.DrainDelay {
+		// Read at shutdown
+		active.App.DrainDelay = next.App.DrainDelay
+		applied = true
+	}
+	if active.Cache.TTL != next.Cache.TTL || active.Cache.Policies != next.Cache.Policies {
+		w.cache.SetPolicies(&next.Cache)
+		active.Cache.TTL = next.Cache.TTL
+		active.Cache.Policies = next.Cache.Policies
+		applied = true
+	}
+	if active.RateLimit != next.RateLimit {
+		w.rateLimiter.SetPolicies(&next.RateLimit)
+		active.RateLimit = next.RateLimit
+		applied = true
+	}
+	if active.MFA != next.MFA {
+		w.userOperator.SetMFAPolicy(mfaPolicy(&next.MFA))
+		active.MFA = next.MFA
+		applied = true
+	}
+	if active.Log.Level != next.Log.Level {
+		w.logLevel.Set(level)
+		active.Log.Level = next.Log.Level
+		applied = true
+	}
+	w.configStatus.Rejected = config.Diff(&active, next)
+	w.configStatus.LastError = ""
+	if applied {
+		w.config.Store(&active)
+		w.configStatus.Version++
+		w.configStatus.LoadedAt = time.Now()
+	}
+	return w.statusLocked(), nil
+}
+
+// ConfigStatus returns the active config, with its secrets redacted, and the result of the last reload
+func (w *WireHelper) ConfigStatus() *dto.ConfigStatus {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	return w.statusLocked()
+}
+
+func (w *WireHelper) statusLocked() *dto.ConfigStatus {
+	s := w.configStatus
+	s.Config = w.Config().Redacted()
+	s.Rejected = append([]string{}, s.Rejected...)
+	return &s
+}
+
+// Logger returns the structured logger
+func (w *WireHelper) Logger() *slog.Logger {
+	return w.logger
+}
+
+// LogLevel returns the level of the logger, which can be changed at runtime
+func (w *WireHelper) LogLevel() *slog.LevelVar {
+	return w.logLevel
+}
+
+// Metrics returns the metrics shared by all adaptors and backends
+func (w *WireHelper) Metrics() *metrics.Metrics {
+	return w.metrics
+}
+
+// TracerProvider returns the tracer provider, to be shut down on exit
+func (w *WireHelper) TracerProvider() *tracing.Provider {
+	return w.tracerProvider
 }
 
 // BookManager returns an instance of BookManager
@@ -46,6 +274,16 @@ func (w *WireHelper) UserManager() gateway.UserManager {
 	return w.sqlPersistence
 }
 
+// APIKeyManager returns an instance of APIKeyManager
+func (w *WireHelper) APIKeyManager() gateway.APIKeyManager {
+	return w.sqlPersistence
+}
+
+// AuditManager returns an instance of AuditManager
+func (w *WireHelper) AuditManager() gateway.AuditManager {
+	return w.sqlPersistence
+}
+
 // PermManager returns an instance of PermManager
 func (w *WireHelper) PermManager() gateway.PermissionManager {
 	return w.tokenKeeper
@@ -56,7 +294,86 @@ func (w *WireHelper) ReviewManager() gateway.ReviewManager {
 	return w.noSQLPersistence
 }
 
-// CacheHelper returns an instance of CacheHelper
-func (w *WireHelper) CacheHelper() cache.Helper {
-	return w.kvStore
+// Cache returns the cache shared by all operators
+func (w *WireHelper) Cache() *cache.Cache {
+	return w.cache
+}
+
+// accountMailer builds the mailer of account actions over the configured mail driver
+func (w *WireHelper) accountMailer(c *config.MailConfig) (*executor.AccountMailer, error) {
+	mailer, err := mail.NewMailer(c, w.logger)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := mail.NewTemplates(c.Locale)
+	if err != nil {
+		return nil, err
+	}
+	return executor.NewAccountMailer(mailer, templates, w.tokenKeeper, executor.AccountMailSettings{
+		BaseURL:   c.BaseURL,
+		VerifyTTL: time.Hour * time.Duration(c.VerifyHours),
+		ResetTTL:  time.Minute * time.Duration(c.ResetMinutes),
+	}, w.logger), nil
+}
+
+// singleSignOn builds the single sign-on with the configured OpenID Connect provider, nil if it is off
+func (w *WireHelper) singleSignOn(c *config.OIDCConfig, store cache.Helper, a *executor.AccountMailer) *executor.SSO {
+	if !c.Enabled {
+		return nil
+	}
+	return executor.NewSSO(sso.NewOIDCProvider(c), w.UserManager(), store, a.Locale, executor.SSOPolicy{
+		Provision:   c.Provision,
+		MapRoles:    c.RoleClaim != "",
+		AdminRoles:  splitList(c.AdminRoles),
+		AuthorRoles: splitList(c.AuthorRoles),
+		StateTTL:    time.Minute * time.Duration(c.StateMinutes),
+	}, w.audit, w.logger)
+}
+
+// splitList splits a comma-separated config list
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// lockoutPolicy converts the lockout config into the policy of the operator
+func lockoutPolicy(c *config.LockoutConfig) executor.LockoutPolicy {
+	return executor.LockoutPolicy{
+		MaxFailures:   c.MaxFailures,
+		MaxIPFailures: c.MaxIPFailures,
+		Window:        time.Second * time.Duration(c.Window),
+		Duration:      time.Second * time.Duration(c.Duration),
+		Delay:         time.Millisecond * time.Duration(c.Delay),
+		MaxDelay:      time.Millisecond * time.Duration(c.MaxDelay),
+	}
+}
+
+// mfaPolicy converts the two-factor authentication config into the policy of the operator
+func mfaPolicy(c *config.MFAConfig) executor.MFAPolicy {
+	return executor.MFAPolicy{
+		Issuer:        c.Issuer,
+		Enforce:       c.Enforce,
+		ChallengeTTL:  time.Second * time.Duration(c.ChallengeSeconds),
+		Skew:          c.Skew,
+		RecoveryCodes: c.RecoveryCodes,
+	}
+}
+
+// apiKeyPolicy converts the API keys config into the policy of the operator
+func apiKeyPolicy(c *config.APIKeysConfig) executor.APIKeyPolicy {
+	return executor.APIKeyPolicy{
+		MaxPerUser: c.MaxPerUser,
+		DefaultTTL: 24 * time.Hour * time.Duration(c.DefaultDays),
+		MaxTTL:     24 * time.Hour * time.Duration(c.MaxDays),
+	}
+}
+
+// RateLimiter returns the rate limiter shared by all adaptors
+func (w *WireHelper) RateLimiter() *ratelimit.Limiter {
+	return w.rateLimiter
 }
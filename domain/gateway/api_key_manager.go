@@ -0,0 +1,22 @@
+package gateway
+
+import (
+	"context"
+	"time"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// APIKeyManager manages the API keys of users
+type APIKeyManager interface {
+	CreateAPIKey(ctx context.Context, k *model.APIKey) (uint, error)
+	// GetAPIKeyByPrefix gets the key of the prefix, revoked or not
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error)
+	// ListAPIKeys lists the keys of the user, newest first
+	ListAPIKeys(ctx context.Context, userID uint) ([]*model.APIKey, error)
+	TouchAPIKey(ctx context.Context, id uint, t time.Time) error
+	// RevokeAPIKey revokes the unrevoked key of the user, and fails with ErrNotFound if there is none
+	RevokeAPIKey(ctx context.Context, userID, id uint) error
+	// RevokeAPIKeys revokes all keys of the user, and returns how many
+	RevokeAPIKeys(ctx context.Context, userID uint) (int64, error)
+}
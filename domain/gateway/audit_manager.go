@@ -0,0 +1,21 @@
+package gateway
+
+import (
+	"context"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// AuditManager keeps the audit log, whose entries are only ever appended
+type AuditManager interface {
+	// AppendAudit chains the entry to the last one, sets its hash and appends it
+	AppendAudit(ctx context.Context, e *model.AuditEntry) error
+	// ListAudit lists the entries matching the filter, newest first
+	ListAudit(ctx context.Context, f *model.AuditFilter) ([]*model.AuditEntry, error)
+	// ListAuditChain lists at most limit entries after the one of afterID, oldest first
+	ListAuditChain(ctx context.Context, afterID uint, limit int) ([]*model.AuditEntry, error)
+	// ListAuditOfUser lists the entries the user did, or which target the user, oldest first
+	ListAuditOfUser(ctx context.Context, userID uint) ([]*model.AuditEntry, error)
+	// EraseAuditOfUser erases the personal fields of the entries ListAuditOfUser lists, and returns how many
+	EraseAuditOfUser(ctx context.Context, userID uint) (int64, error)
+}
@@ -9,11 +9,17 @@ import (
 	"literank.com/rest-books/domain/model"
 )
 
-// BookManager manages all books
+// BookManager manages all books, and keeps a revision of every change of them made by the editor
 type BookManager interface {
-	CreateBook(ctx context.Context, b *model.Book) (uint, error)
-	UpdateBook(ctx context.Context, id uint, b *model.Book) error
+	CreateBook(ctx context.Context, b *model.Book, editorID uint) (uint, error)
+	UpdateBook(ctx context.Context, id uint, b *model.Book, editorID uint) error
 	DeleteBook(ctx context.Context, id uint) error
 	GetBook(ctx context.Context, id uint) (*model.Book, error)
 	GetBooks(ctx context.Context, offset int, keyword string) ([]*model.Book, error)
+	// RevertBook restores the book to the revision, as a new revision
+	RevertBook(ctx context.Context, id, rev uint, editorID uint) (*model.BookRevision, error)
+	// GetBookRevisions lists the revisions of the book, the latest first, even once it is deleted.
+	// It fails with ErrNotFound for a book that never existed.
+	GetBookRevisions(ctx context.Context, id uint, offset int) ([]*model.BookRevision, error)
+	GetBookRevision(ctx context.Context, id, rev uint) (*model.BookRevision, error)
 }
@@ -0,0 +1,16 @@
+package gateway
+
+import (
+	"context"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// IdentityProvider signs users in with an external OpenID Connect provider,
+// by the authorization code flow with PKCE
+type IdentityProvider interface {
+	// AuthURL returns where to send the user to sign in, for the state, the nonce and the PKCE verifier
+	AuthURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange redeems the code of a callback, and returns the claims of its verified ID token
+	Exchange(ctx context.Context, code, verifier, nonce string) (*model.ExternalClaims, error)
+}
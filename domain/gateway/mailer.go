@@ -0,0 +1,12 @@
+package gateway
+
+import (
+	"context"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// Mailer delivers mails
+type Mailer interface {
+	Send(ctx context.Context, m *model.Mail) error
+}
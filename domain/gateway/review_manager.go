@@ -13,4 +13,10 @@ type ReviewManager interface {
 	DeleteReview(ctx context.Context, id string) error
 	GetReview(ctx context.Context, id string) (*model.Review, error)
 	GetReviewsOfBook(ctx context.Context, bookID uint, keyword string) ([]*model.Review, error)
+	GetReviewsOfBooks(ctx context.Context, bookIDs []uint) ([]*model.Review, error)
+	// GetReviewsOfUser gets the reviews the user posted
+	GetReviewsOfUser(ctx context.Context, userID uint) ([]*model.Review, error)
+	// AnonymizeReviews unlinks the reviews of the user from it under the author name,
+	// and returns the books of those reviews and how many there were
+	AnonymizeReviews(ctx context.Context, userID uint, author string) ([]uint, int64, error)
 }
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"time"
 
 	"literank.com/rest-books/domain/model"
 )
@@ -10,10 +11,60 @@ import (
 type UserManager interface {
 	CreateUser(ctx context.Context, u *model.User) (uint, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUser(ctx context.Context, id uint) (*model.User, error)
+	SetEmailVerified(ctx context.Context, id uint) error
+	// UpdatePassword sets the password hash and salt of the user, and revokes the user's tokens
+	UpdatePassword(ctx context.Context, id uint, password, salt string) error
+	// RevokeTokens raises the token version of the user, so that no token issued before is accepted
+	RevokeTokens(ctx context.Context, id uint) error
+	// SetTOTPSecret keeps the secret of an authenticator being enrolled, with two-factor authentication off
+	SetTOTPSecret(ctx context.Context, id uint, secret string) error
+	// EnableMFA turns two-factor authentication on, with the hashes of new recovery codes
+	EnableMFA(ctx context.Context, id uint, codeHashes []string) error
+	// DisableMFA turns two-factor authentication off, and drops the secret and the recovery codes
+	DisableMFA(ctx context.Context, id uint) error
+	// UseTOTPStep records the time step of an accepted code and counts it in MFACounter,
+	// and tells false if it is not after the last one
+	UseTOTPStep(ctx context.Context, id uint, step int64) (bool, error)
+	// SetRecoveryCodes replaces the recovery codes of the user
+	SetRecoveryCodes(ctx context.Context, id uint, codeHashes []string) error
+	// UseRecoveryCode marks the unused recovery code as used and counts it in MFACounter,
+	// and tells false if there is none
+	UseRecoveryCode(ctx context.Context, id uint, codeHash string) (bool, error)
+	// GetUserByIdentity gets the user linked to the account of an external provider
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error)
+	// LinkIdentity links the account of an external provider to an existing user
+	LinkIdentity(ctx context.Context, ext *model.ExternalIdentity) error
+	// ProvisionUser creates a user for the account of an external provider, linked to it
+	ProvisionUser(ctx context.Context, u *model.User, ext *model.ExternalIdentity) (uint, error)
+	// SetRoles grants or revokes the admin and author roles of the user
+	SetRoles(ctx context.Context, id uint, isAdmin, isAuthor bool) error
+	UpdateProfile(ctx context.Context, id uint, displayName, bio, avatarURL string) error
+	// SetPendingEmail keeps the new email of a change until it is confirmed
+	SetPendingEmail(ctx context.Context, id uint, email string) error
+	// ChangeEmail makes the new email the verified email of the user, and drops the pending one
+	ChangeEmail(ctx context.Context, id uint, email string) error
+	// ListIdentities lists the accounts of external providers linked to the user
+	ListIdentities(ctx context.Context, id uint) ([]*model.ExternalIdentity, error)
+	// DeleteUser deletes the user, with its recovery codes, external identities and API keys,
+	// and returns the rows deleted from each table
+	DeleteUser(ctx context.Context, id uint) (map[string]int64, error)
+	// CountUserRows counts the rows of the user in each table that DeleteUser deletes from
+	CountUserRows(ctx context.Context, id uint) (map[string]int64, error)
 }
 
 // PermissionManager manage user permissions by tokens
 type PermissionManager interface {
-	GenerateToken(userID uint, email string, perm model.UserPermission) (string, error)
+	GenerateToken(userID uint, email string, perm model.UserPermission, version uint) (string, error)
 	HasPermission(tokenResult string, perm model.UserPermission) (bool, error)
+	ParseToken(tokenResult string) (*model.UserIdentity, error)
+}
+
+// ActionTokenManager issues and checks the single-use tokens of account actions, like email verification.
+// A token is bound to a state of the account, so that it stops working once the action changes the state.
+type ActionTokenManager interface {
+	SignAction(purpose string, userID uint, state string, ttl time.Duration) (string, error)
+	// ActionSubject returns the user a well-formed and unexpired token was issued for
+	ActionSubject(purpose, token string) (uint, error)
+	VerifyAction(purpose, token, state string) error
 }
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// APIScope is what an API key may do
+type APIScope string
+
+// API key scopes
+const (
+	ScopeBooksRead    APIScope = "books:read"
+	ScopeBooksWrite   APIScope = "books:write"
+	ScopeReviewsRead  APIScope = "reviews:read"
+	ScopeReviewsWrite APIScope = "reviews:write"
+)
+
+// APIScopes lists every scope keys may be given
+var APIScopes = []APIScope{ScopeBooksRead, ScopeBooksWrite, ScopeReviewsRead, ScopeReviewsWrite}
+
+// APIKey is a personal key of a user for scripts and integrations.
+// Only the hash of the key is kept; its prefix finds it.
+type APIKey struct {
+	ID      uint   `json:"id,omitempty"`
+	UserID  uint   `json:"user_id"`
+	Name    string `json:"name"`
+	Prefix  string `json:"prefix"`
+	KeyHash string `json:"-"`
+	// Scopes are space-separated
+	Scopes     string         `json:"-"`
+	Permission UserPermission `json:"permission"`
+	ExpiresAt  time.Time      `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time     `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// ScopeList returns the scopes of the key
+func (k *APIKey) ScopeList() []APIScope {
+	fields := strings.Fields(k.Scopes)
+	scopes := make([]APIScope, len(fields))
+	for i, f := range fields {
+		scopes[i] = APIScope(f)
+	}
+	return scopes
+}
+
+// Active tells if the key works at the time
+func (k *APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && t.Before(k.ExpiresAt)
+}
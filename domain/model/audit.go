@@ -0,0 +1,121 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditBookCreate       = "book.create"
+	AuditBookUpdate       = "book.update"
+	AuditBookDelete       = "book.delete"
+	AuditBookRevert       = "book.revert"
+	AuditReviewUpdate     = "review.update"
+	AuditReviewDelete     = "review.delete"
+	AuditSignIn           = "user.sign_in"
+	AuditSignInChallenged = "user.sign_in_challenged"
+	AuditSignInFailed     = "user.sign_in_failed"
+	AuditSignInLocked     = "user.sign_in_locked"
+	AuditLockout          = "user.lockout"
+	AuditUnlock           = "user.unlock"
+	AuditRoleChange       = "user.role_change"
+	AuditMFAReset         = "user.mfa_reset"
+	AuditAPIKeysRevoke    = "user.api_keys_revoke"
+	AuditAccountDelete    = "user.account_delete"
+	AuditErase            = "user.erase"
+)
+
+// Types of audit targets
+const (
+	AuditTargetBook   = "book"
+	AuditTargetReview = "review"
+	AuditTargetUser   = "user"
+	// AuditTargetAccount is an account by the hash of its email, which may not be registered
+	AuditTargetAccount = "account"
+	AuditTargetIP      = "ip"
+)
+
+// AuditEntry records a privileged or destructive operation.
+// Entries are only ever appended, each chained to the one before by its hash.
+// Erasing a user erases the personal fields of their entries, Before, After and IP, and keeps their digest instead.
+type AuditEntry struct {
+	ID uint `json:"id"`
+	// ActorID is the user who did it, 0 for anonymous callers
+	ActorID    uint   `json:"actor_id,omitempty"`
+	APIKeyID   uint   `json:"api_key_id,omitempty"`
+	Action     string `json:"action"`
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   string `json:"target_id,omitempty"`
+	// Before and After are JSON objects of the fields the operation changed
+	Before    string    `json:"before,omitempty" gorm:"column:before_data"`
+	After     string    `json:"after,omitempty" gorm:"column:after_data"`
+	IP        string    `json:"ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+	// Salt goes into the digest of the personal fields, so that the digest tells nothing of them once they are erased
+	Salt string `json:"-"`
+	// ErasedDigest is the digest of the personal fields once they are erased
+	ErasedDigest string `json:"-"`
+}
+
+// Erased tells if the personal fields of the entry are erased
+func (e *AuditEntry) Erased() bool {
+	return e.ErasedDigest != ""
+}
+
+// PersonalDigest hashes the personal fields of the entry with its salt, or returns the digest kept of them
+func (e *AuditEntry) PersonalDigest() string {
+	if e.Erased() {
+		return e.ErasedDigest
+	}
+	return hashFields(e.Salt, e.Before, e.After, e.IP)
+}
+
+// Erase drops the personal fields of the entry, keeping their digest, so that the entry still matches its hash
+func (e *AuditEntry) Erase() {
+	if e.Erased() {
+		return
+	}
+	e.ErasedDigest = e.PersonalDigest()
+	e.Salt, e.Before, e.After, e.IP = "", "", "", ""
+}
+
+// ComputeHash hashes the entry together with the hash of the entry before it,
+// so that changing or dropping an entry breaks the chain after it
+func (e *AuditEntry) ComputeHash() string {
+	return hashFields(
+		e.PrevHash,
+		strconv.FormatUint(uint64(e.ActorID), 10),
+		strconv.FormatUint(uint64(e.APIKeyID), 10),
+		e.Action, e.TargetType, e.TargetID, e.PersonalDigest(), e.RequestID,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	)
+}
+
+// hashFields hashes the fields, each prefixed by its length so that no two lists of fields hash alike
+func hashFields(fields ...string) string {
+	h := sha256.New()
+	for _, field := range fields {
+		fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditFilter narrows an audit log query; zero fields match everything
+type AuditFilter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	// BeforeID pages back from the entry, exclusive
+	BeforeID uint
+	Limit    int
+}
@@ -17,3 +17,22 @@ type Book struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// BookRevision is an immutable snapshot of a book, stored at every change of it
+type BookRevision struct {
+	ID     uint `json:"-"`
+	BookID uint `json:"book_id"`
+	// Rev numbers the revisions of a book from 1
+	Rev         uint   `json:"rev"`
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	PublishedAt string `json:"published_at"`
+	Description string `json:"description"`
+	ISBN        string `json:"isbn"`
+	TotalPages  int    `json:"total_pages"`
+	// EditorID is the user who made the change, 0 when unknown, like for books older than their history
+	EditorID uint `json:"editor_id,omitempty"`
+	// RevertedFrom is the earlier revision this one restores
+	RevertedFrom uint      `json:"reverted_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "errors"
+
+// Domain errors, which adaptors map to their own status codes
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrTooManyRequests  = errors.New("too many requests")
+)
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"log/slog"
+	"time"
+)
 
 // UserPermission represents different levels of user permissions.
 type UserPermission uint8
@@ -15,11 +18,93 @@ const (
 
 // User represents an app user
 type User struct {
+	ID    uint   `json:"id,omitempty"`
+	Email string `json:"email,omitempty"`
+	// Password and Salt never leave the app, whatever encodes the user
+	Password string `json:"-"`
+	Salt     string `json:"-"`
+	IsAdmin  bool   `json:"is_admin,omitempty"`
+	// IsAuthor is kept in step with the roles of the single sign-on provider
+	IsAuthor      bool   `json:"is_author,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Locale        string `json:"locale,omitempty"`
+	TOTPSecret    string `json:"-"`
+	TOTPStep      int64  `json:"-"`
+	MFAEnabled    bool   `json:"mfa_enabled,omitempty"`
+	// MFACounter counts the second factors used, so that every sign-in challenge is answered once
+	MFACounter  uint   `json:"-"`
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	// PendingEmail is the new email of a change, until a link mailed to it confirms it
+	PendingEmail string `json:"pending_email,omitempty"`
+	// TokenVersion is carried by the user's tokens; raising it revokes all tokens issued before
+	TokenVersion uint      `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// LogValue keeps the password hash and salt out of the logs
+func (u User) LogValue() slog.Value {
+	return slog.GroupValue(slog.Any("id", u.ID), slog.String("email", u.Email), slog.Bool("is_admin", u.IsAdmin))
+}
+
+// RecoveryCode is a one-time code that stands in for the authenticator of a user.
+// Only its hash is kept.
+type RecoveryCode struct {
+	ID        uint       `json:"id,omitempty"`
+	UserID    uint       `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ExternalIdentity links an account of an OpenID Connect provider to a user
+type ExternalIdentity struct {
 	ID        uint      `json:"id,omitempty"`
+	UserID    uint      `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
 	Email     string    `json:"email,omitempty"`
-	Password  string    `json:"password,omitempty"`
-	Salt      string    `json:"salt,omitempty"`
-	IsAdmin   bool      `json:"is_admin,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// ExternalClaims are the verified claims of an ID token
+type ExternalClaims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Locale        string
+	// Roles are the values of the configured role claim
+	Roles []string
+}
+
+// UserIdentity is the authenticated user carried by a token
+type UserIdentity struct {
+	UserID     uint           `json:"user_id"`
+	Email      string         `json:"email"`
+	Permission UserPermission `json:"permission"`
+	// APIKeyID and Scopes are set for callers with an API key, which may do only what its scopes allow
+	APIKeyID uint       `json:"api_key_id,omitempty"`
+	Scopes   []APIScope `json:"scopes,omitempty"`
+	// TokenVersion is the version of the user's tokens the token was issued at
+	TokenVersion uint `json:"-"`
+}
+
+// Allows tells if the caller may do what any of the scopes allow.
+// Tokens allow everything their permission does, and API keys only their scopes.
+func (u *UserIdentity) Allows(scopes ...APIScope) bool {
+	if u.APIKeyID == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		for _, have := range u.Scopes {
+			if s == have {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/config"
+)
+
+// memHelper is a Helper over a map, keeping the TTL of every key
+type memHelper struct {
+	values map[string]string
+	ttls   map[string]time.Duration
+}
+
+func newMemHelper() *memHelper {
+	return &memHelper{values: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (m *memHelper) Save(ctx context.Context, key, value string, ttl time.Duration) error {
+	m.values[key], m.ttls[key] = value, ttl
+	return nil
+}
+
+func (m *memHelper) Load(ctx context.Context, key string) (string, error) {
+	return m.values[key], nil
+}
+
+func (m *memHelper) Delete(ctx context.Context, keys ...string) error {
+	for _, k := range keys {
+		delete(m.values, k)
+	}
+	return nil
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	long := strings.Repeat("a long description ", 40)
+	tests := []struct {
+		name           string
+		value          interface{}
+		into           interface{}
+		wantCompressed bool
+	}{
+		{"book", &model.Book{ID: 1, Title: "Dune", TotalPages: 412}, &model.Book{}, false},
+		{"large book", &model.Book{ID: 2, Title: "Dune", Description: long}, &model.Book{}, true},
+		{"page of books", []*model.Book{{ID: 1, Title: "Dune"}, {ID: 2, Title: "Emma"}}, &[]*model.Book{}, true},
+		{"empty page", []*model.Book{}, &[]*model.Book{}, false},
+		{"map", map[string]int{"a": 1}, &map[string]int{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := encode(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if raw[0] != formatVersion || (raw[1]&flagCompressed != 0) != tt.wantCompressed {
+				t.Errorf("header = %v, want version %d, compressed %v", raw[:2], formatVersion, tt.wantCompressed)
+			}
+			if err := decode(raw, tt.into); err != nil {
+				t.Fatal(err)
+			}
+			got := reflect.ValueOf(tt.into).Elem().Interface()
+			want := tt.value
+			if reflect.TypeOf(want).Kind() == reflect.Pointer {
+				want = reflect.ValueOf(want).Elem().Interface()
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeStale(t *testing.T) {
+	book, err := encode(&model.Book{ID: 1, Title: "Dune"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVersion := append([]byte{}, book...)
+	otherVersion[0] = formatVersion + 1
+	tests := []struct {
+		name string
+		raw  []byte
+		into interface{}
+	}{
+		{"empty", nil, &model.Book{}},
+		{"short", book[:headerLen-1], &model.Book{}},
+		{"other format version", otherVersion, &model.Book{}},
+		{"other type", book, &model.Review{}},
+		{"a page into a book", mustEncode(t, []*model.Book{}), &model.Book{}},
+	}
+	for _, tt := range tests {
+		if err := decode(tt.raw, tt.into); err != errStale {
+			t.Errorf("%s: decode error = %v, want %v", tt.name, err, errStale)
+		}
+	}
+}
+
+func mustEncode(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	raw, err := encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestFingerprint(t *testing.T) {
+	type book struct {
+		Title string `json:"title"`
+	}
+	type renamed struct {
+		Title string `json:"name"`
+	}
+	type retyped struct {
+		Title []byte `json:"title"`
+	}
+	type nested struct {
+		Books []*book `json:"books"`
+	}
+	type nestedRenamed struct {
+		Books []*renamed `json:"books"`
+	}
+	base := fingerprint(reflect.TypeOf(book{}))
+	tests := []struct {
+		name string
+		a, b reflect.Type
+		same bool
+	}{
+		{"same type twice", reflect.TypeOf(book{}), reflect.TypeOf(book{}), true},
+		{"pointer and value", reflect.TypeOf(&book{}), reflect.TypeOf(book{}), true},
+		{"renamed JSON field", reflect.TypeOf(book{}), reflect.TypeOf(renamed{}), false},
+		{"retyped field", reflect.TypeOf(book{}), reflect.TypeOf(retyped{}), false},
+		{"nested change", reflect.TypeOf(nested{}), reflect.TypeOf(nestedRenamed{}), false},
+		{"slice and element", reflect.TypeOf([]book{}), reflect.TypeOf(book{}), false},
+	}
+	for _, tt := range tests {
+		if got := fingerprint(tt.a) == fingerprint(tt.b); got != tt.same {
+			t.Errorf("%s: same fingerprint = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+	fingerprints.Delete(reflect.TypeOf(book{}))
+	if fingerprint(reflect.TypeOf(book{})) != base {
+		t.Error("the fingerprint changed once computed again")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	h := newMemHelper()
+	c := NewCache(h, &config.CacheConfig{})
+	ctx := context.Background()
+	tests := []struct {
+		family Family
+		key    string
+		want   string
+	}{
+		{FamilyBooks, "7", "lr:books:7"},
+		{FamilyReviews, "7", "lr:reviews:7"},
+		{FamilyBookPages, "0", "lr:book_pages:g0:0"},
+		{FamilySearches, "0:dune", "lr:searches:g0:0:dune"},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 2; i++ {
+			if got, err := c.key(ctx, tt.family, tt.key); err != nil || got != tt.want {
+				t.Errorf("key(%s, %s) = %q, %v, want %q", tt.family, tt.key, got, err, tt.want)
+			}
+		}
+	}
+	if err := c.Invalidate(ctx, FamilyBookPages); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.key(ctx, FamilyBookPages, "0")
+	if err != nil || got == "lr:book_pages:g0:0" || !strings.HasPrefix(got, "lr:book_pages:g") {
+		t.Errorf("key after Invalidate = %q, %v, want one of a new generation", got, err)
+	}
+	if again, _ := c.key(ctx, FamilyBookPages, "0"); again != got {
+		t.Errorf("key moved to %q without an Invalidate, want %q", again, got)
+	}
+	if err := c.Invalidate(ctx, FamilyBooks); err == nil {
+		t.Error("Invalidate took a family without generations")
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	ctx := context.Background()
+	on := config.CachePolicy{Enabled: true}
+	c := NewCache(newMemHelper(), &config.CacheConfig{Policies: config.CachePolicies{
+		BookPages: on, Books: on, Searches: on}})
+	page := []*model.Book{{ID: 1, Title: "Dune"}}
+	for _, f := range []Family{FamilyBookPages, FamilySearches, FamilyBooks} {
+		if err := c.Save(ctx, f, "0", page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []Family{FamilyBookPages, FamilySearches} {
+		if err := c.Invalidate(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		family Family
+		want   bool
+	}{
+		{FamilyBookPages, false},
+		{FamilySearches, false},
+		{FamilyBooks, true},
+	}
+	for _, tt := range tests {
+		var got []*model.Book
+		found, err := c.Load(ctx, tt.family, "0", &got)
+		if err != nil || found != tt.want {
+			t.Errorf("Load of %s after Invalidate = %v, %v, want %v", tt.family, found, err, tt.want)
+		}
+	}
+	if err := c.Save(ctx, FamilyBookPages, "0", page); err != nil {
+		t.Fatal(err)
+	}
+	var got []*model.Book
+	if found, err := c.Load(ctx, FamilyBookPages, "0", &got); err != nil || !found || len(got) != 1 {
+		t.Errorf("Load of the new generation = %v, %v, %+v", found, err, got)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+	h := newMemHelper()
+	c := NewCache(h, &config.CacheConfig{TTL: 600, Policies: config.CachePolicies{
+		Books:     config.CachePolicy{Enabled: true},
+		Reviews:   config.CachePolicy{Enabled: true, TTL: 60, Jitter: 5},
+		BookPages: config.CachePolicy{Enabled: true, MaxSize: 10},
+	}})
+	tests := []struct {
+		name    string
+		family  Family
+		wantKey string
+		minTTL  time.Duration
+		maxTTL  time.Duration
+	}{
+		{"TTL of the cache", FamilyBooks, "lr:books:1", 600 * time.Second, 600 * time.Second},
+		{"TTL of the family, with jitter", FamilyReviews, "lr:reviews:1", 60 * time.Second, 65 * time.Second},
+		{"too large", FamilyBookPages, "", 0, 0},
+		{"disabled", FamilySearches, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.Save(ctx, tt.family, "1", &model.Book{ID: 1, Title: "Dune"}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantKey == "" {
+				for k := range h.values {
+					if strings.Contains(k, string(tt.family)) {
+						t.Errorf("stored %s", k)
+					}
+				}
+				return
+			}
+			ttl, ok := h.ttls[tt.wantKey]
+			if !ok || ttl < tt.minTTL || ttl > tt.maxTTL {
+				t.Errorf("TTL of %s = %v (stored %v), want %v to %v", tt.wantKey, ttl, ok, tt.minTTL, tt.maxTTL)
+			}
+		})
+	}
+	if got := ttl(&config.CachePolicy{}); got != defaultTTL {
+		t.Errorf("TTL without any = %v, want %v", got, defaultTTL)
+	}
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// formatVersion is the version of the encoding below; bump it whenever the encoding changes.
+//
+// An encoded value is laid out as:
+//
+//	byte 0     format version
+//	byte 1     flags
+//	bytes 2-5  fingerprint of the Go type of the value
+//	bytes 6-   JSON of the value, gzipped if flagCompressed is set
+const (
+	formatVersion  byte = 1
+	flagCompressed byte = 1 << 0
+	headerLen           = 6
+	// compressMin is the least JSON size worth compressing
+	compressMin = 256
+)
+
+// errStale is returned for values stored in another format or for another shape of the type
+var errStale = errors.New("stale cache value")
+
+var fingerprints sync.Map
+
+// encode turns the value into its cached form
+func encode(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerLen)
+	header[0] = formatVersion
+	binary.BigEndian.PutUint32(header[2:], fingerprint(reflect.TypeOf(v)))
+	if len(data) < compressMin {
+		return append(header, data...), nil
+	}
+	header[1] |= flagCompressed
+	buf := bytes.NewBuffer(header)
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decode reads the cached form into v, a pointer.
+// It returns errStale if the value was written in another format or for another shape of the type.
+func decode(raw []byte, v interface{}) error {
+	if len(raw) < headerLen || raw[0] != formatVersion {
+		return errStale
+	}
+	if binary.BigEndian.Uint32(raw[2:]) != fingerprint(reflect.TypeOf(v).Elem()) {
+		return errStale
+	}
+	data := raw[headerLen:]
+	if raw[1]&flagCompressed != 0 {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decompress cache value: %w", err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("failed to decompress cache value: %w", err)
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// fingerprint hashes the shape of the type, that is the names, JSON tags and types of its fields,
+// so that values cached before the type changed are not read into it
+func fingerprint(t reflect.Type) uint32 {
+	// T and *T have the same JSON
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if fp, ok := fingerprints.Load(t); ok {
+		return fp.(uint32)
+	}
+	h := fnv.New32a()
+	writeShape(h, t, make(map[reflect.Type]bool))
+	fp := h.Sum32()
+	fingerprints.Store(t, fp)
+	return fp
+}
+
+func writeShape(w io.Writer, t reflect.Type, seen map[reflect.Type]bool) {
+	fmt.Fprint(w, t.Kind().String(), "(")
+	defer fmt.Fprint(w, ")")
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		writeShape(w, t.Elem(), seen)
+	case reflect.Map:
+		writeShape(w, t.Key(), seen)
+		writeShape(w, t.Elem(), seen)
+	case reflect.Struct:
+		fmt.Fprint(w, t.PkgPath(), ".", t.Name())
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(w, "%s %q ", f.Name, f.Tag.Get("json"))
+			writeShape(w, f.Type, seen)
+		}
+	}
+}
@@ -1,9 +1,21 @@
 package cache
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Helper reads and writes from cache.
 type Helper interface {
-	Save(ctx context.Context, key, value string) error
+	Save(ctx context.Context, key, value string, ttl time.Duration) error
 	Load(ctx context.Context, key string) (string, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Counter is a Helper that also counts events by key
+type Counter interface {
+	Helper
+	// Incr adds one to the count of the key and returns the count.
+	// The key expires ttl after its first count.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
 }
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"literank.com/rest-books/infrastructure/config"
+	"literank.com/rest-books/infrastructure/tracing"
+)
+
+const (
+	keyPrefix  = "lr"
+	defaultTTL = time.Hour * 1
+)
+
+// Family is a kind of cached values, all under the same policy
+type Family string
+
+// Key families
+const (
+	FamilyBookPages Family = "book_pages"
+	FamilyBooks     Family = "books"
+	FamilySearches  Family = "searches"
+	FamilyReviews   Family = "reviews"
+)
+
+// generational lists the families of lists, whose values change with every write of what they list.
+// Their keys carry the family's generation, so that Invalidate drops all of them at once.
+var generational = map[Family]bool{FamilyBookPages: true, FamilySearches: true}
+
+// Cache stores values of each key family under the family's policy.
+// Values are stored compressed with a format version, and read back only into the type they came from.
+type Cache struct {
+	helper   Helper
+	policies atomic.Pointer[map[Family]config.CachePolicy]
+}
+
+// NewCache constructs a new Cache over the helper
+func NewCache(h Helper, c *config.CacheConfig) *Cache {
+	cache := &Cache{helper: h}
+	cache.SetPolicies(c)
+	return cache
+}
+
+// SetPolicies swaps the policies, safe while serving
+func (c *Cache) SetPolicies(cc *config.CacheConfig) {
+	policies := map[Family]config.CachePolicy{
+		FamilyBookPages: cc.Policies.BookPages,
+		FamilyBooks:     cc.Policies.Books,
+		FamilySearches:  cc.Policies.Searches,
+		FamilyReviews:   cc.Policies.Reviews,
+	}
+	for f, p := range policies {
+		if p.TTL == 0 {
+			p.TTL = cc.TTL
+			policies[f] = p
+		}
+	}
+	c.policies.Store(&policies)
+}
+
+// Enabled tells if the family is cached
+func (c *Cache) Enabled(f Family) bool {
+	return c.policy(f).Enabled
+}
+
+// Load reads the value of the key into v, a pointer, and tells if it was found.
+// Values written for another shape of v's type are taken as not found.
+func (c *Cache) Load(ctx context.Context, f Family, key string, v interface{}) (bool, error) {
+	if !c.Enabled(f) {
+		return false, nil
+	}
+	full, err := c.key(ctx, f, key)
+	if err != nil {
+		return false, err
+	}
+	raw, err := c.helper.Load(ctx, full)
+	if err != nil || raw == "" {
+		return false, err
+	}
+	_, span := tracing.Tracer().Start(ctx, "cache.decode")
+	err = decode([]byte(raw), v)
+	span.End()
+	if errors.Is(err, errStale) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Save stores the value of the key, unless the family is disabled or the value is too large
+func (c *Cache) Save(ctx context.Context, f Family, key string, v interface{}) error {
+	p := c.policy(f)
+	if !p.Enabled {
+		return nil
+	}
+	_, span := tracing.Tracer().Start(ctx, "cache.encode")
+	data, err := encode(v)
+	span.End()
+	if err != nil {
+		return err
+	}
+	if p.MaxSize > 0 && len(data) > p.MaxSize {
+		return nil
+	}
+	full, err := c.key(ctx, f, key)
+	if err != nil {
+		return err
+	}
+	return c.helper.Save(ctx, full, string(data), ttl(&p))
+}
+
+// Delete removes the keys of the family
+func (c *Cache) Delete(ctx context.Context, f Family, keys ...string) error {
+	if !c.Enabled(f) || len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, 0, len(keys))
+	for _, k := range keys {
+		fk, err := c.key(ctx, f, k)
+		if err != nil {
+			return err
+		}
+		full = append(full, fk)
+	}
+	return c.helper.Delete(ctx, full...)
+}
+
+// Invalidate drops every value of a generational family by starting a new generation of its keys.
+// Values of older generations are never read again, and expire under their TTL.
+// It works while the family is disabled too, so that values from before are not served once it is enabled again.
+func (c *Cache) Invalidate(ctx context.Context, f Family) error {
+	if !generational[f] {
+		return fmt.Errorf("cache family %s has no generations", f)
+	}
+	// A random generation cannot come back, unlike a counter whose key is lost
+	return c.helper.Save(ctx, generationKey(f), strconv.FormatInt(rand.Int63(), 36), 0)
+}
+
+// key returns the full key of the family's key, in the current generation of generational families
+func (c *Cache) key(ctx context.Context, f Family, key string) (string, error) {
+	if !generational[f] {
+		return fullKey(f, key), nil
+	}
+	gen, err := c.helper.Load(ctx, generationKey(f))
+	if err != nil {
+		return "", err
+	}
+	if gen == "" {
+		gen = "0"
+	}
+	return fullKey(f, "g"+gen+":"+key), nil
+}
+
+func (c *Cache) policy(f Family) config.CachePolicy {
+	return (*c.policies.Load())[f]
+}
+
+func fullKey(f Family, key string) string {
+	return fmt.Sprintf("%s:%s:%s", keyPrefix, f, key)
+}
+
+func generationKey(f Family) string {
+	return fmt.Sprintf("%s:%s:generation", keyPrefix, f)
+}
+
+func ttl(p *config.CachePolicy) time.Duration {
+	d := defaultTTL
+	if p.TTL > 0 {
+		d = time.Second * time.Duration(p.TTL)
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(time.Second) * int64(p.Jitter)))
+	}
+	return d
+}
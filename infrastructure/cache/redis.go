@@ -12,10 +12,7 @@ import (
 	"literank.com/rest-books/infrastructure/config"
 )
 
-const (
-	defaultTimeout = time.Second * 10
-	defaultTTL     = time.Hour * 1
-)
+const defaultTimeout = time.Second * 10
 
 // RedisCache implements cache with redis
 type RedisCache struct {
@@ -23,7 +20,7 @@ type RedisCache struct {
 }
 
 // NewRedisCache constructs a new RedisCache
-func NewRedisCache(c *config.CacheConfig) *RedisCache {
+func NewRedisCache(c *config.CacheConfig, hooks ...redis.Hook) *RedisCache {
 	timeout := defaultTimeout
 	if c.Timeout > 0 {
 		timeout = time.Second * time.Duration(c.Timeout)
@@ -35,14 +32,27 @@ func NewRedisCache(c *config.CacheConfig) *RedisCache {
 		ReadTimeout:  timeout,
 		WriteTimeout: timeout,
 	})
+	for _, h := range hooks {
+		r.AddHook(h)
+	}
 	return &RedisCache{
 		c: r,
 	}
 }
 
+// Ping checks the connection to the cache
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.c.Ping(ctx).Err()
+}
+
+// Close closes the client and its connections
+func (r *RedisCache) Close() error {
+	return r.c.Close()
+}
+
 // Save sets key and value into the cache
-func (r *RedisCache) Save(ctx context.Context, key, value string) error {
-	if _, err := r.c.Set(ctx, key, value, defaultTTL).Result(); err != nil {
+func (r *RedisCache) Save(ctx context.Context, key, value string, ttl time.Duration) error {
+	if _, err := r.c.Set(ctx, key, value, ttl).Result(); err != nil {
 		return err
 	}
 	return nil
@@ -59,3 +69,27 @@ func (r *RedisCache) Load(ctx context.Context, key string) (string, error) {
 	}
 	return value, nil
 }
+
+// Delete removes the keys from the cache
+func (r *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	return r.c.Del(ctx, keys...).Err()
+}
+
+// Client returns the Redis client, for the features that share the cache's Redis
+func (r *RedisCache) Client() redis.UniversalClient {
+	return r.c
+}
+
+// Incr adds one to the count of the key, and starts its expiry on the first count
+func (r *RedisCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	n, err := r.c.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := r.c.Expire(ctx, key, ttl).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
@@ -3,54 +3,237 @@ Package config provides config structures and parse funcs.
 */
 package config
 
-import (
-	"fmt"
-	"os"
-
-	"gopkg.in/yaml.v3"
-)
-
 // Config is the global configuration.
 type Config struct {
-	App   ApplicationConfig `json:"app" yaml:"app"`
-	Cache CacheConfig       `json:"cache" yaml:"cache"`
-	DB    DBConfig          `json:"db" yaml:"db"`
+	App       ApplicationConfig `json:"app" yaml:"app"`
+	Cache     CacheConfig       `json:"cache" yaml:"cache"`
+	DB        DBConfig          `json:"db" yaml:"db"`
+	Log       LogConfig         `json:"log" yaml:"log"`
+	Trace     TraceConfig       `json:"trace" yaml:"trace"`
+	RateLimit RateLimitConfig   `json:"rate_limit" yaml:"rate_limit"`
+	Lockout   LockoutConfig     `json:"lockout" yaml:"lockout"`
+	Mail      MailConfig        `json:"mail" yaml:"mail"`
+	MFA       MFAConfig         `json:"mfa" yaml:"mfa"`
+	OIDC      OIDCConfig        `json:"oidc" yaml:"oidc"`
+	APIKeys   APIKeysConfig     `json:"api_keys" yaml:"api_keys"`
 }
 
 // DBConfig is the configuration of databases.
 type DBConfig struct {
 	FileName    string `json:"file_name" yaml:"file_name"`
-	DSN         string `json:"dsn" yaml:"dsn"`
-	MongoURI    string `json:"mongo_uri" yaml:"mongo_uri"`
+	DSN         string `json:"dsn" yaml:"dsn" secret:"true"`
+	MongoURI    string `json:"mongo_uri" yaml:"mongo_uri" secret:"true"`
 	MongoDBName string `json:"mongo_db_name" yaml:"mongo_db_name"`
+	// AutoMigrate applies the pending schema migrations at startup.
+	AutoMigrate bool `json:"auto_migrate" yaml:"auto_migrate"`
+	// MaxOpenConns limits the open MySQL connections, unlimited if not set.
+	MaxOpenConns int `json:"max_open_conns" yaml:"max_open_conns"`
+	// MaxIdleConns is the number of idle MySQL connections to keep.
+	MaxIdleConns int `json:"max_idle_conns" yaml:"max_idle_conns"`
+	// ConnMaxLifetime is the seconds a MySQL connection may be reused, forever if not set.
+	ConnMaxLifetime int `json:"conn_max_lifetime" yaml:"conn_max_lifetime"`
+	// MongoMaxPoolSize limits the connections of the mongo client, the driver default if not set.
+	MongoMaxPoolSize uint64 `json:"mongo_max_pool_size" yaml:"mongo_max_pool_size"`
+	// MongoMinPoolSize is the number of mongo connections to keep.
+	MongoMinPoolSize uint64 `json:"mongo_min_pool_size" yaml:"mongo_min_pool_size"`
 }
 
 // ApplicationConfig is the configuration of main app.
 type ApplicationConfig struct {
 	Port        int    `json:"port" yaml:"port"`
+	GRPCPort    int    `json:"grpc_port" yaml:"grpc_port"`
 	PageSize    int    `json:"page_size" yaml:"page_size"`
-	TokenSecret string `json:"token_secret" yaml:"token_secret"`
+	TokenSecret string `json:"token_secret" yaml:"token_secret" secret:"true"`
 	TokenHours  int    `json:"token_hours" yaml:"token_hours"`
+	// OpenAPIValidation checks requests against the OpenAPI document,
+	// and responses too when gin runs in debug mode.
+	OpenAPIValidation bool `json:"openapi_validation" yaml:"openapi_validation"`
+	// OpenAPIFile is the document to validate against, the built-in one if empty.
+	OpenAPIFile string `json:"openapi_file" yaml:"openapi_file"`
+	// MaxBodyBytes is the largest request body that validation reads; larger ones are refused.
+	MaxBodyBytes int64 `json:"max_body_bytes" yaml:"max_body_bytes"`
+	// ReadTimeout, WriteTimeout and IdleTimeout are the seconds of the HTTP server timeouts.
+	ReadTimeout  int `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout int `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout  int `json:"idle_timeout" yaml:"idle_timeout"`
+	// ShutdownTimeout is the seconds to wait for in-flight requests on shutdown.
+	ShutdownTimeout int `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	// DrainDelay is the seconds the app keeps serving on shutdown while readiness checks fail,
+	// so that load balancers stop sending traffic before the listeners close.
+	DrainDelay int `json:"drain_delay" yaml:"drain_delay"`
+	// TrustedProxies are the comma-separated IPs and CIDRs of the proxies whose X-Forwarded-For header tells
+	// the client's IP. Other callers are known by the address of their connection; none are trusted if empty.
+	TrustedProxies string `json:"trusted_proxies" yaml:"trusted_proxies"`
 }
 
 // CacheConfig is the configuration of cache.
 type CacheConfig struct {
 	Address  string `json:"address" yaml:"address"`
-	Password string `json:"password" yaml:"password"`
+	Password string `json:"password" yaml:"password" secret:"true"`
 	DB       int    `json:"db" yaml:"db"`
 	Timeout  int    `json:"timeout" yaml:"timeout"`
+	// TTL is the seconds values live in the cache, for policies without a TTL of their own.
+	TTL int `json:"ttl" yaml:"ttl"`
+	// Policies tell how each family of values is cached.
+	Policies CachePolicies `json:"policies" yaml:"policies"`
+}
+
+// CachePolicies are the cache policies of all key families.
+type CachePolicies struct {
+	BookPages CachePolicy `json:"book_pages" yaml:"book_pages"`
+	Books     CachePolicy `json:"books" yaml:"books"`
+	Searches  CachePolicy `json:"searches" yaml:"searches"`
+	Reviews   CachePolicy `json:"reviews" yaml:"reviews"`
+}
+
+// CachePolicy is the cache policy of a key family.
+type CachePolicy struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// TTL is the seconds values live in the cache, cache.ttl if not set.
+	TTL int `json:"ttl" yaml:"ttl"`
+	// Jitter is the most seconds randomly added to the TTL, so that values do not all expire at once.
+	Jitter int `json:"jitter" yaml:"jitter"`
+	// MaxSize is the most bytes of a stored value; larger values are not cached. Unlimited if not set.
+	MaxSize int `json:"max_size" yaml:"max_size"`
+}
+
+// LogConfig is the configuration of logging.
+type LogConfig struct {
+	// Level is one of debug, info, warn and error.
+	Level string `json:"level" yaml:"level"`
+	// Format is either json or text.
+	Format string `json:"format" yaml:"format"`
+}
+
+// TraceConfig is the configuration of tracing.
+type TraceConfig struct {
+	// Exporter is one of otlp, stdout and none. Tracing is disabled if empty.
+	Exporter string `json:"exporter" yaml:"exporter"`
+	// Endpoint is the host:port of the OTLP gRPC collector.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Insecure sends spans to the collector without TLS.
+	Insecure bool `json:"insecure" yaml:"insecure"`
+	// SampleRatio is the share of new traces to sample, 1 if not set.
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// RateLimitConfig is the configuration of rate limiting.
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Policies are the limits of each route group.
+	Policies RateLimitPolicies `json:"policies" yaml:"policies"`
+}
+
+// RateLimitPolicies are the rate limit policies of all route groups.
+type RateLimitPolicies struct {
+	// Auth covers signing up and signing in.
+	Auth RateLimitPolicy `json:"auth" yaml:"auth"`
+	// Reviews covers creating, updating and deleting reviews.
+	Reviews RateLimitPolicy `json:"reviews" yaml:"reviews"`
+	// GraphQL covers the GraphQL endpoint.
+	GraphQL RateLimitPolicy `json:"graphql" yaml:"graphql"`
+}
+
+// RateLimitPolicy is the token bucket of a route group.
+type RateLimitPolicy struct {
+	// Rate is the requests allowed per period. The group is not limited if not set.
+	Rate int `json:"rate" yaml:"rate"`
+	// Period is the seconds over which rate requests are allowed, 60 if not set.
+	Period int `json:"period" yaml:"period"`
+	// Burst is the most requests allowed at once, rate if not set.
+	Burst int `json:"burst" yaml:"burst"`
+	// Key is what requests are counted by: ip, user or api_key.
+	// Requests without a user or an API key are counted by IP.
+	Key string `json:"key" yaml:"key"`
+}
+
+// LockoutConfig is the configuration of sign-in lockouts.
+type LockoutConfig struct {
+	// MaxFailures is the failed sign-ins to an account within the window that lock it.
+	// Accounts are never locked if not set.
+	MaxFailures int `json:"max_failures" yaml:"max_failures"`
+	// MaxIPFailures is the failed sign-ins from an IP within the window that lock the IP out.
+	// IPs are never locked if not set.
+	MaxIPFailures int `json:"max_ip_failures" yaml:"max_ip_failures"`
+	// Window is the seconds over which failed sign-ins are counted.
+	Window int `json:"window" yaml:"window"`
+	// Duration is the seconds a lockout lasts.
+	Duration int `json:"duration" yaml:"duration"`
+	// Delay is the milliseconds a failed sign-in is answered late, doubled with every failure in the window.
+	Delay int `json:"delay" yaml:"delay"`
+	// MaxDelay caps the delay, in milliseconds.
+	MaxDelay int `json:"max_delay" yaml:"max_delay"`
+}
+
+// MailConfig is the configuration of outgoing mails.
+type MailConfig struct {
+	// Driver is one of smtp, file and log. File and log keep mails in an outbox instead of sending them.
+	Driver string `json:"driver" yaml:"driver"`
+	From   string `json:"from" yaml:"from"`
+	// BaseURL starts the links in mails, like https://books.example.com.
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// Locale is the language of mails to users without one of their own.
+	Locale string `json:"locale" yaml:"locale"`
+	// VerifyHours is how long email verification links work.
+	VerifyHours int `json:"verify_hours" yaml:"verify_hours"`
+	// ResetMinutes is how long password reset links work.
+	ResetMinutes int `json:"reset_minutes" yaml:"reset_minutes"`
+	// OutboxDir is where the file driver writes mails.
+	OutboxDir string     `json:"outbox_dir" yaml:"outbox_dir"`
+	SMTP      SMTPConfig `json:"smtp" yaml:"smtp"`
+}
+
+// SMTPConfig is the configuration of the SMTP server mails are sent through.
+type SMTPConfig struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password" secret:"true"`
+}
+
+// MFAConfig is the configuration of two-factor authentication.
+type MFAConfig struct {
+	// Issuer names the app in authenticator apps.
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// Enforce requires authors and admins to sign in with two factors.
+	// Until they enroll, their tokens carry the user permission only.
+	Enforce bool `json:"enforce" yaml:"enforce"`
+	// ChallengeSeconds is how long a sign-in waits for its second factor.
+	ChallengeSeconds int `json:"challenge_seconds" yaml:"challenge_seconds"`
+	// Skew is the 30-second steps of clock drift allowed either way.
+	Skew int `json:"skew" yaml:"skew"`
+	// RecoveryCodes is how many one-time recovery codes an enrollment gives.
+	RecoveryCodes int `json:"recovery_codes" yaml:"recovery_codes"`
+}
+
+// OIDCConfig is the configuration of single sign-on with an OpenID Connect provider.
+type OIDCConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Issuer is the URL of the provider, where its discovery document is found.
+	Issuer       string `json:"issuer" yaml:"issuer"`
+	ClientID     string `json:"client_id" yaml:"client_id"`
+	ClientSecret string `json:"client_secret" yaml:"client_secret" secret:"true"`
+	// RedirectURL is the callback URL registered with the provider, like https://books.example.com/auth/oidc/callback.
+	RedirectURL string `json:"redirect_url" yaml:"redirect_url"`
+	// Scopes are the space-separated scopes to ask for, besides openid.
+	Scopes string `json:"scopes" yaml:"scopes"`
+	// Provision creates users for unknown identities on their first sign-in.
+	Provision bool `json:"provision" yaml:"provision"`
+	// RoleClaim is the ID token claim that lists the user's roles, like groups. Roles are not mapped if empty.
+	RoleClaim string `json:"role_claim" yaml:"role_claim"`
+	// AdminRoles and AuthorRoles are the comma-separated roles that grant the admin and the author permission.
+	AdminRoles  string `json:"admin_roles" yaml:"admin_roles"`
+	AuthorRoles string `json:"author_roles" yaml:"author_roles"`
+	// StateMinutes is how long a sign-in may take at the provider.
+	StateMinutes int `json:"state_minutes" yaml:"state_minutes"`
 }
 
-// Parse parses config file and returns a Config.
-func Parse(filename string) (*Config, error) {
-	buf, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-	c := &Config{}
-	err = yaml.Unmarshal(buf, c)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse file %s: %v", filename, err)
-	}
-	return c, nil
+// APIKeysConfig is the configuration of personal API keys.
+type APIKeysConfig struct {
+	// MaxPerUser is how many active keys a user may have.
+	MaxPerUser int `json:"max_per_user" yaml:"max_per_user"`
+	// DefaultDays is how long keys work when their creator does not say.
+	DefaultDays int `json:"default_days" yaml:"default_days"`
+	// MaxDays is the longest keys may work.
+	MaxDays int `json:"max_days" yaml:"max_days"`
 }
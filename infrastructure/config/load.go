@@ -0,0 +1,306 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix starts the names of all config environment variables, like LRBOOKS_DB_DSN
+	EnvPrefix = "LRBOOKS_"
+	// fileSuffix marks a variable holding the path of a file with the value, like LRBOOKS_DB_DSN_FILE
+	fileSuffix = "_FILE"
+	redacted   = "[REDACTED]"
+)
+
+// Default returns the config used for everything not set elsewhere.
+func Default() *Config {
+	return &Config{
+		App: ApplicationConfig{
+			Port:            8080,
+			GRPCPort:        9090,
+			PageSize:        5,
+			TokenHours:      72,
+			MaxBodyBytes:    1 << 20,
+			ReadTimeout:     15,
+			WriteTimeout:    30,
+			IdleTimeout:     120,
+			ShutdownTimeout: 30,
+			DrainDelay:      5,
+		},
+		Cache: CacheConfig{Timeout: 10, TTL: 3600, Policies: CachePolicies{
+			BookPages: CachePolicy{Enabled: true, Jitter: 60},
+			Books:     CachePolicy{Enabled: true, Jitter: 60},
+		}},
+		DB:    DBConfig{MongoDBName: "lr_book", AutoMigrate: true},
+		Log:   LogConfig{Level: "info", Format: "json"},
+		Trace: TraceConfig{Exporter: "none", SampleRatio: 1},
+		RateLimit: RateLimitConfig{Enabled: true, Policies: RateLimitPolicies{
+			Auth:    RateLimitPolicy{Rate: 10, Period: 60, Key: "ip"},
+			Reviews: RateLimitPolicy{Rate: 30, Period: 3600, Burst: 5, Key: "user"},
+			GraphQL: RateLimitPolicy{Rate: 120, Period: 60, Key: "user"},
+		}},
+		Lockout: LockoutConfig{MaxFailures: 5, MaxIPFailures: 50, Window: 900, Duration: 900, Delay: 200,
+			MaxDelay: 3000},
+		Mail: MailConfig{Driver: "file", From: "LiteRank Books <no-reply@localhost>", BaseURL: "http://localhost:8080",
+			Locale: "en", VerifyHours: 48, ResetMinutes: 60, OutboxDir: "outbox", SMTP: SMTPConfig{Port: 587}},
+		MFA:     MFAConfig{Issuer: "LiteRank Books", ChallengeSeconds: 300, Skew: 1, RecoveryCodes: 10},
+		OIDC:    OIDCConfig{Scopes: "email profile", Provision: true, StateMinutes: 10},
+		APIKeys: APIKeysConfig{MaxPerUser: 20, DefaultDays: 90, MaxDays: 365},
+	}
+}
+
+// Load builds the config in layers: the defaults, then the YAML file if any, then the environment.
+// Every field can be set by a variable named after its YAML keys, like LRBOOKS_APP_TOKEN_SECRET,
+// or read from the file named by the same variable with a _FILE suffix.
+func Load(filename string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := Default()
+	if filename != "" {
+		buf, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(buf, c); err != nil {
+			return nil, fmt.Errorf("failed to parse file %s: %v", filename, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"), lookupEnv); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnv sets every field of the struct that has a variable in the environment
+func applyEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := prefix + "_" + strings.ToUpper(yamlName(t.Field(i)))
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, name, lookupEnv); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := lookupEnv(name)
+		if path, isFile := lookupEnv(name + fileSuffix); isFile {
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %v", name+fileSuffix, err)
+			}
+			value, ok = strings.TrimRight(string(buf), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+		if err := setValue(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an unsigned integer", value)
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// Validate checks the config and reports all its problems at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(validPort(c.App.Port), "app.port must be between 1 and 65535, got %d", c.App.Port)
+	check(c.App.GRPCPort == 0 || validPort(c.App.GRPCPort),
+		"app.grpc_port must be between 1 and 65535, or 0 to disable gRPC, got %d", c.App.GRPCPort)
+	check(c.App.GRPCPort != c.App.Port, "app.grpc_port must differ from app.port")
+	check(c.App.PageSize > 0, "app.page_size must be greater than 0, got %d", c.App.PageSize)
+	check(c.App.TokenSecret != "", "app.token_secret must not be empty")
+	check(c.App.TokenHours > 0, "app.token_hours must be greater than 0, got %d", c.App.TokenHours)
+	check(c.App.MaxBodyBytes > 0, "app.max_body_bytes must be greater than 0, got %d", c.App.MaxBodyBytes)
+	check(c.App.ReadTimeout >= 0 && c.App.WriteTimeout >= 0 && c.App.IdleTimeout >= 0 && c.App.ShutdownTimeout >= 0,
+		"app timeouts must not be negative")
+	check(c.App.DrainDelay >= 0, "app.drain_delay must not be negative, got %d", c.App.DrainDelay)
+	for _, p := range c.App.ProxyList() {
+		check(validProxy(p), "app.trusted_proxies must list IPs and CIDRs, got %q", p)
+	}
+	check(c.DB.DSN != "", "db.dsn must not be empty")
+	check(c.DB.MongoURI != "", "db.mongo_uri must not be empty")
+	check(c.DB.MongoDBName != "", "db.mongo_db_name must not be empty")
+	check(c.DB.MaxOpenConns >= 0 && c.DB.MaxIdleConns >= 0 && c.DB.ConnMaxLifetime >= 0,
+		"db pool settings must not be negative")
+	check(c.DB.MongoMaxPoolSize == 0 || c.DB.MongoMinPoolSize <= c.DB.MongoMaxPoolSize,
+		"db.mongo_min_pool_size must not exceed db.mongo_max_pool_size")
+	check(c.Cache.Address != "", "cache.address must not be empty")
+	check(c.Cache.Timeout >= 0, "cache.timeout must not be negative")
+	check(c.Cache.TTL >= 0, "cache.ttl must not be negative")
+	policies := reflect.ValueOf(c.Cache.Policies)
+	for i := 0; i < policies.NumField(); i++ {
+		p := policies.Field(i).Interface().(CachePolicy)
+		check(p.TTL >= 0 && p.Jitter >= 0 && p.MaxSize >= 0,
+			"cache.policies.%s must not have negative ttl, jitter or max_size", yamlName(policies.Type().Field(i)))
+	}
+	limits := reflect.ValueOf(c.RateLimit.Policies)
+	for i := 0; i < limits.NumField(); i++ {
+		p := limits.Field(i).Interface().(RateLimitPolicy)
+		name := yamlName(limits.Type().Field(i))
+		check(p.Rate >= 0 && p.Period >= 0 && p.Burst >= 0,
+			"rate_limit.policies.%s must not have negative rate, period or burst", name)
+		check(oneOf(p.Key, "", "ip", "user", "api_key"),
+			"rate_limit.policies.%s.key must be one of ip, user and api_key, got %q", name, p.Key)
+	}
+	check(c.Lockout.MaxFailures >= 0 && c.Lockout.MaxIPFailures >= 0 && c.Lockout.Delay >= 0 &&
+		c.Lockout.MaxDelay >= 0, "lockout settings must not be negative")
+	check(c.Lockout.MaxFailures == 0 && c.Lockout.MaxIPFailures == 0 || c.Lockout.Window > 0 && c.Lockout.Duration > 0,
+		"lockout.window and lockout.duration must be greater than 0 when lockout is on")
+	check(oneOf(c.Mail.Driver, "smtp", "file", "log"), "mail.driver must be one of smtp, file and log, got %q",
+		c.Mail.Driver)
+	check(c.Mail.From != "", "mail.from must not be empty")
+	check(c.Mail.VerifyHours > 0 && c.Mail.ResetMinutes > 0,
+		"mail.verify_hours and mail.reset_minutes must be greater than 0")
+	check(c.Mail.Driver != "smtp" || c.Mail.SMTP.Host != "" && validPort(c.Mail.SMTP.Port),
+		"mail.smtp.host and mail.smtp.port must be set for the smtp driver")
+	check(c.Mail.Driver != "file" || c.Mail.OutboxDir != "", "mail.outbox_dir must be set for the file driver")
+	check(c.MFA.Issuer != "" && !strings.Contains(c.MFA.Issuer, ":"),
+		"mfa.issuer must not be empty or contain a colon, got %q", c.MFA.Issuer)
+	check(c.MFA.ChallengeSeconds > 0, "mfa.challenge_seconds must be greater than 0, got %d", c.MFA.ChallengeSeconds)
+	check(c.MFA.Skew >= 0 && c.MFA.Skew <= 10, "mfa.skew must be between 0 and 10, got %d", c.MFA.Skew)
+	check(c.MFA.RecoveryCodes > 0 && c.MFA.RecoveryCodes <= 100,
+		"mfa.recovery_codes must be between 1 and 100, got %d", c.MFA.RecoveryCodes)
+	check(!c.OIDC.Enabled || c.OIDC.Issuer != "" && c.OIDC.ClientID != "" && c.OIDC.RedirectURL != "",
+		"oidc.issuer, oidc.client_id and oidc.redirect_url must be set when oidc is enabled")
+	check(c.OIDC.StateMinutes > 0, "oidc.state_minutes must be greater than 0, got %d", c.OIDC.StateMinutes)
+	check(c.APIKeys.MaxPerUser > 0, "api_keys.max_per_user must be greater than 0, got %d", c.APIKeys.MaxPerUser)
+	check(c.APIKeys.DefaultDays > 0 && c.APIKeys.DefaultDays <= c.APIKeys.MaxDays,
+		"api_keys.default_days must be between 1 and api_keys.max_days, got %d", c.APIKeys.DefaultDays)
+	check(oneOf(c.Log.Level, "", "debug", "info", "warn", "error"),
+		"log.level must be one of debug, info, warn and error, got %q", c.Log.Level)
+	check(oneOf(c.Log.Format, "", "json", "text"), "log.format must be json or text, got %q", c.Log.Format)
+	check(oneOf(c.Trace.Exporter, "", "none", "otlp", "stdout"),
+		"trace.exporter must be one of otlp, stdout and none, got %q", c.Trace.Exporter)
+	check(c.Trace.SampleRatio >= 0 && c.Trace.SampleRatio <= 1,
+		"trace.sample_ratio must be between 0 and 1, got %v", c.Trace.SampleRatio)
+	return errors.Join(errs...)
+}
+
+// ProxyList returns the trusted proxies as a list, nil if there are none
+func (c *ApplicationConfig) ProxyList() []string {
+	var proxies []string
+	for _, p := range strings.Split(c.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+func validProxy(p string) bool {
+	if _, _, err := net.ParseCIDR(p); err == nil {
+		return true
+	}
+	return net.ParseIP(p) != nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func oneOf(value string, options ...string) bool {
+	for _, o := range options {
+		if value == o {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the config with the secrets hidden, safe to print.
+func (c *Config) Redacted() *Config {
+	r := *c
+	redact(reflect.ValueOf(&r).Elem())
+	return &r
+}
+
+// redact hides every non-empty field tagged secret:"true"
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			redact(field)
+			continue
+		}
+		if t.Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String && field.String() != "" {
+			field.SetString(redacted)
+		}
+	}
+}
+
+// Diff lists the keys, like app.page_size, whose values differ between the configs.
+func Diff(a, b *Config) []string {
+	return diff(reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), "")
+}
+
+func diff(a, b reflect.Value, prefix string) []string {
+	keys := make([]string, 0)
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := yamlName(t.Field(i))
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if a.Field(i).Kind() == reflect.Struct {
+			keys = append(keys, diff(a.Field(i), b.Field(i), key)...)
+		} else if !a.Field(i).Equal(b.Field(i)) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
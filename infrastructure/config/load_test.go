@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// validConfig returns the defaults with the settings that have none
+func validConfig() *Config {
+	c := Default()
+	c.App.TokenSecret = "secret"
+	c.DB.DSN = "user:pass@tcp(127.0.0.1:3306)/lr_book"
+	c.DB.MongoURI = "mongodb://localhost:27017"
+	c.Cache.Address = "localhost:6379"
+	return c
+}
+
+func TestTrustedProxies(t *testing.T) {
+	tests := []struct {
+		proxies string
+		want    []string
+		valid   bool
+	}{
+		{"", nil, true},
+		{"10.0.0.1", []string{"10.0.0.1"}, true},
+		{" 10.0.0.0/8, 192.168.1.1 ,", []string{"10.0.0.0/8", "192.168.1.1"}, true},
+		{"::1, fd00::/8", []string{"::1", "fd00::/8"}, true},
+		{"proxy.local", []string{"proxy.local"}, false},
+		{"10.0.0.0/33", []string{"10.0.0.0/33"}, false},
+	}
+	for _, tt := range tests {
+		c := validConfig()
+		c.App.TrustedProxies = tt.proxies
+		if got := c.App.ProxyList(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ProxyList(%q) = %q, want %q", tt.proxies, got, tt.want)
+		}
+		if err := c.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate with trusted_proxies %q = %v, want valid %v", tt.proxies, err, tt.valid)
+		}
+	}
+}
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	env := map[string]string{"LRBOOKS_APP_TRUSTED_PROXIES": "10.0.0.0/8"}
+	c, err := Load("", func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.App.TrustedProxies != "10.0.0.0/8" {
+		t.Errorf("trusted_proxies = %q, want it from the environment", c.App.TrustedProxies)
+	}
+}
+
+func TestDrainDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   int
+		wantErr bool
+	}{
+		{"default", Default().App.DrainDelay, false},
+		{"off", 0, false},
+		{"negative", -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			c.App.DrainDelay = tt.delay
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
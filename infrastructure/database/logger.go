@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const slowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger sends gorm logs to the structured logger
+type gormLogger struct {
+	logger *slog.Logger
+}
+
+func newGormLogger(logger *slog.Logger) gormlogger.Interface {
+	return &gormLogger{logger: logger.With("component", "gorm")}
+}
+
+// LogMode is a no-op, since levels are set on the structured logger
+func (l *gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.InfoContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	l.logger.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+// Trace logs failed and slow queries, and every query at debug level
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	sql, rows := fc()
+	attrs := []any{"sql", sql, "rows", rows, "elapsed", elapsed}
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		l.logger.ErrorContext(ctx, "SQL query failed", append(attrs, logging.KeyError, err)...)
+	case elapsed > slowQueryThreshold:
+		l.logger.WarnContext(ctx, "Slow SQL query", attrs...)
+	default:
+		l.logger.DebugContext(ctx, "SQL query", attrs...)
+	}
+}
+
+// ParamsFilter keeps query parameters, like password hashes, out of the logs
+func (l *gormLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// newMongoMonitor logs failed mongo commands
+func newMongoMonitor(logger *slog.Logger) *event.CommandMonitor {
+	logger = logger.With("component", "mongo")
+	return &event.CommandMonitor{
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			logger.ErrorContext(ctx, "Mongo command failed", "command", e.CommandName,
+				"elapsed", e.Duration, logging.KeyError, e.Failure)
+		},
+	}
+}
+
+// joinMonitors fans every mongo command event out to all the monitors
+func joinMonitors(monitors []*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,316 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialects with migrations of their own
+const (
+	DialectMySQL  = "mysql"
+	DialectSQLite = "sqlite"
+)
+
+const (
+	// MigrationsDir is where the migrations live in the source tree
+	MigrationsDir = "infrastructure/database/migrations"
+
+	migrationLockName    = "lrbooks_schema_migrations"
+	migrationLockTimeout = 60
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFile matches names like 0001_create_books.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var migrationTables = map[string]string{
+	DialectMySQL: "CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at DATETIME(3) NOT NULL)",
+	DialectSQLite: "CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL, applied_at DATETIME NOT NULL)",
+}
+
+// Migration is a numbered schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells if a migration has been applied, and when
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations of a dialect, recording them in the schema_migrations table.
+// Runs hold a lock, so that replicas booting together do not migrate twice.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []*Migration
+	logger     *slog.Logger
+}
+
+// NewMigrator constructs a new Migrator for the dialect
+func NewMigrator(db *sql.DB, dialect string, logger *slog.Logger) (*Migrator, error) {
+	if _, ok := migrationTables[dialect]; !ok {
+		return nil, fmt.Errorf("unknown dialect %q", dialect)
+	}
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", dialect))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations, logger: logger}, nil
+}
+
+// Up applies at most steps pending migrations in order, or all of them if steps is not positive.
+// It returns the number of migrations applied.
+func (m *Migrator) Up(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if steps > 0 && count == steps {
+				break
+			}
+			if err := execScript(ctx, conn, mg.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %04d_%s: %w", mg.Version, mg.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				mg.Version, mg.Name, time.Now().UTC()); err != nil {
+				return err
+			}
+			m.logger.InfoContext(ctx, "Migration applied", "version", mg.Version, "name", mg.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down reverts at most steps applied migrations, the latest first, and returns how many it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if err := execScript(ctx, conn, mg.Down); err != nil {
+				return fmt.Errorf("failed to revert migration %04d_%s: %w", mg.Version, mg.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mg.Version); err != nil {
+				return err
+			}
+			m.logger.InfoContext(ctx, "Migration reverted", "version", mg.Version, "name", mg.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var result []*MigrationStatus
+	err := m.locked(ctx, func(_ *sql.Conn, applied map[int64]time.Time) error {
+		for _, mg := range m.migrations {
+			s := &MigrationStatus{Version: mg.Version, Name: mg.Name}
+			if at, ok := applied[mg.Version]; ok {
+				s.AppliedAt = &at
+			}
+			result = append(result, s)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// locked runs f on a connection holding the migration lock, with the versions applied so far.
+// MySQL takes a named lock, released even if the process dies. SQLite runs f in one immediate
+// transaction, which locks out other writers and undoes a failed run as a whole.
+func (m *Migrator) locked(ctx context.Context, f func(*sql.Conn, map[int64]time.Time) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch m.dialect {
+	case DialectMySQL:
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).
+			Scan(&got); err != nil {
+			return err
+		}
+		if got.Int64 != 1 {
+			return fmt.Errorf("timed out waiting for the migration lock")
+		}
+		defer func() {
+			// A fresh context, so that the lock is released even if ctx is done
+			_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName)
+		}()
+	case DialectSQLite:
+		if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+				return
+			}
+			_, err = conn.ExecContext(ctx, "COMMIT")
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, migrationTables[m.dialect]); err != nil {
+		return err
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return f(conn, applied)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version int64
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// execScript runs the statements of the script one by one.
+// Statements end with a semicolon at the end of a line; lines starting with -- are comments.
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	var stmt strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if _, err := conn.ExecContext(ctx, stmt.String()); err != nil {
+				return err
+			}
+			stmt.Reset()
+		}
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		if _, err := conn.ExecContext(ctx, stmt.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMigrations reads the migrations in the directory, ordered by version
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := migrationFile.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		buf, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mg
+		} else if mg.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", mg.Name, match[2], version)
+		}
+		if match[3] == "up" {
+			mg.Up = string(buf)
+		} else {
+			mg.Down = string(buf)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", mg.Version, mg.Name)
+		}
+		migrations = append(migrations, mg)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// CreateMigration adds empty up and down scripts of the next version for every dialect
+// to the migrations directory of the source tree, and returns their paths
+func CreateMigration(dir, name string) ([]string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return nil, fmt.Errorf("migration name %q must only have letters, digits and underscores", name)
+	}
+	var next int64 = 1
+	dialects := []string{DialectMySQL, DialectSQLite}
+	for _, d := range dialects {
+		migrations, err := loadMigrations(os.DirFS(dir), d)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(migrations); n > 0 && migrations[n-1].Version >= next {
+			next = migrations[n-1].Version + 1
+		}
+	}
+	files := make([]string, 0, 2*len(dialects))
+	for _, d := range dialects {
+		for _, direction := range []string{"up", "down"} {
+			file := filepath.Join(dir, d, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			content := fmt.Sprintf("-- %s: %s %s\n", d, name, direction)
+			if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestMigrator returns a migrator of an empty in-memory SQLite database, with its gorm handle
+func newTestMigrator(t *testing.T) (*Migrator, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"),
+		&gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	m, err := NewMigrator(sqlDB, DialectSQLite, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, db
+}
+
+func TestBackfillEmailVerified(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t)
+	up := func(steps int) {
+		t.Helper()
+		if _, err := m.Up(ctx, steps); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert := func(email string) {
+		t.Helper()
+		if err := db.Exec("INSERT INTO users (email, password, salt, is_admin) VALUES (?, '', '', 0)",
+			email).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	up(2)
+	insert("old@example.com")
+	up(0)
+	insert("new@example.com")
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"old@example.com", true},
+		{"new@example.com", false},
+	}
+	for _, tt := range tests {
+		var verified bool
+		if err := db.Raw("SELECT email_verified FROM users WHERE email = ?", tt.email).Scan(&verified).Error; err != nil {
+			t.Fatal(err)
+		}
+		if verified != tt.want {
+			t.Errorf("%s verified = %v, want %v", tt.email, verified, tt.want)
+		}
+	}
+}
+
+// schema lists the tables with their columns, and the indexes, of the SQLite database, but schema_migrations
+func schema(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var items []string
+	if err := db.Raw("SELECT m.name || '.' || p.name FROM sqlite_master m JOIN pragma_table_info(m.name) p " +
+		"WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' AND m.name != 'schema_migrations' " +
+		"UNION ALL SELECT 'index ' || name FROM sqlite_master WHERE type = 'index' AND name NOT LIKE 'sqlite_%' " +
+		"ORDER BY 1").Scan(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestMigrationsUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t)
+	// Each migration is applied, reverted and applied again, and its down script must restore the schema before it
+	for _, mg := range m.migrations {
+		before := schema(t, db)
+		if n, err := m.Up(ctx, 1); err != nil || n != 1 {
+			t.Fatalf("up %04d_%s = %d, %v", mg.Version, mg.Name, n, err)
+		}
+		after := schema(t, db)
+		if n, err := m.Down(ctx, 1); err != nil || n != 1 {
+			t.Fatalf("down %04d_%s = %d, %v", mg.Version, mg.Name, n, err)
+		}
+		if got := schema(t, db); strings.Join(got, "\n") != strings.Join(before, "\n") {
+			t.Errorf("down %04d_%s left\n%v\nwant\n%v", mg.Version, mg.Name, got, before)
+		}
+		if _, err := m.Up(ctx, 1); err != nil {
+			t.Fatalf("up %04d_%s again: %v", mg.Version, mg.Name, err)
+		}
+		if got := schema(t, db); strings.Join(got, "\n") != strings.Join(after, "\n") {
+			t.Errorf("up %04d_%s again made\n%v\nwant\n%v", mg.Version, mg.Name, got, after)
+		}
+	}
+	if n, err := m.Up(ctx, 0); err != nil || n != 0 {
+		t.Errorf("up with nothing pending = %d, %v", n, err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("%04d_%s is not applied", s.Version, s.Name)
+		}
+	}
+	if n, err := m.Down(ctx, len(m.migrations)); err != nil || n != len(m.migrations) {
+		t.Fatalf("down all = %d, %v", n, err)
+	}
+	if got := schema(t, db); len(got) != 0 {
+		t.Errorf("down all left %v", got)
+	}
+}
+
+func TestDialectsHaveTheSameMigrations(t *testing.T) {
+	var names [2][]string
+	for i, d := range []string{DialectMySQL, DialectSQLite} {
+		migrations, err := loadMigrations(migrationFiles, "migrations/"+d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mg := range migrations {
+			names[i] = append(names[i], fmt.Sprintf("%04d_%s", mg.Version, mg.Name))
+		}
+	}
+	if strings.Join(names[0], " ") != strings.Join(names[1], " ") {
+		t.Errorf("mysql has %v, sqlite has %v", names[0], names[1])
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []int64
+		wantErr bool
+	}{
+		{"ordered by version", fstest.MapFS{
+			"m/0002_b.up.sql":   {Data: []byte("B;")},
+			"m/0001_a.up.sql":   {Data: []byte("A;")},
+			"m/0001_a.down.sql": {Data: []byte("-A;")},
+			"m/README.md":       {Data: []byte("not a migration")},
+		}, []int64{1, 2}, false},
+		{"no up script", fstest.MapFS{"m/0001_a.down.sql": {Data: []byte("-A;")}}, nil, true},
+		{"shared version", fstest.MapFS{
+			"m/0001_a.up.sql": {Data: []byte("A;")},
+			"m/0001_b.up.sql": {Data: []byte("B;")},
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "m")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadMigrations error = %v, want error %v", err, tt.wantErr)
+			}
+			var got []int64
+			for _, mg := range migrations {
+				got = append(got, mg.Version)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{DialectMySQL, DialectSQLite} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, DialectSQLite, "0007_old.up.sql"), []byte("A;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := CreateMigration(dir, "add_book_language")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("created %v, want up and down scripts of both dialects", files)
+	}
+	for _, f := range files {
+		if !strings.HasPrefix(filepath.Base(f), "0008_add_book_language.") {
+			t.Errorf("created %s, want version 0008", f)
+		}
+	}
+	if _, err := CreateMigration(dir, "bad name"); err == nil {
+		t.Error("CreateMigration accepted a name with a space")
+	}
+}
@@ -0,0 +1,13 @@
+-- Matches the table gorm used to create, so existing databases adopt it as is
+CREATE TABLE IF NOT EXISTS `books` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `title` longtext,
+  `author` longtext,
+  `published_at` longtext,
+  `description` longtext,
+  `isbn` longtext,
+  `total_pages` bigint,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`)
+);
@@ -0,0 +1,11 @@
+-- Matches the table gorm used to create, so existing databases adopt it as is
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `email` longtext,
+  `password` longtext,
+  `salt` longtext,
+  `is_admin` boolean,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE `users` ADD COLUMN `email_verified` boolean NOT NULL DEFAULT false;
+ALTER TABLE `users` ADD COLUMN `locale` varchar(16) NOT NULL DEFAULT '';
+-- Accounts made before email verification existed are taken as verified, so that they can still post reviews
+UPDATE `users` SET `email_verified` = true;
@@ -0,0 +1,13 @@
+ALTER TABLE `users` ADD COLUMN `totp_secret` varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `totp_step` bigint NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `mfa_enabled` boolean NOT NULL DEFAULT false;
+ALTER TABLE `users` ADD COLUMN `mfa_counter` int unsigned NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `code_hash` varchar(64) NOT NULL,
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_recovery_codes_user_id` (`user_id`)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE `users` DROP COLUMN `is_author`;
+DROP TABLE IF EXISTS `external_identities`;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `external_identities` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `issuer` varchar(255) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `email` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_external_identities_issuer_subject` (`issuer`, `subject`),
+  INDEX `idx_external_identities_user_id` (`user_id`)
+);
+-- Mapped roles are kept with the user, so the author role is stored too
+ALTER TABLE `users` ADD COLUMN `is_author` boolean NOT NULL DEFAULT false;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS `api_keys` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(32) NOT NULL,
+  `key_hash` char(64) NOT NULL,
+  `scopes` varchar(255) NOT NULL DEFAULT '',
+  `permission` tinyint unsigned NOT NULL,
+  `expires_at` datetime(3) NOT NULL,
+  `last_used_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_api_keys_prefix` (`prefix`),
+  INDEX `idx_api_keys_user_id` (`user_id`)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE `users` ADD COLUMN `display_name` varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `bio` varchar(1000) NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `avatar_url` varchar(2048) NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `pending_email` varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `token_version` int unsigned NOT NULL DEFAULT 0;
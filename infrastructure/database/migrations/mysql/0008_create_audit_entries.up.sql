@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS `audit_entries` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `actor_id` bigint unsigned NOT NULL DEFAULT 0,
+  `api_key_id` bigint unsigned NOT NULL DEFAULT 0,
+  `action` varchar(64) NOT NULL,
+  `target_type` varchar(32) NOT NULL DEFAULT '',
+  `target_id` varchar(64) NOT NULL DEFAULT '',
+  `before_data` text NULL,
+  `after_data` text NULL,
+  `ip` varchar(64) NOT NULL DEFAULT '',
+  `request_id` varchar(128) NOT NULL DEFAULT '',
+  `created_at` datetime(6) NOT NULL,
+  `prev_hash` char(64) NOT NULL,
+  `hash` char(64) NOT NULL,
+  `salt` varchar(64) NOT NULL DEFAULT '',
+  `erased_digest` varchar(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_audit_entries_prev_hash` (`prev_hash`),
+  INDEX `idx_audit_entries_actor_id` (`actor_id`),
+  INDEX `idx_audit_entries_target` (`target_type`, `target_id`),
+  INDEX `idx_audit_entries_action` (`action`),
+  INDEX `idx_audit_entries_created_at` (`created_at`)
+);
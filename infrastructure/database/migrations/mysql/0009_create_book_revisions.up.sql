@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS `book_revisions` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `book_id` bigint unsigned NOT NULL,
+  `rev` int unsigned NOT NULL,
+  `title` longtext,
+  `author` longtext,
+  `published_at` longtext,
+  `description` longtext,
+  `isbn` longtext,
+  `total_pages` bigint,
+  `editor_id` bigint unsigned NOT NULL DEFAULT 0,
+  `reverted_from` int unsigned NOT NULL DEFAULT 0,
+  `created_at` datetime(3) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_book_revisions_book_rev` (`book_id`, `rev`)
+);
+-- Existing books start their history with what they are now
+INSERT INTO `book_revisions` (`book_id`, `rev`, `title`, `author`, `published_at`, `description`, `isbn`,
+  `total_pages`, `created_at`)
+SELECT `id`, 1, `title`, `author`, `published_at`, `description`, `isbn`, `total_pages`,
+  COALESCE(`updated_at`, `created_at`, NOW(3))
+FROM `books`
+WHERE `id` NOT IN (SELECT `book_id` FROM `book_revisions`);
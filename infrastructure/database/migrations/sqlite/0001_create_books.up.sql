@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `books` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `title` text,
+  `author` text,
+  `published_at` text,
+  `description` text,
+  `isbn` text,
+  `total_pages` integer,
+  `created_at` datetime,
+  `updated_at` datetime
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS `users` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `email` text,
+  `password` text,
+  `salt` text,
+  `is_admin` numeric,
+  `created_at` datetime,
+  `updated_at` datetime
+);
@@ -0,0 +1,4 @@
+ALTER TABLE `users` ADD COLUMN `email_verified` numeric NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `locale` text NOT NULL DEFAULT '';
+-- Accounts made before email verification existed are taken as verified, so that they can still post reviews
+UPDATE `users` SET `email_verified` = 1;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `recovery_codes`;
+ALTER TABLE `users` DROP COLUMN `mfa_counter`;
+ALTER TABLE `users` DROP COLUMN `mfa_enabled`;
+ALTER TABLE `users` DROP COLUMN `totp_step`;
+ALTER TABLE `users` DROP COLUMN `totp_secret`;
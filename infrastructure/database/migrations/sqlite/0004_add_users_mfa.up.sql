@@ -0,0 +1,12 @@
+ALTER TABLE `users` ADD COLUMN `totp_secret` text NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `totp_step` integer NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `mfa_enabled` numeric NOT NULL DEFAULT 0;
+ALTER TABLE `users` ADD COLUMN `mfa_counter` integer NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `code_hash` text NOT NULL,
+  `used_at` datetime,
+  `created_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_user_id` ON `recovery_codes` (`user_id`);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `external_identities` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `issuer` text NOT NULL,
+  `subject` text NOT NULL,
+  `email` text NOT NULL DEFAULT '',
+  `created_at` datetime,
+  `updated_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_external_identities_issuer_subject` ON `external_identities` (`issuer`, `subject`);
+CREATE INDEX IF NOT EXISTS `idx_external_identities_user_id` ON `external_identities` (`user_id`);
+-- Mapped roles are kept with the user, so the author role is stored too
+ALTER TABLE `users` ADD COLUMN `is_author` numeric NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `api_keys` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer NOT NULL,
+  `name` text NOT NULL,
+  `prefix` text NOT NULL,
+  `key_hash` text NOT NULL,
+  `scopes` text NOT NULL DEFAULT '',
+  `permission` integer NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `last_used_at` datetime,
+  `revoked_at` datetime,
+  `created_at` datetime,
+  `updated_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_keys_prefix` ON `api_keys` (`prefix`);
+CREATE INDEX IF NOT EXISTS `idx_api_keys_user_id` ON `api_keys` (`user_id`);
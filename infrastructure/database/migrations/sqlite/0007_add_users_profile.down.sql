@@ -0,0 +1,5 @@
+ALTER TABLE `users` DROP COLUMN `token_version`;
+ALTER TABLE `users` DROP COLUMN `pending_email`;
+ALTER TABLE `users` DROP COLUMN `avatar_url`;
+ALTER TABLE `users` DROP COLUMN `bio`;
+ALTER TABLE `users` DROP COLUMN `display_name`;
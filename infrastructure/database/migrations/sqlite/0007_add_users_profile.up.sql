@@ -0,0 +1,5 @@
+ALTER TABLE `users` ADD COLUMN `display_name` text NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `bio` text NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `avatar_url` text NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `pending_email` text NOT NULL DEFAULT '';
+ALTER TABLE `users` ADD COLUMN `token_version` integer NOT NULL DEFAULT 0;
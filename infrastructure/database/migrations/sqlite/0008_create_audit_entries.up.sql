@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS `audit_entries` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `actor_id` integer NOT NULL DEFAULT 0,
+  `api_key_id` integer NOT NULL DEFAULT 0,
+  `action` text NOT NULL,
+  `target_type` text NOT NULL DEFAULT '',
+  `target_id` text NOT NULL DEFAULT '',
+  `before_data` text,
+  `after_data` text,
+  `ip` text NOT NULL DEFAULT '',
+  `request_id` text NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  `prev_hash` text NOT NULL,
+  `hash` text NOT NULL,
+  `salt` text NOT NULL DEFAULT '',
+  `erased_digest` text NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_audit_entries_prev_hash` ON `audit_entries` (`prev_hash`);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_actor_id` ON `audit_entries` (`actor_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_target` ON `audit_entries` (`target_type`, `target_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_action` ON `audit_entries` (`action`);
+CREATE INDEX IF NOT EXISTS `idx_audit_entries_created_at` ON `audit_entries` (`created_at`);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS `book_revisions` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `book_id` integer NOT NULL,
+  `rev` integer NOT NULL,
+  `title` text,
+  `author` text,
+  `published_at` text,
+  `description` text,
+  `isbn` text,
+  `total_pages` integer,
+  `editor_id` integer NOT NULL DEFAULT 0,
+  `reverted_from` integer NOT NULL DEFAULT 0,
+  `created_at` datetime NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_book_revisions_book_rev` ON `book_revisions` (`book_id`, `rev`);
+-- Existing books start their history with what they are now
+INSERT INTO `book_revisions` (`book_id`, `rev`, `title`, `author`, `published_at`, `description`, `isbn`,
+  `total_pages`, `created_at`)
+SELECT `id`, 1, `title`, `author`, `published_at`, `description`, `isbn`, `total_pages`,
+  COALESCE(`updated_at`, `created_at`, CURRENT_TIMESTAMP)
+FROM `books`
+WHERE `id` NOT IN (SELECT `book_id` FROM `book_revisions`);
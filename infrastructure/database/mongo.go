@@ -7,41 +7,110 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/config"
 )
 
+const collReview = "reviews"
+
+// Field names of the review documents
 const (
-	collReview  = "reviews"
-	idField     = "_id"
-	bookIDField = "bookid"
+	fieldID        = "_id"
+	fieldBookID    = "bookid"
+	fieldUserID    = "userid"
+	fieldAuthor    = "author"
+	fieldTitle     = "title"
+	fieldContent   = "content"
+	fieldCreatedAt = "createdat"
+	fieldUpdatedAt = "updatedat"
 )
 
+var errReviewNotFound = fmt.Errorf("review %w", model.ErrNotFound)
+
+// reviewDoc is the stored form of a review
+type reviewDoc struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	BookID    uint               `bson:"bookid"`
+	UserID    uint               `bson:"userid,omitempty"`
+	Author    string             `bson:"author"`
+	Title     string             `bson:"title"`
+	Content   string             `bson:"content"`
+	CreatedAt time.Time          `bson:"createdat"`
+	UpdatedAt time.Time          `bson:"updatedat"`
+}
+
+func newReviewDoc(r *model.Review) *reviewDoc {
+	return &reviewDoc{
+		BookID:    r.BookID,
+		UserID:    r.UserID,
+		Author:    r.Author,
+		Title:     r.Title,
+		Content:   r.Content,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+}
+
+func (d *reviewDoc) model() *model.Review {
+	return &model.Review{
+		ID:        d.ID.Hex(),
+		BookID:    d.BookID,
+		UserID:    d.UserID,
+		Author:    d.Author,
+		Title:     d.Title,
+		Content:   d.Content,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+}
+
 // MongoPersistence runs all mongoDB operations
 type MongoPersistence struct {
-	db   *mongo.Database
-	coll *mongo.Collection
+	client *mongo.Client
+	db     *mongo.Database
+	coll   *mongo.Collection
 }
 
 // NewMongoPersistence constructs a new MongoPersistence
-func NewMongoPersistence(mongoURI, dbName string) (*MongoPersistence, error) {
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(mongoURI))
+func NewMongoPersistence(c *config.DBConfig, logger *slog.Logger, monitors ...*event.CommandMonitor) (
+	*MongoPersistence, error) {
+	monitor := joinMonitors(append([]*event.CommandMonitor{newMongoMonitor(logger)}, monitors...))
+	opts := options.Client().ApplyURI(c.MongoURI).SetMonitor(monitor)
+	if c.MongoMaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MongoMaxPoolSize)
+	}
+	opts.SetMinPoolSize(c.MongoMinPoolSize)
+	client, err := mongo.Connect(context.Background(), opts)
 	if err != nil {
 		return nil, err
 	}
-	db := client.Database(dbName)
+	db := client.Database(c.MongoDBName)
 	coll := db.Collection(collReview)
-	return &MongoPersistence{db, coll}, nil
+	return &MongoPersistence{client, db, coll}, nil
+}
+
+// Ping checks the connection to the database
+func (m *MongoPersistence) Ping(ctx context.Context) error {
+	return m.client.Ping(ctx, nil)
+}
+
+// Close disconnects the client, waiting for the operations in use
+func (m *MongoPersistence) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
 }
 
 // CreateReview creates a new review
 func (m *MongoPersistence) CreateReview(ctx context.Context, r *model.Review) (string, error) {
-	result, err := m.coll.InsertOne(ctx, r)
+	result, err := m.coll.InsertOne(ctx, newReviewDoc(r))
 	if err != nil {
 		return "", err
 	}
@@ -54,77 +123,128 @@ func (m *MongoPersistence) CreateReview(ctx context.Context, r *model.Review) (s
 
 // UpdateReview updates a review by its ID and the new content
 func (m *MongoPersistence) UpdateReview(ctx context.Context, id string, r *model.Review) error {
-	objID, err := primitive.ObjectIDFromHex(id)
+	objID, err := reviewObjectID(id)
 	if err != nil {
 		return err
 	}
 	updateValues := bson.M{
-		"title":     r.Title,
-		"content":   r.Content,
-		"updatedat": r.UpdatedAt,
+		fieldTitle:     r.Title,
+		fieldContent:   r.Content,
+		fieldUpdatedAt: r.UpdatedAt,
 	}
-	result, err := m.coll.UpdateOne(ctx, bson.M{idField: objID}, bson.M{"$set": updateValues})
+	result, err := m.coll.UpdateOne(ctx, bson.M{fieldID: objID}, bson.M{"$set": updateValues})
 	if err != nil {
 		return err
 	}
 	if result.ModifiedCount == 0 {
-		return errors.New("review does not exist")
+		return errReviewNotFound
 	}
 	return nil
 }
 
 // DeleteReview deletes a review by ID
 func (m *MongoPersistence) DeleteReview(ctx context.Context, id string) error {
-	objID, err := primitive.ObjectIDFromHex(id)
+	objID, err := reviewObjectID(id)
 	if err != nil {
 		return err
 	}
-	result, err := m.coll.DeleteOne(ctx, bson.M{idField: objID})
+	result, err := m.coll.DeleteOne(ctx, bson.M{fieldID: objID})
 	if err != nil {
 		return err
 	}
 	if result.DeletedCount == 0 {
-		return errors.New("review does not exist")
+		return errReviewNotFound
 	}
 	return nil
 }
 
 // GetReview gets a review by ID
 func (m *MongoPersistence) GetReview(ctx context.Context, id string) (*model.Review, error) {
-	objID, err := primitive.ObjectIDFromHex(id)
+	objID, err := reviewObjectID(id)
 	if err != nil {
 		return nil, err
 	}
-	var review model.Review
-	if err := m.coll.FindOne(ctx, bson.M{idField: objID}).Decode(&review); err != nil {
+	var doc reviewDoc
+	if err := m.coll.FindOne(ctx, bson.M{fieldID: objID}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errReviewNotFound
+		}
 		return nil, err
 	}
-	return &review, nil
+	return doc.model(), nil
 }
 
-// GetReviewsOfBook gets a list of reviews by a keyword
+// GetReviewsOfBook gets a list of reviews by a keyword, in creation order.
+// The keyword is matched against the words of the titles and contents by the text index.
 func (m *MongoPersistence) GetReviewsOfBook(ctx context.Context, bookID uint, keyword string) ([]*model.Review, error) {
-	filter := bson.M{bookIDField: bookID}
+	filter := bson.M{fieldBookID: bookID}
 	if keyword != "" {
-		filter = bson.M{
-			"$and": []bson.M{
-				{"$or": []bson.M{
-					{"title": bson.M{"$regex": keyword, "$options": "i"}},
-					{"content": bson.M{"$regex": keyword, "$options": "i"}},
-				}},
-				{bookIDField: bookID},
-			},
+		filter["$text"] = bson.M{"$search": keyword}
+	}
+	return m.findReviews(ctx, filter)
+}
+
+// GetReviewsOfBooks gets all reviews of the given books in one query
+func (m *MongoPersistence) GetReviewsOfBooks(ctx context.Context, bookIDs []uint) ([]*model.Review, error) {
+	return m.findReviews(ctx, bson.M{fieldBookID: bson.M{"$in": bookIDs}})
+}
+
+// GetReviewsOfUser gets the reviews the user posted
+func (m *MongoPersistence) GetReviewsOfUser(ctx context.Context, userID uint) ([]*model.Review, error) {
+	return m.findReviews(ctx, bson.M{fieldUserID: userID})
+}
+
+// AnonymizeReviews unlinks the reviews of the user from it under the author name,
+// and returns the books of those reviews and how many there were
+func (m *MongoPersistence) AnonymizeReviews(ctx context.Context, userID uint, author string) ([]uint, int64, error) {
+	filter := bson.M{fieldUserID: userID}
+	values, err := m.coll.Distinct(ctx, fieldBookID, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	bookIDs := make([]uint, 0, len(values))
+	for _, v := range values {
+		switch id := v.(type) {
+		case int32:
+			bookIDs = append(bookIDs, uint(id))
+		case int64:
+			bookIDs = append(bookIDs, uint(id))
 		}
 	}
-	cursor, err := m.coll.Find(ctx, filter)
+	result, err := m.coll.UpdateMany(ctx, filter, bson.M{
+		"$set":   bson.M{fieldAuthor: author},
+		"$unset": bson.M{fieldUserID: ""},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return bookIDs, result.MatchedCount, nil
+}
+
+// findReviews finds the reviews matching the filter, in creation order
+func (m *MongoPersistence) findReviews(ctx context.Context, filter bson.M) ([]*model.Review, error) {
+	opts := options.Find().SetSort(bson.D{{Key: fieldBookID, Value: 1}, {Key: fieldCreatedAt, Value: 1}})
+	cursor, err := m.coll.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	reviews := make([]*model.Review, 0)
-	if err := cursor.All(ctx, &reviews); err != nil {
+	var docs []*reviewDoc
+	if err := cursor.All(ctx, &docs); err != nil {
 		return nil, err
 	}
+	reviews := make([]*model.Review, 0, len(docs))
+	for _, d := range docs {
+		reviews = append(reviews, d.model())
+	}
 	return reviews, nil
 }
+
+func reviewObjectID(id string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return objID, fmt.Errorf("%w: %v", model.ErrInvalidArgument, err)
+	}
+	return objID, nil
+}
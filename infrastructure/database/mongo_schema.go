@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo error code of a missing collection
+const codeNamespaceNotFound = 26
+
+// reviewValidator is the JSON schema every review document must match
+var reviewValidator = bson.M{
+	"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{fieldBookID, fieldTitle, fieldContent, fieldCreatedAt},
+		"properties": bson.M{
+			fieldBookID:    bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+			fieldUserID:    bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+			fieldAuthor:    bson.M{"bsonType": "string"},
+			fieldTitle:     bson.M{"bsonType": "string", "minLength": 1},
+			fieldContent:   bson.M{"bsonType": "string", "minLength": 1},
+			fieldCreatedAt: bson.M{"bsonType": "date"},
+			fieldUpdatedAt: bson.M{"bsonType": "date"},
+		},
+	},
+}
+
+// reviewIndexes serve the review queries: the reviews of books in creation order,
+// the keyword search, the reviews of an author, and those of a user
+var reviewIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: fieldBookID, Value: 1}, {Key: fieldCreatedAt, Value: 1}},
+		Options: options.Index().SetName("bookid_createdat"),
+	},
+	{
+		Keys:    bson.D{{Key: fieldTitle, Value: "text"}, {Key: fieldContent, Value: "text"}},
+		Options: options.Index().SetName("title_content_text").SetWeights(bson.M{fieldTitle: 2, fieldContent: 1}),
+	},
+	{
+		Keys:    bson.D{{Key: fieldAuthor, Value: 1}},
+		Options: options.Index().SetName("author"),
+	},
+	{
+		Keys:    bson.D{{Key: fieldUserID, Value: 1}},
+		Options: options.Index().SetName("userid").SetSparse(true),
+	},
+}
+
+// EnsureSchema creates the reviews collection with its validator and indexes, or brings them up to date.
+// It is safe to run any number of times.
+func (m *MongoPersistence) EnsureSchema(ctx context.Context, logger *slog.Logger) error {
+	// Existing documents that break the schema stay readable and deletable, but cannot be updated until fixed
+	err := m.db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collReview},
+		{Key: "validator", Value: reviewValidator},
+		{Key: "validationLevel", Value: "moderate"},
+	}).Err()
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == codeNamespaceNotFound {
+		err = m.db.CreateCollection(ctx, collReview, options.CreateCollection().SetValidator(reviewValidator))
+	}
+	if err != nil {
+		return err
+	}
+	names, err := m.coll.Indexes().CreateMany(ctx, reviewIndexes)
+	if err != nil {
+		return err
+	}
+	logger.Info("Mongo schema ensured", "collection", collReview, "indexes", names)
+	return nil
+}
@@ -5,60 +5,188 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/config"
 )
 
 // MySQLPersistence runs all MySQL operations
 type MySQLPersistence struct {
 	db       *gorm.DB
-	pageSize int
+	pageSize atomic.Int64
 }
 
 // NewMySQLPersistence constructs a new MySQLPersistence
-func NewMySQLPersistence(dsn string, pageSize int) (*MySQLPersistence, error) {
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+func NewMySQLPersistence(c *config.DBConfig, pageSize int, logger *slog.Logger, plugins ...gorm.Plugin) (
+	*MySQLPersistence, error) {
+	db, err := gorm.Open(mysql.Open(c.DSN), &gorm.Config{TranslateError: true, Logger: newGormLogger(logger)})
 	if err != nil {
 		return nil, err
 	}
-	// Auto Migrate the data structs
-	if err := db.AutoMigrate(&model.Book{}, &model.User{}); err != nil {
+	sqlDB, err := db.DB()
+	if err != nil {
 		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(c.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Second * time.Duration(c.ConnMaxLifetime))
+	for _, p := range plugins {
+		if err := db.Use(p); err != nil {
+			return nil, err
+		}
+	}
+	s := &MySQLPersistence{db: db}
+	s.SetPageSize(pageSize)
+	return s, nil
+}
 
-	return &MySQLPersistence{db, pageSize}, nil
+// SetPageSize changes the page size of book lists, safe while serving
+func (s *MySQLPersistence) SetPageSize(pageSize int) {
+	s.pageSize.Store(int64(pageSize))
 }
 
-// CreateBook creates a new book
-func (s *MySQLPersistence) CreateBook(ctx context.Context, b *model.Book) (uint, error) {
-	if err := s.db.WithContext(ctx).Create(b).Error; err != nil {
-		return 0, err
+// Migrator returns the migrator of the MySQL schema
+func (s *MySQLPersistence) Migrator(logger *slog.Logger) (*Migrator, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
 	}
-	return b.ID, nil
+	return NewMigrator(sqlDB, DialectMySQL, logger)
 }
 
-// UpdateBook updates a book by its ID and the new content
-func (s *MySQLPersistence) UpdateBook(ctx context.Context, id uint, b *model.Book) error {
-	var book model.Book
-	if err := s.db.WithContext(ctx).First(&book, id).Error; err != nil {
+// Ping checks the connection to the database
+func (s *MySQLPersistence) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Close closes all connections of the pool
+func (s *MySQLPersistence) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
 		return err
 	}
-	return s.db.WithContext(ctx).Model(book).Updates(b).Error
+	return sqlDB.Close()
 }
 
-// DeleteBook deletes a book by ID
+// CreateBook creates a new book, with its first revision
+func (s *MySQLPersistence) CreateBook(ctx context.Context, b *model.Book, editorID uint) (uint, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(b).Error; err != nil {
+			return err
+		}
+		_, err := addRevision(tx, b, editorID, 0)
+		return err
+	})
+	if err != nil {
+		return 0, domainError(err)
+	}
+	return b.ID, nil
+}
+
+// UpdateBook updates a book by its ID and the new content, and keeps the result as its next revision
+func (s *MySQLPersistence) UpdateBook(ctx context.Context, id uint, b *model.Book, editorID uint) error {
+	return domainError(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		book, err := lockBook(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(book).Updates(b).Error; err != nil {
+			return err
+		}
+		// Zero fields are left as they were, so the revision is read back
+		if err := tx.First(book, id).Error; err != nil {
+			return err
+		}
+		_, err = addRevision(tx, book, editorID, 0)
+		return err
+	}))
+}
+
+// DeleteBook deletes a book by ID. Its revisions are kept, so its history outlives it.
 func (s *MySQLPersistence) DeleteBook(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Delete(&model.Book{}, id).Error
+	return domainError(s.db.WithContext(ctx).Delete(&model.Book{}, id).Error)
+}
+
+// RevertBook restores the book to the revision, and keeps the result as its next revision
+func (s *MySQLPersistence) RevertBook(ctx context.Context, id, rev uint, editorID uint) (*model.BookRevision, error) {
+	var r *model.BookRevision
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		book, err := lockBook(tx, id)
+		if err != nil {
+			return err
+		}
+		var old model.BookRevision
+		if err := tx.Where("book_id = ? AND rev = ?", id, rev).First(&old).Error; err != nil {
+			return err
+		}
+		book.Title, book.Author, book.PublishedAt = old.Title, old.Author, old.PublishedAt
+		book.Description, book.ISBN, book.TotalPages = old.Description, old.ISBN, old.TotalPages
+		// Every field is written, so that the ones emptied since are restored too
+		if err := tx.Select("*").Omit("id", "created_at").Save(book).Error; err != nil {
+			return err
+		}
+		r, err = addRevision(tx, book, editorID, rev)
+		return err
+	})
+	if err != nil {
+		return nil, domainError(err)
+	}
+	return r, nil
+}
+
+// GetBookRevisions gets a page of the revisions of a book, the latest first
+func (s *MySQLPersistence) GetBookRevisions(ctx context.Context, id uint, offset int) ([]*model.BookRevision, error) {
+	revisions := make([]*model.BookRevision, 0)
+	if err := s.db.WithContext(ctx).Where("book_id = ?", id).Order("rev DESC").
+		Offset(offset).Limit(int(s.pageSize.Load())).Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	if len(revisions) > 0 {
+		return revisions, nil
+	}
+	// Deleted books keep their revisions, so a book with neither a row nor a revision never existed
+	var n int64
+	err := s.db.WithContext(ctx).Model(&model.Book{}).Where("id = ?", id).Count(&n).Error
+	if err == nil && n == 0 {
+		err = s.db.WithContext(ctx).Model(&model.BookRevision{}).Where("book_id = ?", id).Count(&n).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%w: book %d", model.ErrNotFound, id)
+	}
+	return revisions, nil
+}
+
+// GetBookRevision gets a revision of a book by its number
+func (s *MySQLPersistence) GetBookRevision(ctx context.Context, id, rev uint) (*model.BookRevision, error) {
+	var r model.BookRevision
+	if err := s.db.WithContext(ctx).Where("book_id = ? AND rev = ?", id, rev).First(&r).Error; err != nil {
+		return nil, domainError(err)
+	}
+	return &r, nil
 }
 
 // GetBook gets a book by ID
 func (s *MySQLPersistence) GetBook(ctx context.Context, id uint) (*model.Book, error) {
 	var book model.Book
 	if err := s.db.WithContext(ctx).First(&book, id).Error; err != nil {
-		return nil, err
+		return nil, domainError(err)
 	}
 	return &book, nil
 }
@@ -71,16 +199,50 @@ func (s *MySQLPersistence) GetBooks(ctx context.Context, offset int, keyword str
 		term := "%" + keyword + "%"
 		tx = tx.Where("title LIKE ?", term).Or("author LIKE ?", term)
 	}
-	if err := tx.Offset(offset).Limit(s.pageSize).Find(&books).Error; err != nil {
+	if err := tx.Offset(offset).Limit(int(s.pageSize.Load())).Find(&books).Error; err != nil {
 		return nil, err
 	}
 	return books, nil
 }
 
+// lockBook reads the book and locks it until the transaction ends, so that its revisions are numbered in turn
+func lockBook(tx *gorm.DB, id uint) (*model.Book, error) {
+	var book model.Book
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// addRevision keeps the book as its next revision; the transaction must hold the book locked or have created it
+func addRevision(tx *gorm.DB, b *model.Book, editorID, revertedFrom uint) (*model.BookRevision, error) {
+	var last uint
+	if err := tx.Model(&model.BookRevision{}).Where("book_id = ?", b.ID).
+		Select("COALESCE(MAX(rev), 0)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+	r := &model.BookRevision{
+		BookID:       b.ID,
+		Rev:          last + 1,
+		Title:        b.Title,
+		Author:       b.Author,
+		PublishedAt:  b.PublishedAt,
+		Description:  b.Description,
+		ISBN:         b.ISBN,
+		TotalPages:   b.TotalPages,
+		EditorID:     editorID,
+		RevertedFrom: revertedFrom,
+	}
+	if err := tx.Create(r).Error; err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // CreateUser creates a new user
 func (s *MySQLPersistence) CreateUser(ctx context.Context, u *model.User) (uint, error) {
 	if err := s.db.WithContext(ctx).Create(u).Error; err != nil {
-		return 0, err
+		return 0, domainError(err)
 	}
 	return u.ID, nil
 }
@@ -89,7 +251,390 @@ func (s *MySQLPersistence) CreateUser(ctx context.Context, u *model.User) (uint,
 func (s *MySQLPersistence) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	var u model.User
 	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&u).Error; err != nil {
-		return nil, err
+		return nil, domainError(err)
+	}
+	return &u, nil
+}
+
+// GetUser gets the user by ID
+func (s *MySQLPersistence) GetUser(ctx context.Context, id uint) (*model.User, error) {
+	var u model.User
+	if err := s.db.WithContext(ctx).First(&u, id).Error; err != nil {
+		return nil, domainError(err)
+	}
+	return &u, nil
+}
+
+// SetEmailVerified marks the email of the user as verified
+func (s *MySQLPersistence) SetEmailVerified(ctx context.Context, id uint) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"email_verified": true})
+}
+
+// UpdatePassword sets the password hash and salt of the user, and revokes the user's tokens
+func (s *MySQLPersistence) UpdatePassword(ctx context.Context, id uint, password, salt string) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"password": password, "salt": salt,
+		"token_version": gorm.Expr("token_version + 1")})
+}
+
+// RevokeTokens raises the token version of the user, so that no token issued before is accepted
+func (s *MySQLPersistence) RevokeTokens(ctx context.Context, id uint) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"token_version": gorm.Expr("token_version + 1")})
+}
+
+// SetTOTPSecret keeps the secret of an authenticator being enrolled, with two-factor authentication off
+func (s *MySQLPersistence) SetTOTPSecret(ctx context.Context, id uint, secret string) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"totp_secret": secret, "mfa_enabled": false})
+}
+
+// EnableMFA turns two-factor authentication on, and replaces the recovery codes
+func (s *MySQLPersistence) EnableMFA(ctx context.Context, id uint, codeHashes []string) error {
+	return domainError(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{ID: id}).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+		return setRecoveryCodes(tx, id, codeHashes)
+	}))
+}
+
+// DisableMFA turns two-factor authentication off, and drops the secret and the recovery codes
+func (s *MySQLPersistence) DisableMFA(ctx context.Context, id uint) error {
+	return domainError(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{ID: id}).
+			Updates(map[string]interface{}{"mfa_enabled": false, "totp_secret": "", "totp_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return setRecoveryCodes(tx, id, nil)
+	}))
+}
+
+// UseTOTPStep records the time step of an accepted code and counts it in mfa_counter,
+// unless it is not after the last one
+func (s *MySQLPersistence) UseTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ? AND totp_step < ?", id, step).
+		Updates(map[string]interface{}{"totp_step": step, "mfa_counter": gorm.Expr("mfa_counter + 1")})
+	return result.RowsAffected == 1, domainError(result.Error)
+}
+
+// SetRecoveryCodes replaces the recovery codes of the user
+func (s *MySQLPersistence) SetRecoveryCodes(ctx context.Context, id uint, codeHashes []string) error {
+	return domainError(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return setRecoveryCodes(tx, id, codeHashes)
+	}))
+}
+
+// UseRecoveryCode marks the unused recovery code as used and counts it in mfa_counter, unless there is none
+func (s *MySQLPersistence) UseRecoveryCode(ctx context.Context, id uint, codeHash string) (bool, error) {
+	used := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", id, codeHash).Update("used_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		used = true
+		return tx.Model(&model.User{}).Where("id = ?", id).Update("mfa_counter", gorm.Expr("mfa_counter + 1")).Error
+	})
+	return used, domainError(err)
+}
+
+// GetUserByIdentity gets the user linked to the account of an external provider
+func (s *MySQLPersistence) GetUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	var u model.User
+	err := s.db.WithContext(ctx).
+		Joins("JOIN external_identities ON external_identities.user_id = users.id").
+		Where("external_identities.issuer = ? AND external_identities.subject = ?", issuer, subject).
+		First(&u).Error
+	if err != nil {
+		return nil, domainError(err)
 	}
 	return &u, nil
 }
+
+// LinkIdentity links the account of an external provider to an existing user
+func (s *MySQLPersistence) LinkIdentity(ctx context.Context, ext *model.ExternalIdentity) error {
+	return domainError(s.db.WithContext(ctx).Create(ext).Error)
+}
+
+// ProvisionUser creates a user for the account of an external provider, linked to it
+func (s *MySQLPersistence) ProvisionUser(ctx context.Context, u *model.User, ext *model.ExternalIdentity) (
+	uint, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		ext.UserID = u.ID
+		return tx.Create(ext).Error
+	})
+	if err != nil {
+		return 0, domainError(err)
+	}
+	return u.ID, nil
+}
+
+// SetRoles grants or revokes the admin and author roles of the user
+func (s *MySQLPersistence) SetRoles(ctx context.Context, id uint, isAdmin, isAuthor bool) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"is_admin": isAdmin, "is_author": isAuthor})
+}
+
+// CreateAPIKey creates a new API key
+func (s *MySQLPersistence) CreateAPIKey(ctx context.Context, k *model.APIKey) (uint, error) {
+	if err := s.db.WithContext(ctx).Create(k).Error; err != nil {
+		return 0, domainError(err)
+	}
+	return k.ID, nil
+}
+
+// GetAPIKeyByPrefix gets the API key of the prefix, revoked or not
+func (s *MySQLPersistence) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	var k model.APIKey
+	if err := s.db.WithContext(ctx).Where("prefix = ?", prefix).First(&k).Error; err != nil {
+		return nil, domainError(err)
+	}
+	return &k, nil
+}
+
+// ListAPIKeys lists the API keys of the user, newest first
+func (s *MySQLPersistence) ListAPIKeys(ctx context.Context, userID uint) ([]*model.APIKey, error) {
+	keys := make([]*model.APIKey, 0)
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// TouchAPIKey records the last use of the API key
+func (s *MySQLPersistence) TouchAPIKey(ctx context.Context, id uint, t time.Time) error {
+	return domainError(s.db.WithContext(ctx).Model(&model.APIKey{ID: id}).UpdateColumn("last_used_at", t).Error)
+}
+
+// RevokeAPIKey revokes the unrevoked API key of the user
+func (s *MySQLPersistence) RevokeAPIKey(ctx context.Context, userID, id uint) error {
+	result := s.db.WithContext(ctx).Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return domainError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: no active API key %d", model.ErrNotFound, id)
+	}
+	return nil
+}
+
+// RevokeAPIKeys revokes all API keys of the user
+func (s *MySQLPersistence) RevokeAPIKeys(ctx context.Context, userID uint) (int64, error) {
+	result := s.db.WithContext(ctx).Model(&model.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now())
+	return result.RowsAffected, domainError(result.Error)
+}
+
+// UpdateProfile sets the profile fields of the user
+func (s *MySQLPersistence) UpdateProfile(ctx context.Context, id uint, displayName, bio, avatarURL string) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"display_name": displayName, "bio": bio,
+		"avatar_url": avatarURL})
+}
+
+// SetPendingEmail keeps the new email of a change until it is confirmed
+func (s *MySQLPersistence) SetPendingEmail(ctx context.Context, id uint, email string) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"pending_email": email})
+}
+
+// ChangeEmail makes the new email the verified email of the user, and drops the pending one
+func (s *MySQLPersistence) ChangeEmail(ctx context.Context, id uint, email string) error {
+	return s.updateUser(ctx, id, map[string]interface{}{"email": email, "email_verified": true, "pending_email": ""})
+}
+
+const tableUsers = "users"
+
+// userTables are the tables that keep rows of a user, the users table last
+var userTables = []struct {
+	name   string
+	column string
+	model  interface{}
+}{
+	{"recovery_codes", "user_id", &model.RecoveryCode{}},
+	{"external_identities", "user_id", &model.ExternalIdentity{}},
+	{"api_keys", "user_id", &model.APIKey{}},
+	{tableUsers, "id", &model.User{}},
+}
+
+// DeleteUser deletes the user, with its recovery codes, external identities and API keys,
+// and returns the rows deleted from each table
+func (s *MySQLPersistence) DeleteUser(ctx context.Context, id uint) (map[string]int64, error) {
+	deleted := make(map[string]int64, len(userTables))
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, t := range userTables {
+			result := tx.Where(t.column+" = ?", id).Delete(t.model)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted[t.name] = result.RowsAffected
+		}
+		if deleted[tableUsers] == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, domainError(err)
+	}
+	return deleted, nil
+}
+
+// CountUserRows counts the rows of the user in each table that DeleteUser deletes from
+func (s *MySQLPersistence) CountUserRows(ctx context.Context, id uint) (map[string]int64, error) {
+	counts := make(map[string]int64, len(userTables))
+	for _, t := range userTables {
+		var n int64
+		if err := s.db.WithContext(ctx).Model(t.model).Where(t.column+" = ?", id).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts[t.name] = n
+	}
+	return counts, nil
+}
+
+// ListIdentities lists the accounts of external providers linked to the user
+func (s *MySQLPersistence) ListIdentities(ctx context.Context, id uint) ([]*model.ExternalIdentity, error) {
+	identities := make([]*model.ExternalIdentity, 0)
+	if err := s.db.WithContext(ctx).Where("user_id = ?", id).Order("id").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func setRecoveryCodes(tx *gorm.DB, id uint, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", id).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	codes := make([]*model.RecoveryCode, len(codeHashes))
+	for i, h := range codeHashes {
+		codes[i] = &model.RecoveryCode{UserID: id, CodeHash: h}
+	}
+	return tx.Create(codes).Error
+}
+
+func (s *MySQLPersistence) updateUser(ctx context.Context, id uint, values map[string]interface{}) error {
+	return domainError(s.db.WithContext(ctx).Model(&model.User{ID: id}).Updates(values).Error)
+}
+
+// auditAppendAttempts bounds the retries of appends that lose the race for the end of the chain
+const auditAppendAttempts = 5
+
+// AppendAudit chains the entry to the last one, sets its hash and appends it.
+// Entries chained to the same one break the unique prev_hash, so the loser of a race retries.
+func (s *MySQLPersistence) AppendAudit(ctx context.Context, e *model.AuditEntry) error {
+	var err error
+	for i := 0; i < auditAppendAttempts; i++ {
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var last model.AuditEntry
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id DESC").Limit(1).
+				Find(&last).Error; err != nil {
+				return err
+			}
+			e.ID = 0
+			e.PrevHash = last.Hash
+			e.Hash = e.ComputeHash()
+			return tx.Create(e).Error
+		})
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			break
+		}
+	}
+	return domainError(err)
+}
+
+// ListAudit lists the entries matching the filter, newest first
+func (s *MySQLPersistence) ListAudit(ctx context.Context, f *model.AuditFilter) ([]*model.AuditEntry, error) {
+	q := s.db.WithContext(ctx)
+	if f.ActorID != 0 {
+		q = q.Where("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		q = q.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		q = q.Where("target_id = ?", f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+	if f.BeforeID != 0 {
+		q = q.Where("id < ?", f.BeforeID)
+	}
+	entries := make([]*model.AuditEntry, 0)
+	if err := q.Order("id DESC").Limit(f.Limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListAuditChain lists at most limit entries after the one of afterID, oldest first
+func (s *MySQLPersistence) ListAuditChain(ctx context.Context, afterID uint, limit int) ([]*model.AuditEntry, error) {
+	entries := make([]*model.AuditEntry, 0, limit)
+	if err := s.db.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListAuditOfUser lists the entries the user did, or which target the user, oldest first
+func (s *MySQLPersistence) ListAuditOfUser(ctx context.Context, userID uint) ([]*model.AuditEntry, error) {
+	entries := make([]*model.AuditEntry, 0)
+	if err := auditOfUser(s.db.WithContext(ctx), userID).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// EraseAuditOfUser erases the personal fields of the entries of the user, keeping their digests in their place
+func (s *MySQLPersistence) EraseAuditOfUser(ctx context.Context, userID uint) (int64, error) {
+	var erased int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var entries []*model.AuditEntry
+		if err := auditOfUser(tx, userID).Where("erased_digest = ''").Find(&entries).Error; err != nil {
+			return err
+		}
+		for _, e := range entries {
+			e.Erase()
+			if err := tx.Model(&model.AuditEntry{ID: e.ID}).UpdateColumns(map[string]interface{}{
+				"before_data": e.Before, "after_data": e.After, "ip": e.IP, "salt": e.Salt,
+				"erased_digest": e.ErasedDigest,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		erased = int64(len(entries))
+		return nil
+	})
+	return erased, domainError(err)
+}
+
+// auditOfUser narrows the query to the entries the user did, or which target the user
+func auditOfUser(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userID, model.AuditTargetUser,
+		strconv.FormatUint(uint64(userID), 10))
+}
+
+// domainError converts gorm errors into domain errors
+func domainError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w: %v", model.ErrNotFound, err)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return fmt.Errorf("%w: %v", model.ErrAlreadyExists, err)
+	}
+	return err
+}
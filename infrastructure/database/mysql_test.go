@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// newTestPersistence returns a MySQLPersistence over an in-memory SQLite database with every migration applied
+func newTestPersistence(t *testing.T) *MySQLPersistence {
+	t.Helper()
+	m, db := newTestMigrator(t)
+	if _, err := m.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	s := &MySQLPersistence{db: db}
+	s.SetPageSize(10)
+	return s
+}
+
+func TestDeleteBookKeepsRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPersistence(t)
+	id, err := s.CreateBook(ctx, &model.Book{Title: "Dune", Author: "Frank Herbert"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateBook(ctx, id, &model.Book{Title: "Dune Messiah"}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteBook(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetBook(ctx, id); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("GetBook of a deleted book = %v, want ErrNotFound", err)
+	}
+	revisions, err := s.GetBookRevisions(ctx, id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Title != "Dune Messiah" || revisions[1].Title != "Dune" {
+		t.Fatalf("revisions after the delete = %+v, want both", revisions)
+	}
+	if _, err := s.RevertBook(ctx, id, 1, 1); !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("RevertBook of a deleted book = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetBookRevisionsOfUnknownBooks(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPersistence(t)
+	deleted, err := s.CreateBook(ctx, &model.Book{Title: "Dune"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteBook(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.CreateBook(ctx, &model.Book{Title: "Emma"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A book without revisions, like one inserted around the app, still exists
+	if err := s.db.Exec("INSERT INTO books (id, title) VALUES (100, 'Ulysses')").Error; err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		id      uint
+		offset  int
+		want    int
+		wantErr error
+	}{
+		{"book", kept, 0, 1, nil},
+		{"past the last page", kept, 10, 0, nil},
+		{"deleted book", deleted, 0, 1, nil},
+		{"deleted book past the last page", deleted, 10, 0, nil},
+		{"book without revisions", 100, 0, 0, nil},
+		{"book that never existed", 999, 0, 0, model.ErrNotFound},
+	}
+	for _, tt := range tests {
+		revisions, err := s.GetBookRevisions(ctx, tt.id, tt.offset)
+		if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+			t.Errorf("%s: GetBookRevisions error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(revisions) != tt.want {
+			t.Errorf("%s: got %d revisions, want %d", tt.name, len(revisions), tt.want)
+		}
+	}
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPersistence(t)
+	id, err := s.CreateUser(ctx, &model.User{Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		step int64
+		want bool
+	}{
+		{"first code", 100, true},
+		{"same step again", 100, false},
+		{"earlier step", 99, false},
+		{"next step", 101, true},
+		{"replay of the next step", 101, false},
+	}
+	for _, tt := range tests {
+		fresh, err := s.UseTOTPStep(ctx, id, tt.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fresh != tt.want {
+			t.Errorf("%s: UseTOTPStep(%d) = %v, want %v", tt.name, tt.step, fresh, tt.want)
+		}
+	}
+}
+
+func TestSecondFactorsAreCounted(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPersistence(t)
+	id, err := s.CreateUser(ctx, &model.User{Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableMFA(ctx, id, []string{"code1", "code2"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		use         func() (bool, error)
+		want        bool
+		wantCounter uint
+	}{
+		{"code", func() (bool, error) { return s.UseTOTPStep(ctx, id, 100) }, true, 1},
+		{"replayed code", func() (bool, error) { return s.UseTOTPStep(ctx, id, 100) }, false, 1},
+		{"recovery code", func() (bool, error) { return s.UseRecoveryCode(ctx, id, "code1") }, true, 2},
+		{"used recovery code", func() (bool, error) { return s.UseRecoveryCode(ctx, id, "code1") }, false, 2},
+		{"unknown recovery code", func() (bool, error) { return s.UseRecoveryCode(ctx, id, "code3") }, false, 2},
+		{"other recovery code", func() (bool, error) { return s.UseRecoveryCode(ctx, id, "code2") }, true, 3},
+	}
+	for _, tt := range tests {
+		used, err := tt.use()
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := s.GetUser(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != tt.want || u.MFACounter != tt.wantCounter {
+			t.Errorf("%s: used %v, counter %d; want %v, %d", tt.name, used, u.MFACounter, tt.want, tt.wantCounter)
+		}
+	}
+}
+
+func TestGetAPIKeyByPrefix(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPersistence(t)
+	k := &model.APIKey{UserID: 1, Name: "ci", Prefix: "0a1b2c3d4e5f", KeyHash: "hash", Scopes: "books:read",
+		ExpiresAt: time.Now().Add(time.Hour)}
+	id, err := s.CreateAPIKey(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup := &model.APIKey{UserID: 2, Name: "other", Prefix: k.Prefix, KeyHash: "other", ExpiresAt: k.ExpiresAt}
+	if _, err := s.CreateAPIKey(ctx, dup); !errors.Is(err, model.ErrAlreadyExists) {
+		t.Errorf("CreateAPIKey with a taken prefix = %v, want ErrAlreadyExists", err)
+	}
+	if err := s.RevokeAPIKey(ctx, 1, id); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		prefix  string
+		wantErr error
+	}{
+		{"revoked key", k.Prefix, nil},
+		{"unknown prefix", "ffffffffffff", model.ErrNotFound},
+		{"part of a prefix", "0a1b2c", model.ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := s.GetAPIKeyByPrefix(ctx, tt.prefix)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: GetAPIKeyByPrefix error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got.ID != id || got.KeyHash != "hash" || got.RevokedAt == nil) {
+			t.Errorf("%s: GetAPIKeyByPrefix = %+v, want the revoked key %d", tt.name, got, id)
+		}
+	}
+}
+
+func TestAuditChainRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := newTestPersistence(t)
+	for _, action := range []string{model.AuditBookCreate, model.AuditBookUpdate, model.AuditBookDelete} {
+		e := &model.AuditEntry{ActorID: 1, Action: action, TargetType: model.AuditTargetBook, TargetID: "7",
+			After: `{"title":"Dune"}`, IP: "203.0.113.7", Salt: "salt", CreatedAt: time.Now()}
+		if err := s.AppendAudit(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := s.ListAuditChain(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("chain has %d entries, want 3", len(entries))
+	}
+	prev := ""
+	for i, e := range entries {
+		if e.PrevHash != prev || e.Hash != e.ComputeHash() {
+			t.Errorf("entry %d does not verify after a round trip: %+v", i, e)
+		}
+		prev = e.Hash
+	}
+	if n, err := s.EraseAuditOfUser(ctx, 1); err != nil || n != 3 {
+		t.Fatalf("EraseAuditOfUser = %d, %v, want 3", n, err)
+	}
+	if entries, err = s.ListAuditChain(ctx, 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if e.IP != "" || e.After != "" || e.Salt != "" || e.Hash != e.ComputeHash() {
+			t.Errorf("erased entry %d does not verify without its personal fields: %+v", i, e)
+		}
+	}
+	after, err := s.ListAuditChain(ctx, entries[0].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 2 || after[0].ID != entries[1].ID {
+		t.Errorf("chain after entry %d = %d entries, want the last 2", entries[0].ID, len(after))
+	}
+}
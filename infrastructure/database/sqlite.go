@@ -5,6 +5,7 @@ package database
 
 import (
 	"context"
+	"log/slog"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -18,14 +19,37 @@ type SQLitePersistence struct {
 }
 
 // NewSQLitePersistence constructs a new SQLitePersistence
-func NewSQLitePersistence(fileName string) (*SQLitePersistence, error) {
+func NewSQLitePersistence(fileName string, plugins ...gorm.Plugin) (*SQLitePersistence, error) {
 	db, err := gorm.Open(sqlite.Open(fileName), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
+	for _, p := range plugins {
+		if err := db.Use(p); err != nil {
+			return nil, err
+		}
+	}
 	return &SQLitePersistence{db}, nil
 }
 
+// Migrator returns the migrator of the SQLite schema
+func (s *SQLitePersistence) Migrator(logger *slog.Logger) (*Migrator, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(sqlDB, DialectSQLite, logger)
+}
+
+// Close closes the database
+func (s *SQLitePersistence) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // CreateBook creates a new book
 func (s *SQLitePersistence) CreateBook(ctx context.Context, b *model.Book) (uint, error) {
 	if err := s.db.WithContext(ctx).Create(b).Error; err != nil {
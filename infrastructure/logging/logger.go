@@ -0,0 +1,161 @@
+/*
+Package logging provides structured loggers and request correlation.
+*/
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"literank.com/rest-books/infrastructure/config"
+)
+
+const (
+	maxRequestIDLen = 128
+
+	formatJSON = "json"
+	formatText = "text"
+	redacted   = "[REDACTED]"
+
+	// KeyRequestID is the log key of the request correlation ID
+	KeyRequestID = "request_id"
+	// KeyTraceID is the log key of the trace ID
+	KeyTraceID = "trace_id"
+	// KeyError is the log key of errors
+	KeyError = "error"
+)
+
+// sensitiveKeys are redacted as log keys, and as the last words of log keys like new_password and id_token.
+// Keys that only start with them, like token_version and api_key_id, are kept.
+var sensitiveKeys = []string{"password", "token", "secret", "salt", "authorization", "api_key", "dsn"}
+
+// keyWords makes the words of log keys like X-API-Key and db.dsn end with underscores
+var keyWords = strings.NewReplacer("-", "_", ".", "_")
+
+type requestIDKey struct{}
+
+// NewLogger constructs a new structured logger.
+// The returned level can be changed while the logger is in use.
+func NewLogger(c *config.LogConfig) (*slog.Logger, *slog.LevelVar, error) {
+	level := new(slog.LevelVar)
+	if err := SetLevel(level, c.Level); err != nil {
+		return nil, nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	var h slog.Handler
+	switch strings.ToLower(c.Format) {
+	case "", formatJSON:
+		h = slog.NewJSONHandler(os.Stdout, opts)
+	case formatText:
+		h = slog.NewTextHandler(os.Stdout, opts)
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q", c.Format)
+	}
+	return slog.New(&contextHandler{h}), level, nil
+}
+
+// SetLevel parses the level name, like "debug" or "warn", into the level
+func SetLevel(level *slog.LevelVar, name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// ParseLevel parses the level name, info if empty
+func ParseLevel(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return l, fmt.Errorf("unknown log level %q", name)
+	}
+	return l, nil
+}
+
+// WithRequestID returns a copy of the context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in the context, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// ValidRequestID tells if a caller-provided request ID is safe to log and echo back
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, ch := range id {
+		if !(ch == '-' || ch == '_' || ch == '.' || ch == ':' ||
+			(ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+// redact hides the values of sensitive keys
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if sensitive(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+func sensitive(key string) bool {
+	key = keyWords.Replace(strings.ToLower(key))
+	for _, k := range sensitiveKeys {
+		if key == k || strings.HasSuffix(key, "_"+k) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHandler adds the request ID and trace ID of the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String(KeyTraceID, sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"warn", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.name)
+		if (err != nil) != tt.wantErr || (err == nil && got != tt.want) {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSetLevelKeepsLevelOnError(t *testing.T) {
+	var level slog.LevelVar
+	level.Set(slog.LevelWarn)
+	if err := SetLevel(&level, "verbose"); err == nil {
+		t.Fatal("SetLevel accepted an unknown level")
+	}
+	if level.Level() != slog.LevelWarn {
+		t.Errorf("level = %v after a failed SetLevel, want %v", level.Level(), slog.LevelWarn)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		key        string
+		wantHidden bool
+	}{
+		{"password", true},
+		{"new_password", true},
+		{"current_password", true},
+		{"token", true},
+		{"id_token", true},
+		{"challenge_token", true},
+		{"client_secret", true},
+		{"totp_secret", true},
+		{"salt", true},
+		{"Authorization", true},
+		{"api_key", true},
+		{"X-API-Key", true},
+		{"db.dsn", true},
+		{"token_version", false},
+		{"token_hours", false},
+		{"api_key_id", false},
+		{"api_key_prefix", false},
+		{"keyword", false},
+		{"passwords_reset", false},
+		{"user_id", false},
+	}
+	for _, tt := range tests {
+		var logs bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{ReplaceAttr: redact}))
+		logger.Info("Test", tt.key, "value-of-the-key")
+		if hidden := !strings.Contains(logs.String(), "value-of-the-key"); hidden != tt.wantHidden {
+			t.Errorf("%s hidden = %v, want %v: %s", tt.key, hidden, tt.wantHidden, logs.String())
+		}
+	}
+}
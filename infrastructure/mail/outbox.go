@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// FileOutbox writes mails as .eml files into a directory instead of sending them, for local development and tests
+type FileOutbox struct {
+	dir  string
+	from *mail.Address
+}
+
+// NewFileOutbox constructs a new FileOutbox, creating its directory if needed
+func NewFileOutbox(dir string, from *mail.Address) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileOutbox{dir: dir, from: from}, nil
+}
+
+// Send writes the mail into a file of its own
+func (o *FileOutbox) Send(_ context.Context, m *model.Mail) error {
+	msg, err := compose(o.from, m)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), messageID()[:8])
+	// Mails carry account tokens, so only the owner may read them
+	return os.WriteFile(filepath.Join(o.dir, name), msg, 0o600)
+}
+
+// LogOutbox logs mails instead of sending them, for local development.
+// Bodies hold links with live account tokens, so they are only logged at debug level.
+type LogOutbox struct {
+	logger *slog.Logger
+	from   *mail.Address
+}
+
+// NewLogOutbox constructs a new LogOutbox
+func NewLogOutbox(logger *slog.Logger, from *mail.Address) *LogOutbox {
+	return &LogOutbox{logger: logger, from: from}
+}
+
+// Send logs the mail
+func (o *LogOutbox) Send(ctx context.Context, m *model.Mail) error {
+	if _, err := mail.ParseAddress(m.To); err != nil {
+		return fmt.Errorf("invalid recipient %q: %v", m.To, err)
+	}
+	o.logger.InfoContext(ctx, "Mail", "from", o.from.String(), "to", m.To, "subject", m.Subject)
+	o.logger.DebugContext(ctx, "Mail body", "to", m.To, "body", m.Body)
+	return nil
+}
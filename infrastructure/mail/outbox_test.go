@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"literank.com/rest-books/domain/model"
+)
+
+var resetMail = &model.Mail{To: "a@example.com", Subject: "Reset your password",
+	Body: "Reset it at http://localhost:8080/reset-password?token=live-token"}
+
+func TestLogOutboxKeepsBodiesOutOfInfoLogs(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    slog.Level
+		wantBody bool
+	}{
+		{"info", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"debug", slog.LevelDebug, true},
+	}
+	from := &mail.Address{Name: "Books", Address: "no-reply@localhost"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			o := NewLogOutbox(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: tt.level})), from)
+			if err := o.Send(context.Background(), resetMail); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(logs.String(), "live-token"); got != tt.wantBody {
+				t.Errorf("logs at %s level hold the token: %v, want %v\n%s", tt.name, got, tt.wantBody, logs.String())
+			}
+		})
+	}
+}
+
+func TestFileOutboxWritesPrivateFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	o, err := NewFileOutbox(dir, &mail.Address{Address: "no-reply@localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Send(context.Background(), resetMail); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("outbox holds %d files, want 1", len(entries))
+	}
+	info, err := entries[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mail file mode = %o, want 600", perm)
+	}
+	if err := o.Send(context.Background(), &model.Mail{To: "not an address"}); err == nil {
+		t.Error("Send took an invalid recipient")
+	}
+}
@@ -0,0 +1,98 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/template"
+
+	"literank.com/rest-books/domain/model"
+)
+
+// Names of the mail templates
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplateResetPassword = "reset_password"
+	TemplateChangeEmail   = "change_email"
+)
+
+// templateFS holds a directory of templates per locale, each defining a "subject" and a "body"
+//
+//go:embed templates
+var templateFS embed.FS
+
+// Templates renders the mails in the language of their recipients
+type Templates struct {
+	locales       map[string]map[string]*template.Template
+	defaultLocale string
+}
+
+// NewTemplates parses the embedded templates. Mails in other locales fall back to the default one.
+func NewTemplates(defaultLocale string) (*Templates, error) {
+	t := &Templates{locales: make(map[string]map[string]*template.Template)}
+	dirs, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		files, err := fs.Glob(templateFS, "templates/"+dir.Name()+"/*.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		named := make(map[string]*template.Template, len(files))
+		for _, f := range files {
+			tmpl, err := template.ParseFS(templateFS, f)
+			if err != nil {
+				return nil, err
+			}
+			named[strings.TrimSuffix(f[strings.LastIndex(f, "/")+1:], ".tmpl")] = tmpl
+		}
+		t.locales[dir.Name()] = named
+	}
+	if _, ok := t.locales[defaultLocale]; !ok {
+		return nil, fmt.Errorf("no mail templates for the default locale %q", defaultLocale)
+	}
+	t.defaultLocale = defaultLocale
+	return t, nil
+}
+
+// Match returns the supported locale closest to the language tags, like an Accept-Language header,
+// or the default locale
+func (t *Templates) Match(tags string) string {
+	for _, tag := range strings.Split(tags, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		for tag != "" {
+			if _, ok := t.locales[tag]; ok {
+				return tag
+			}
+			// Try the language without its region, like es for es-MX
+			i := strings.LastIndexAny(tag, "-_")
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return t.defaultLocale
+}
+
+// Render renders the named mail to the recipient in the locale
+func (t *Templates) Render(locale, name, to string, data interface{}) (*model.Mail, error) {
+	tmpl, ok := t.locales[t.Match(locale)][name]
+	if !ok {
+		if tmpl, ok = t.locales[t.defaultLocale][name]; !ok {
+			return nil, fmt.Errorf("unknown mail template %q", name)
+		}
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, err
+	}
+	return &model.Mail{To: to, Subject: strings.TrimSpace(subject.String()), Body: body.String()}, nil
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+
+	"literank.com/rest-books/infrastructure/cache"
+)
+
+// cacheHelper counts the hits and misses of another cache helper
+type cacheHelper struct {
+	cache.Helper
+	m *Metrics
+}
+
+// CacheHelper wraps the cache helper to count its hits and misses
+func (m *Metrics) CacheHelper(h cache.Helper) cache.Helper {
+	return &cacheHelper{Helper: h, m: m}
+}
+
+// Load reads the value by the key and counts the lookup
+func (c *cacheHelper) Load(ctx context.Context, key string) (string, error) {
+	value, err := c.Helper.Load(ctx, key)
+	switch {
+	case err != nil:
+		c.m.CountCache(ResultError)
+	case value == "":
+		c.m.CountCache(ResultMiss)
+	default:
+		c.m.CountCache(ResultHit)
+	}
+	return value, err
+}
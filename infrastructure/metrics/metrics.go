@@ -0,0 +1,134 @@
+/*
+Package metrics defines all Prometheus metrics of the app.
+*/
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "lrbooks"
+
+// Label values
+const (
+	ResultSuccess   = "success"
+	ResultFailure   = "failure"
+	ResultHit       = "hit"
+	ResultMiss      = "miss"
+	ResultError     = "error"
+	ResultLocked    = "locked"
+	ResultChallenge = "challenge"
+
+	DBMongo = "mongo"
+)
+
+// Metrics holds all metrics, registered on a registry of their own
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpDuration  *prometheus.HistogramVec
+	cacheRequests *prometheus.CounterVec
+	dbDuration    *prometheus.HistogramVec
+	dbErrors      *prometheus.CounterVec
+	signIns       *prometheus.CounterVec
+	tokenFailures *prometheus.CounterVec
+	rateLimited   *prometheus.CounterVec
+}
+
+// New constructs and registers all metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_requests_total",
+			Help:      "Cache lookups by result: hit, miss or error.",
+		}, []string{"result"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Latency of database queries by database and operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"db", "operation"}),
+		dbErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_query_errors_total",
+			Help:      "Failed database queries by database and operation.",
+		}, []string{"db", "operation"}),
+		signIns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sign_ins_total",
+			Help:      "Sign-in attempts by result: success, failure, locked or challenge.",
+		}, []string{"result"}),
+		tokenFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validation_failures_total",
+			Help:      "Rejected tokens by reason.",
+		}, []string{"reason"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests rejected by the rate limiter, by route group.",
+		}, []string{"group"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration, m.cacheRequests, m.dbDuration, m.dbErrors, m.signIns, m.tokenFailures,
+		m.rateLimited,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Registry returns the registry of all metrics
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// ObserveHTTP records a served HTTP request
+func (m *Metrics) ObserveHTTP(method, route, status string, seconds float64) {
+	m.httpDuration.WithLabelValues(method, route, status).Observe(seconds)
+}
+
+// CountCache records a cache lookup
+func (m *Metrics) CountCache(result string) {
+	m.cacheRequests.WithLabelValues(result).Inc()
+}
+
+// ObserveDB records a database query, and its failure if err is not nil
+func (m *Metrics) ObserveDB(db, operation string, seconds float64, err error) {
+	m.dbDuration.WithLabelValues(db, operation).Observe(seconds)
+	if err != nil {
+		m.dbErrors.WithLabelValues(db, operation).Inc()
+	}
+}
+
+// CountSignIn records a sign-in attempt
+func (m *Metrics) CountSignIn(result string) {
+	m.signIns.WithLabelValues(result).Inc()
+}
+
+// CountTokenFailure records a rejected token
+func (m *Metrics) CountTokenFailure(reason string) {
+	m.tokenFailures.WithLabelValues(reason).Inc()
+}
+
+// CountRateLimited records a request rejected by the rate limiter
+func (m *Metrics) CountRateLimited(group string) {
+	m.rateLimited.WithLabelValues(group).Inc()
+}
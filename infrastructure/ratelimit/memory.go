@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepSize is the number of buckets above which full buckets are dropped
+const sweepSize = 10000
+
+// memoryStore keeps the buckets of this instance in memory
+type memoryStore struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+	now  func() time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{tats: make(map[string]time.Time), now: time.Now}
+}
+
+// allow runs GCRA the same way the Redis script does
+func (s *memoryStore) allow(_ context.Context, key string, l Limit) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if len(s.tats) >= sweepSize {
+		s.sweep(now)
+	}
+	interval := l.interval()
+	tat, ok := s.tats[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(interval)
+	diff := now.Sub(newTAT.Add(-interval * time.Duration(l.Burst)))
+	if diff < 0 {
+		return &Result{Limit: l.Burst, RetryAfter: -diff, ResetAfter: tat.Sub(now)}, nil
+	}
+	s.tats[key] = newTAT
+	return &Result{Allowed: true, Limit: l.Burst, Remaining: int(diff / interval), ResetAfter: newTAT.Sub(now)}, nil
+}
+
+// sweep drops the buckets that are full again, which are the same as no bucket
+func (s *memoryStore) sweep(now time.Time) {
+	for key, tat := range s.tats {
+		if tat.Before(now) {
+			delete(s.tats, key)
+		}
+	}
+}
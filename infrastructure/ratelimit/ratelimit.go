@@ -0,0 +1,145 @@
+/*
+Package ratelimit limits request rates with GCRA token buckets.
+*/
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"literank.com/rest-books/infrastructure/config"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const (
+	keyPrefix     = "lr:rl"
+	defaultPeriod = time.Minute
+)
+
+// Group is a set of routes sharing a rate limit policy
+type Group string
+
+// Route groups
+const (
+	GroupAuth    Group = "auth"
+	GroupReviews Group = "reviews"
+	GroupGraphQL Group = "graphql"
+)
+
+// Kinds of keys requests are counted by
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyAPIKey = "api_key"
+)
+
+// Limit is a token bucket holding Burst requests, refilled by Rate requests every Period
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// interval is the time it takes to refill one request
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+// Result is the outcome of a request against its limit
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket, 0 when the request is not limited.
+	Limit int
+	// Remaining is the requests still allowed at once.
+	Remaining int
+	// RetryAfter is the time until the next request is allowed, when this one is not.
+	RetryAfter time.Duration
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// store keeps the token buckets
+type store interface {
+	allow(ctx context.Context, key string, l Limit) (*Result, error)
+}
+
+// Limiter limits each group of routes under the group's policy.
+// Buckets are kept in Redis, so that all instances share them, or in memory while Redis is unavailable.
+type Limiter struct {
+	redis    store
+	memory   *memoryStore
+	logger   *slog.Logger
+	degraded atomic.Bool
+	enabled  atomic.Bool
+	policies atomic.Pointer[map[Group]config.RateLimitPolicy]
+}
+
+// NewLimiter constructs a new Limiter over the Redis client
+func NewLimiter(client redis.Scripter, c *config.RateLimitConfig, logger *slog.Logger) *Limiter {
+	l := &Limiter{redis: newRedisStore(client), memory: newMemoryStore(), logger: logger}
+	l.SetPolicies(c)
+	return l
+}
+
+// SetPolicies swaps the policies, safe while serving
+func (l *Limiter) SetPolicies(c *config.RateLimitConfig) {
+	policies := map[Group]config.RateLimitPolicy{
+		GroupAuth:    c.Policies.Auth,
+		GroupReviews: c.Policies.Reviews,
+		GroupGraphQL: c.Policies.GraphQL,
+	}
+	l.policies.Store(&policies)
+	l.enabled.Store(c.Enabled)
+}
+
+// Policy returns the policy of the group
+func (l *Limiter) Policy(g Group) config.RateLimitPolicy {
+	return (*l.policies.Load())[g]
+}
+
+// Allow takes a request of the key off the group's bucket, and tells if it is allowed
+func (l *Limiter) Allow(ctx context.Context, g Group, key string) *Result {
+	p := l.Policy(g)
+	if !l.enabled.Load() || p.Rate <= 0 {
+		return &Result{Allowed: true}
+	}
+	limit := Limit{Rate: p.Rate, Period: time.Second * time.Duration(p.Period), Burst: p.Burst}
+	if limit.Period <= 0 {
+		limit.Period = defaultPeriod
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = p.Rate
+	}
+	key = keyPrefix + ":" + string(g) + ":" + key
+	r, err := l.redis.allow(ctx, key, limit)
+	if err == nil {
+		if l.degraded.CompareAndSwap(true, false) {
+			l.logger.InfoContext(ctx, "Rate limiting is back on Redis")
+		}
+		return r
+	}
+	// Each instance limits on its own until Redis is back
+	if !l.degraded.Swap(true) {
+		l.logger.WarnContext(ctx, "Rate limiting falls back to memory", logging.KeyError, err)
+	}
+	r, _ = l.memory.allow(ctx, key, limit)
+	return r
+}
+
+// Key returns the bucket key of a caller under the kind of key of a policy.
+// Callers without the verified API key or the user the kind asks for are counted by IP,
+// so that made-up keys cannot open fresh buckets.
+func Key(kind, ip string, apiKeyID, userID uint) string {
+	if kind == KeyAPIKey && apiKeyID != 0 {
+		return "key:" + strconv.FormatUint(uint64(apiKeyID), 10)
+	}
+	if (kind == KeyUser || kind == KeyAPIKey) && userID != 0 {
+		return "user:" + strconv.FormatUint(uint64(userID), 10)
+	}
+	return "ip:" + ip
+}
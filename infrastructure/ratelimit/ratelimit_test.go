@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"literank.com/rest-books/infrastructure/config"
+)
+
+// clock is a time that tests move by hand
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+// step is a request at an offset from the start, and what it should get
+type step struct {
+	at          time.Duration
+	allowed     bool
+	remaining   int
+	retryAfter  time.Duration
+	resetsAfter time.Duration
+}
+
+// burstOfThree is a bucket of 3 requests, refilled by one a second
+var (
+	burstOfThree = Limit{Rate: 3, Period: 3 * time.Second, Burst: 3}
+	gcraSteps    = []step{
+		{0, true, 2, 0, time.Second},
+		{0, true, 1, 0, 2 * time.Second},
+		{0, true, 0, 0, 3 * time.Second},
+		{0, false, 0, time.Second, 3 * time.Second},
+		{time.Second, true, 0, 0, 3 * time.Second},
+		{1500 * time.Millisecond, false, 0, 500 * time.Millisecond, 2500 * time.Millisecond},
+		{10 * time.Second, true, 2, 0, time.Second},
+	}
+)
+
+func TestMemoryStoreGCRA(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	c := &clock{now: start}
+	s := newMemoryStore()
+	s.now = c.Now
+	for i, st := range gcraSteps {
+		c.now = start.Add(st.at)
+		r, err := s.allow(context.Background(), "k", burstOfThree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Allowed != st.allowed || r.Remaining != st.remaining || r.RetryAfter != st.retryAfter ||
+			r.ResetAfter != st.resetsAfter || r.Limit != burstOfThree.Burst {
+			t.Errorf("request %d at %v = %+v, want %+v", i, st.at, r, st)
+		}
+	}
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	c := &clock{now: start}
+	s := newMemoryStore()
+	s.now = c.Now
+	for i := 0; i < sweepSize; i++ {
+		s.tats[string(rune(i))] = start
+	}
+	c.now = start.Add(time.Second)
+	if _, err := s.allow(context.Background(), "k", burstOfThree); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.tats) != 1 {
+		t.Errorf("buckets after a sweep = %d, want 1", len(s.tats))
+	}
+}
+
+// fakeRedis answers the script with the result it is given, or fails
+type fakeRedis struct {
+	result []interface{}
+	err    error
+	args   []interface{}
+}
+
+func (f *fakeRedis) cmd(ctx context.Context, args []interface{}) *redis.Cmd {
+	f.args = args
+	cmd := redis.NewCmd(ctx)
+	if f.err != nil {
+		cmd.SetErr(f.err)
+	} else {
+		cmd.SetVal(f.result)
+	}
+	return cmd
+}
+
+func (f *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	return f.cmd(ctx, args)
+}
+
+func (f *fakeRedis) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return f.cmd(ctx, args)
+}
+
+func (f *fakeRedis) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	return redis.NewBoolSliceCmd(ctx)
+}
+
+func (f *fakeRedis) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return redis.NewStringCmd(ctx)
+}
+
+func TestRedisStoreResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  []interface{}
+		want    Result
+		wantErr bool
+	}{
+		{"allowed", []interface{}{int64(1), int64(2), "0", "1"},
+			Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second}, false},
+		{"refused", []interface{}{int64(0), int64(0), "0.5", "2.5"},
+			Result{Limit: 3, RetryAfter: 500 * time.Millisecond, ResetAfter: 2500 * time.Millisecond}, false},
+		{"short result", []interface{}{int64(1)}, Result{}, true},
+		{"bad duration", []interface{}{int64(1), int64(2), "soon", "1"}, Result{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeRedis{result: tt.result}
+			r, err := newRedisStore(f).allow(context.Background(), "k", burstOfThree)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("allow error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && *r != tt.want {
+				t.Errorf("allow = %+v, want %+v", *r, tt.want)
+			}
+			if len(f.args) != 2 || f.args[0] != 3 || f.args[1] != 1.0 {
+				t.Errorf("script args = %v, want the burst and the interval in seconds", f.args)
+			}
+		})
+	}
+}
+
+func TestLimiterFallsBackToMemory(t *testing.T) {
+	f := &fakeRedis{err: errors.New("connection refused")}
+	c := &config.RateLimitConfig{Enabled: true, Policies: config.RateLimitPolicies{
+		Auth: config.RateLimitPolicy{Rate: 2, Period: 60},
+	}}
+	l := NewLimiter(f, c, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+	for i, want := range []bool{true, true, false} {
+		if got := l.Allow(ctx, GroupAuth, "ip:203.0.113.7").Allowed; got != want {
+			t.Errorf("request %d while Redis is down allowed = %v, want %v", i, got, want)
+		}
+	}
+	if !l.degraded.Load() {
+		t.Error("limiter is not degraded while Redis is down")
+	}
+	if !l.Allow(ctx, GroupAuth, "ip:198.51.100.1").Allowed {
+		t.Error("another caller was refused by the memory fallback")
+	}
+	if !l.Allow(ctx, GroupReviews, "ip:203.0.113.7").Allowed {
+		t.Error("a group without a policy was limited")
+	}
+
+	f.err, f.result = nil, []interface{}{int64(1), int64(0), "0", "30"}
+	if !l.Allow(ctx, GroupAuth, "ip:203.0.113.7").Allowed {
+		t.Error("Redis allowed the request, but the limiter did not")
+	}
+	if l.degraded.Load() {
+		t.Error("limiter is still degraded once Redis is back")
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		apiKeyID uint
+		userID   uint
+		want     string
+	}{
+		{"by IP", KeyIP, 3, 7, "ip:203.0.113.7"},
+		{"by user", KeyUser, 0, 7, "user:7"},
+		{"by user, with an API key", KeyUser, 3, 7, "user:7"},
+		{"by user, anonymous", KeyUser, 0, 0, "ip:203.0.113.7"},
+		{"by API key", KeyAPIKey, 3, 7, "key:3"},
+		{"by API key, with a token", KeyAPIKey, 0, 7, "user:7"},
+		{"by API key, unverified", KeyAPIKey, 0, 0, "ip:203.0.113.7"},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.kind, "203.0.113.7", tt.apiKeyID, tt.userID); got != tt.want {
+			t.Errorf("%s: Key = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestGCRAScript runs the script on the Redis of LRBOOKS_TEST_REDIS, if set, and checks it agrees with memory
+func TestGCRAScript(t *testing.T) {
+	addr := os.Getenv("LRBOOKS_TEST_REDIS")
+	if addr == "" {
+		t.Skip("LRBOOKS_TEST_REDIS is not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	ctx := context.Background()
+	key := keyPrefix + ":test:" + time.Now().Format(time.RFC3339Nano)
+	defer client.Del(ctx, key)
+	s := newRedisStore(client)
+	// Redis has its own clock, so only the steps without waits are compared
+	for i, st := range gcraSteps[:4] {
+		r, err := s.allow(ctx, key, burstOfThree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Allowed != st.allowed || r.Remaining != st.remaining {
+			t.Errorf("request %d = %+v, want %+v", i, r, st)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// gcraScript runs GCRA atomically on the theoretical arrival time (TAT) kept in KEYS[1].
+// ARGV holds the burst and the seconds it takes to refill one request.
+// It returns whether the request is allowed, the remaining requests,
+// and the seconds to retry after and to reset after, as strings to keep their fractions.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local tat = tonumber(redis.call("GET", KEYS[1])) or now
+if tat < now then
+  tat = now
+end
+local new_tat = tat + interval
+local diff = now - (new_tat - interval * burst)
+if diff < 0 then
+  return {0, 0, tostring(-diff), tostring(tat - now)}
+end
+redis.call("SET", KEYS[1], tostring(new_tat), "EX", math.ceil(new_tat - now))
+return {1, math.floor(diff / interval), "0", tostring(new_tat - now)}
+`)
+
+// redisStore keeps the buckets in Redis, shared by all instances
+type redisStore struct {
+	client redis.Scripter
+}
+
+func newRedisStore(client redis.Scripter) *redisStore {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) allow(ctx context.Context, key string, l Limit) (*Result, error) {
+	values, err := gcraScript.Run(ctx, s.client, []string{key}, l.Burst, l.interval().Seconds()).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit result: %v", values)
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	retryAfter, err := seconds(values[2])
+	if err != nil {
+		return nil, err
+	}
+	resetAfter, err := seconds(values[3])
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Allowed: allowed == 1, Limit: l.Burst, Remaining: int(remaining),
+		RetryAfter: retryAfter, ResetAfter: resetAfter}, nil
+}
+
+// seconds parses the seconds returned by the script
+func seconds(v interface{}) (time.Duration, error) {
+	s, _ := v.(string)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected rate limit duration: %v", v)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
@@ -0,0 +1,136 @@
+/*
+Package sso signs users in with external OpenID Connect providers.
+*/
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"literank.com/rest-books/domain/model"
+	"literank.com/rest-books/infrastructure/config"
+)
+
+const httpTimeout = 10 * time.Second
+
+var errNoIDToken = errors.New("no id_token in the token response")
+
+// OIDCProvider runs the authorization code flow with PKCE against an OpenID Connect provider.
+// The discovery document is fetched on the first sign-in, and again after a failure.
+type OIDCProvider struct {
+	issuer    string
+	oauth     oauth2.Config
+	roleClaim string
+	client    *http.Client
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider constructs a new OIDCProvider
+func NewOIDCProvider(c *config.OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{
+		issuer: c.Issuer,
+		oauth: oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, strings.Fields(c.Scopes)...),
+		},
+		roleClaim: c.RoleClaim,
+		client:    &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// AuthURL returns the provider's authorization URL for the state, the nonce and the PKCE verifier
+func (p *OIDCProvider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	oauth, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the code, and verifies the ID token of the response with the nonce
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*model.ExternalClaims, error) {
+	oauth, idVerifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = oidc.ClientContext(ctx, p.client)
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to redeem the code: %v", model.ErrUnauthenticated, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", model.ErrUnauthenticated, errNoIDToken)
+	}
+	idToken, err := idVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", model.ErrUnauthenticated, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: the nonce of the ID token does not match", model.ErrUnauthenticated)
+	}
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Locale        string `json:"locale"`
+	}
+	var all map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if err := idToken.Claims(&all); err != nil {
+		return nil, err
+	}
+	return &model.ExternalClaims{
+		Issuer:        idToken.Issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Locale:        claims.Locale,
+		Roles:         roles(all[p.roleClaim]),
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.verifier == nil {
+		provider, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), p.issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to discover the OpenID Connect provider: %w", err)
+		}
+		p.oauth.Endpoint = provider.Endpoint()
+		p.verifier = provider.Verifier(&oidc.Config{ClientID: p.oauth.ClientID})
+	}
+	oauth := p.oauth
+	return &oauth, p.verifier, nil
+}
+
+// roles reads a role claim, which providers send as a list or as a single string
+func roles(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const actionSeparator = "|"
+
+var errInvalidActionToken = errors.New("invalid or expired token")
+
+// SignAction issues a token of the action for the user, bound to the state of the account.
+// The token carries its purpose, user and expiry, signed together with the state.
+func (t *Keeper) SignAction(purpose string, userID uint, state string, ttl time.Duration) (string, error) {
+	if strings.Contains(purpose, actionSeparator) {
+		return "", fmt.Errorf("invalid purpose %q", purpose)
+	}
+	payload := strings.Join([]string{purpose, strconv.FormatUint(uint64(userID), 10),
+		strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)}, actionSeparator)
+	return encode([]byte(payload)) + "." + encode(t.actionMAC(payload, state)), nil
+}
+
+// ActionSubject returns the user of a well-formed and unexpired token of the purpose.
+// The signature is checked by VerifyAction, with the state of that user.
+func (t *Keeper) ActionSubject(purpose, token string) (uint, error) {
+	payload, _, err := splitAction(token)
+	if err != nil {
+		return 0, err
+	}
+	parts := strings.Split(payload, actionSeparator)
+	if len(parts) != 3 || parts[0] != purpose {
+		return 0, errInvalidActionToken
+	}
+	userID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, errInvalidActionToken
+	}
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return 0, errInvalidActionToken
+	}
+	return uint(userID), nil
+}
+
+// VerifyAction checks the token of the purpose against the current state of the account
+func (t *Keeper) VerifyAction(purpose, token, state string) error {
+	if _, err := t.ActionSubject(purpose, token); err != nil {
+		return err
+	}
+	payload, mac, err := splitAction(token)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, t.actionMAC(payload, state)) {
+		return errInvalidActionToken
+	}
+	return nil
+}
+
+// actionMAC signs the payload and the state, apart from the signatures of user tokens
+func (t *Keeper) actionMAC(payload, state string) []byte {
+	h := hmac.New(sha256.New, t.secretKey)
+	h.Write([]byte("action" + actionSeparator + payload + actionSeparator + state))
+	return h.Sum(nil)
+}
+
+func splitAction(token string) (string, []byte, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", nil, errInvalidActionToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", nil, errInvalidActionToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", nil, errInvalidActionToken
+	}
+	return string(payload), mac, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,76 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyAction(t *testing.T) {
+	k := NewTokenKeeper("secret", 1)
+	signed, err := k.SignAction("reset", 7, "hash-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, mac, _ := strings.Cut(signed, ".")
+	expired, err := k.SignAction("reset", 7, "hash-1", -2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		keeper  *Keeper
+		purpose string
+		token   string
+		state   string
+		wantErr bool
+	}{
+		{"valid", k, "reset", signed, "hash-1", false},
+		{"state changed", k, "reset", signed, "hash-2", true},
+		{"wrong purpose", k, "verify", signed, "hash-1", true},
+		{"expired", k, "reset", expired, "hash-1", true},
+		{"other secret", NewTokenKeeper("other", 1), "reset", signed, "hash-1", true},
+		{"other user", k, "reset", encode([]byte("reset|8|"+payloadExpiry(t, payload))) + "." + mac, "hash-1", true},
+		{"tampered signature", k, "reset", payload + "." + encode([]byte("forged")), "hash-1", true},
+		{"no signature", k, "reset", payload, "hash-1", true},
+		{"not base64", k, "reset", "!!." + mac, "hash-1", true},
+		{"empty", k, "reset", "", "hash-1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.keeper.VerifyAction(tt.purpose, tt.token, tt.state); (err != nil) != tt.wantErr {
+				t.Errorf("VerifyAction error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestActionSubject(t *testing.T) {
+	k := NewTokenKeeper("secret", 1)
+	signed, err := k.SignAction("verify", 42, "a@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := k.ActionSubject("verify", signed); err != nil || id != 42 {
+		t.Errorf("ActionSubject = %d, %v, want 42", id, err)
+	}
+	if _, err := k.ActionSubject("reset", signed); err == nil {
+		t.Error("ActionSubject took a token of another purpose")
+	}
+}
+
+func TestSignActionRejectsSeparator(t *testing.T) {
+	if _, err := NewTokenKeeper("secret", 1).SignAction("re|set", 7, "", time.Hour); err == nil {
+		t.Error("SignAction took a purpose with the separator")
+	}
+}
+
+// payloadExpiry returns the expiry field of an encoded payload
+func payloadExpiry(t *testing.T, encoded string) string {
+	t.Helper()
+	payload, _, err := splitAction(encoded + ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload[strings.LastIndex(payload, actionSeparator)+1:]
+}
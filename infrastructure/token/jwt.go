@@ -28,6 +28,8 @@ type UserClaims struct {
 	UserID     uint                 `json:"user_id,omitempty"`
 	UserName   string               `json:"user_name,omitempty"`
 	Permission model.UserPermission `json:"permission,omitempty"`
+	// Version is the token version of the user at issue, so that raising it revokes the token
+	Version uint `json:"ver,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -36,10 +38,10 @@ func NewTokenKeeper(secretKey string, expireInHours uint) *Keeper {
 	return &Keeper{[]byte(secretKey), expireInHours}
 }
 
-// GenerateToken generates a new JWT token.
-func (t *Keeper) GenerateToken(userID uint, email string, perm model.UserPermission) (string, error) {
+// GenerateToken generates a new JWT token at the user's token version.
+func (t *Keeper) GenerateToken(userID uint, email string, perm model.UserPermission, version uint) (string, error) {
 	claims := UserClaims{
-		userID, email, perm,
+		userID, email, perm, version,
 		jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(t.expireHours) * time.Hour)),
 		},
@@ -78,3 +80,17 @@ func (t *Keeper) HasPermission(tokenResult string, perm model.UserPermission) (b
 	}
 	return claims.Permission >= perm, nil
 }
+
+// ParseToken parses the token and returns the user identity it carries.
+func (t *Keeper) ParseToken(tokenResult string) (*model.UserIdentity, error) {
+	claims, err := t.ExtractToken(tokenResult)
+	if err != nil {
+		return nil, err
+	}
+	return &model.UserIdentity{
+		UserID:       claims.UserID,
+		Email:        claims.UserName,
+		Permission:   claims.Permission,
+		TokenVersion: claims.Version,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package token
+
+import (
+	"testing"
+
+	"literank.com/rest-books/domain/model"
+)
+
+func TestParseToken(t *testing.T) {
+	k := NewTokenKeeper("secret", 1)
+	tests := []struct {
+		name    string
+		perm    model.UserPermission
+		version uint
+	}{
+		{"first version", model.PermUser, 0},
+		{"revoked before", model.PermAuthor, 3},
+		{"admin", model.PermAdmin, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := k.GenerateToken(7, "a@example.com", tt.perm, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := k.ParseToken(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := model.UserIdentity{UserID: 7, Email: "a@example.com", Permission: tt.perm, TokenVersion: tt.version}
+			if got.UserID != want.UserID || got.Email != want.Email || got.Permission != want.Permission ||
+				got.TokenVersion != want.TokenVersion {
+				t.Errorf("ParseToken = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	k := NewTokenKeeper("secret", 1)
+	signed, err := k.GenerateToken(7, "a@example.com", model.PermAdmin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := NewTokenKeeper("secret", 0).GenerateToken(7, "a@example.com", model.PermAdmin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		keeper *Keeper
+		token  string
+	}{
+		"other secret": {NewTokenKeeper("other", 1), signed},
+		"expired":      {k, expired},
+		"tampered":     {k, signed[:len(signed)-2] + "xx"},
+		"garbage":      {k, "not.a.token"},
+	}
+	for name, tt := range tests {
+		if _, err := tt.keeper.ParseToken(tt.token); err == nil {
+			t.Errorf("%s: ParseToken accepted the token", name)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package token
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the test vectors of RFC 6238, appendix B
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPVectors(t *testing.T) {
+	// The RFC lists 8 digits; 6-digit codes are their last 6
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0), 0)
+		if !ok {
+			t.Errorf("code %s at %d was refused", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("code %s at %d matched step %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step := at.Unix() / totpPeriod
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current", "050471", 0, step, true},
+		{"step before, no skew", "081804", 0, 0, false},
+		{"step before, skew 1", "081804", 1, step - 1, true},
+		{"wrong code", "123456", 1, 0, false},
+		{"too short", "05047", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(rfc6238Secret, tt.code, at, tt.skew)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Errorf("ValidateTOTP = %d, %v; want %d, %v", got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+	if _, ok := ValidateTOTP("not base32!", "050471", at, 1); ok {
+		t.Error("ValidateTOTP accepted a code of an invalid secret")
+	}
+}
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormPlugin wraps every gorm operation in a span
+type gormPlugin struct {
+	tracer trace.Tracer
+}
+
+// GormPlugin returns a gorm plugin creating a child span per query
+func (p *Provider) GormPlugin() gorm.Plugin {
+	return &gormPlugin{tracer: p.tracer()}
+}
+
+// Name returns the plugin name
+func (p *gormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize registers the callbacks around every gorm operation
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("tracing:before_create", p.before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", p.after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", p.before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", p.after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", p.before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", p.after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", p.before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", p.after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", p.before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", p.after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", p.before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", p.after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *gormPlugin) before(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, _ := p.tracer.Start(db.Statement.Context, "gorm."+op,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", db.Dialector.Name()),
+				semconv.DBOperationName(op),
+			))
+		db.Statement.Context = ctx
+	}
+}
+
+func (p *gormPlugin) after(db *gorm.DB) {
+	span := trace.SpanFromContext(db.Statement.Context)
+	if !span.IsRecording() {
+		return
+	}
+	// The SQL is kept without its values, which may be password hashes
+	span.SetAttributes(semconv.DBQueryText(db.Statement.SQL.String()),
+		semconv.DBCollectionName(db.Statement.Table))
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// mongoTracer keeps the spans of the running mongo commands
+type mongoTracer struct {
+	tracer trace.Tracer
+	spans  sync.Map
+}
+
+// MongoMonitor returns a mongo command monitor creating a child span per command
+func (p *Provider) MongoMonitor() *event.CommandMonitor {
+	t := &mongoTracer{tracer: p.tracer()}
+	return &event.CommandMonitor{
+		Started:   t.started,
+		Succeeded: t.succeeded,
+		Failed:    t.failed,
+	}
+}
+
+func (t *mongoTracer) started(ctx context.Context, e *event.CommandStartedEvent) {
+	_, span := t.tracer.Start(ctx, "mongo."+e.CommandName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBOperationName(e.CommandName),
+			semconv.DBNamespace(e.DatabaseName),
+		))
+	t.spans.Store(e.RequestID, span)
+}
+
+func (t *mongoTracer) succeeded(_ context.Context, e *event.CommandSucceededEvent) {
+	if v, ok := t.spans.LoadAndDelete(e.RequestID); ok {
+		v.(trace.Span).End()
+	}
+}
+
+func (t *mongoTracer) failed(_ context.Context, e *event.CommandFailedEvent) {
+	if v, ok := t.spans.LoadAndDelete(e.RequestID); ok {
+		span := v.(trace.Span)
+		span.SetStatus(codes.Error, e.Failure)
+		span.End()
+	}
+}
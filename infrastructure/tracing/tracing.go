@@ -0,0 +1,102 @@
+/*
+Package tracing sets up OpenTelemetry tracing and instruments the backends.
+*/
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"literank.com/rest-books/infrastructure/config"
+)
+
+// ServiceName names the app in traces
+const ServiceName = "lrbooks"
+
+// Exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+// instrumentationName is the name of the tracers of this module
+const instrumentationName = "literank.com/rest-books"
+
+// Propagator reads and writes W3C traceparent and baggage headers
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Provider is the tracer provider with its shutdown func
+type Provider struct {
+	trace.TracerProvider
+	shutdown func(context.Context) error
+}
+
+// NewProvider constructs a tracer provider exporting to the configured exporter.
+// If tracing is disabled, the provider records nothing but still passes on incoming trace contexts.
+func NewProvider(c *config.TraceConfig) (*Provider, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch c.Exporter {
+	case "", ExporterNone:
+		return &Provider{TracerProvider: noop.NewTracerProvider()}, nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{}
+		if c.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", c.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ratio := c.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+		// Follow the caller's sampling decision, so that a trace is never cut in half
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	return &Provider{TracerProvider: tp, shutdown: tp.Shutdown}, nil
+}
+
+// tracer returns the tracer of this module
+func (p *Provider) tracer() trace.Tracer {
+	return p.TracerProvider.Tracer(instrumentationName)
+}
+
+// Shutdown flushes the pending spans and stops the exporter
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.shutdown == nil {
+		return nil
+	}
+	return p.shutdown(ctx)
+}
+
+// Tracer returns the tracer of this module from the global tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
@@ -4,20 +4,71 @@ package main provides the main entry point.
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
 
 	"literank.com/rest-books/adaptor"
+	"literank.com/rest-books/adaptor/rpc"
 	"literank.com/rest-books/application"
+	"literank.com/rest-books/application/executor"
 	"literank.com/rest-books/infrastructure/config"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const (
+	defaultConfigFile      = "config.yml"
+	defaultShutdownTimeout = 30 * time.Second
 )
 
-const configFileName = "config.yml"
+// Flags override the config file and the environment, but only when given
+var (
+	configFile = flag.String("config", defaultConfigFile, "path of the YAML config file")
+	port       = flag.Int("port", 0, "port of the HTTP server")
+	grpcPort   = flag.Int("grpc-port", 0, "port of the gRPC server, 0 to disable it")
+	logLevel   = flag.String("log-level", "", "one of debug, info, warn and error")
+)
 
 func main() {
-	// Read the config
-	c, err := config.Parse(configFileName)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [config print | migrate ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	c, err := loadConfig()
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	switch args := flag.Args(); {
+	case len(args) == 0:
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		printConfig(c)
+		return
+	case args[0] == "migrate":
+		if err := runMigrate(c, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := c.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(1)
 	}
 
 	// Prepare dependencies
@@ -25,14 +76,141 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	logger := wireHelper.Logger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 2)
+
+	// Run the gRPC server on its own port
+	var grpcServer *grpc.Server
+	if c.App.GRPCPort > 0 {
+		if grpcServer, err = runGRPC(wireHelper, c.App.GRPCPort, serveErr); err != nil {
+			panic(err)
+		}
+	}
 
-	// Build main router
-	r, err := adaptor.MakeRouter(wireHelper)
+	// Build the main server
+	s, err := adaptor.MakeServer(wireHelper)
 	if err != nil {
 		panic(err)
 	}
-	// Run the server on the specified port
-	if err := r.Run(fmt.Sprintf(":%d", c.App.Port)); err != nil {
+	lis, err := net.Listen("tcp", s.Addr)
+	if err != nil {
 		panic(err)
 	}
+	go func() {
+		if err := s.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+	wireHelper.HealthOperator().SetPhase(executor.PhaseServing)
+	go watchConfig(ctx, wireHelper, logger)
+	logger.Info("Server started", "port", c.App.Port, "grpc_port", c.App.GRPCPort)
+
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutting down")
+	case err := <-serveErr:
+		logger.Error("Server failed", logging.KeyError, err)
+	}
+	shutdown(wireHelper, s, grpcServer, logger)
+}
+
+// loadConfig layers the defaults, the config file, the environment and the flags
+func loadConfig() (*config.Config, error) {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	c, err := config.Load(configFilename(), os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	if given["port"] {
+		c.App.Port = *port
+	}
+	if given["grpc-port"] {
+		c.App.GRPCPort = *grpcPort
+	}
+	if given["log-level"] {
+		c.Log.Level = *logLevel
+	}
+	return c, nil
+}
+
+// configFilename returns the config file to read, or empty if there is none
+func configFilename() string {
+	given := false
+	flag.Visit(func(f *flag.Flag) { given = given || f.Name == "config" })
+	if _, err := os.Stat(*configFile); errors.Is(err, os.ErrNotExist) && !given {
+		// The default file is optional, so that the environment alone can configure the app
+		return ""
+	}
+	return *configFile
+}
+
+// printConfig prints the config with its secrets redacted, and its problems if any
+func printConfig(c *config.Config) {
+	buf, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(string(buf))
+	if err := c.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runGRPC starts serving gRPC, and reports a failure to serve on errs
+func runGRPC(wireHelper *application.WireHelper, port int, errs chan<- error) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	s := rpc.MakeServer(wireHelper)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			errs <- err
+		}
+	}()
+	return s, nil
+}
+
+// shutdown drains the servers, then closes the backends they use
+func shutdown(wireHelper *application.WireHelper, s *http.Server, grpcServer *grpc.Server, logger *slog.Logger) {
+	// Readiness checks fail from now on, so no new traffic is sent here once load balancers notice;
+	// until then, requests are still served
+	wireHelper.HealthOperator().SetPhase(executor.PhaseDraining)
+	if d := wireHelper.Config().App.DrainDelay; d > 0 {
+		logger.Info("Draining", "delay_seconds", d)
+		time.Sleep(time.Second * time.Duration(d))
+	}
+	timeout := defaultShutdownTimeout
+	if t := wireHelper.Config().App.ShutdownTimeout; t > 0 {
+		timeout = time.Second * time.Duration(t)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		logger.Error("Failed to drain HTTP connections", logging.KeyError, err)
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+	if err := wireHelper.Close(ctx); err != nil {
+		logger.Error("Failed to close backends", logging.KeyError, err)
+	}
+	logger.Info("Server stopped")
 }
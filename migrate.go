@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"literank.com/rest-books/infrastructure/config"
+	"literank.com/rest-books/infrastructure/database"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+const migrateUsage = `Usage: %s [flags] migrate [-dialect mysql|sqlite] [-dir DIR] COMMAND
+
+Commands:
+  up [N]        apply N pending migrations, all if N is not given
+  down [N]      revert the N latest migrations, 1 if N is not given
+  status        list the migrations and when they were applied
+  create NAME   add empty up and down scripts of the next version for every dialect
+  mongo         create or update the validator and indexes of the MongoDB collections
+`
+
+// migrator is the part of the persistences the migrate command needs
+type migrator interface {
+	Migrator(logger *slog.Logger) (*database.Migrator, error)
+	Close() error
+}
+
+// runMigrate runs the migrate command with its arguments
+func runMigrate(c *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dialect := fs.String("dialect", database.DialectMySQL, "mysql, or sqlite for the db.file_name database")
+	dir := fs.String("dir", database.MigrationsDir, "migrations directory of the source tree, for create")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), migrateUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing migrate command")
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New("usage: migrate create NAME")
+		}
+		files, err := database.CreateMigration(*dir, args[1])
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		return nil
+	}
+
+	logger, _, err := logging.NewLogger(&c.Log)
+	if err != nil {
+		return err
+	}
+	if args[0] == "mongo" {
+		mdb, err := database.NewMongoPersistence(&c.DB, logger)
+		if err != nil {
+			return err
+		}
+		defer mdb.Close(context.Background())
+		return mdb.EnsureSchema(context.Background(), logger)
+	}
+	var db migrator
+	switch *dialect {
+	case database.DialectMySQL:
+		db, err = database.NewMySQLPersistence(&c.DB, c.App.PageSize, logger)
+	case database.DialectSQLite:
+		db, err = database.NewSQLitePersistence(c.DB.FileName)
+	default:
+		return fmt.Errorf("unknown dialect %q", *dialect)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m, err := db.Migrator(logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		steps, err := stepsArg(args, 0)
+		if err != nil {
+			return err
+		}
+		n, err := m.Up(ctx, steps)
+		fmt.Printf("%d migrations applied\n", n)
+		return err
+	case "down":
+		steps, err := stepsArg(args, 1)
+		if err != nil {
+			return err
+		}
+		n, err := m.Down(ctx, steps)
+		fmt.Printf("%d migrations reverted\n", n)
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			at := "pending"
+			if s.AppliedAt != nil {
+				at = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, at)
+		}
+		return w.Flush()
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// stepsArg reads the optional step count after the command
+func stepsArg(args []string, defaultSteps int) (int, error) {
+	if len(args) < 2 {
+		return defaultSteps, nil
+	}
+	steps, err := strconv.Atoi(args[1])
+	if err != nil || steps < 1 {
+		return 0, fmt.Errorf("invalid number of steps %q", args[1])
+	}
+	return steps, nil
+}
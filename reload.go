@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"literank.com/rest-books/application"
+	"literank.com/rest-books/infrastructure/logging"
+)
+
+// reloadDelay lets editors finish writing the file before it is read
+const reloadDelay = 500 * time.Millisecond
+
+// watchConfig reloads the config on SIGHUP and whenever the config file changes, until ctx is done
+func watchConfig(ctx context.Context, wireHelper *application.WireHelper, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var fileEvents <-chan fsnotify.Event
+	if filename := configFilename(); filename != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			logger.Error("Failed to watch config file", logging.KeyError, err)
+		} else {
+			defer watcher.Close()
+			// Watch the directory, since editors and config maps replace the file instead of writing to it
+			if err := watcher.Add(filepath.Dir(filename)); err != nil {
+				logger.Error("Failed to watch config file", "file", filename, logging.KeyError, err)
+			}
+			fileEvents = filterEvents(ctx, watcher, filepath.Clean(filename))
+		}
+	}
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reloadConfig(wireHelper, logger, "signal")
+		case <-fileEvents:
+			delay = time.After(reloadDelay)
+		case <-delay:
+			reloadConfig(wireHelper, logger, "file")
+		}
+	}
+}
+
+// filterEvents passes on the writes to the file among the events of its directory
+func filterEvents(ctx context.Context, watcher *fsnotify.Watcher, filename string) <-chan fsnotify.Event {
+	events := make(chan fsnotify.Event)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isConfigChange(e, filename) {
+					continue
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// isConfigChange tells if the event may have changed the file.
+// Kubernetes updates mounted config maps by swapping the hidden ..data link next to the file.
+func isConfigChange(e fsnotify.Event, filename string) bool {
+	if !e.Has(fsnotify.Write) && !e.Has(fsnotify.Create) && !e.Has(fsnotify.Rename) {
+		return false
+	}
+	return filepath.Clean(e.Name) == filename || strings.HasPrefix(filepath.Base(e.Name), "..")
+}
+
+func reloadConfig(wireHelper *application.WireHelper, logger *slog.Logger, trigger string) {
+	c, err := loadConfig()
+	if err != nil {
+		logger.Error("Failed to reload config", "trigger", trigger, logging.KeyError, err)
+		return
+	}
+	status, err := wireHelper.Reload(c)
+	if err != nil {
+		logger.Error("Rejected invalid config", "trigger", trigger, logging.KeyError, err)
+		return
+	}
+	for _, key := range status.Rejected {
+		logger.Warn("Config change needs a restart", "key", key)
+	}
+	logger.Info("Config reloaded", "trigger", trigger, "version", status.Version)
+}